@@ -0,0 +1,52 @@
+// Command collisions reports short codes that only differ in case. Run it before enabling
+// CASE_INSENSITIVE_CODES and applying migrations/optional/case-insensitive-codes.sql, which makes
+// codes unique regardless of case: each reported group has to be renamed down to one code first.
+// It exits with status 1 when collisions are found.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kristina71/bitlytest/pkg/adapters"
+	"github.com/kristina71/bitlytest/pkg/config"
+
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	cfg := config.New()
+	db := adapters.DBConnect(cfg)
+	if db == nil {
+		os.Exit(2)
+	}
+	defer db.Close()
+
+	collisions, err := adapters.New(db).CaseCollisions(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(collisions) == 0 {
+		fmt.Println("no codes collide when case is ignored")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DOMAIN\tCODE\tCOLLIDING CODES")
+	for _, collision := range collisions {
+		domain := collision.Domain
+		if domain == "" {
+			domain = "(default)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", domain, collision.Folded, strings.Join(collision.Codes, ", "))
+	}
+	w.Flush()
+
+	db.Close()
+	os.Exit(1)
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/kristina71/bitlytest/pkg/adapters"
 	"github.com/kristina71/bitlytest/pkg/config"
 	endpoints "github.com/kristina71/bitlytest/pkg/endpoints"
+	"github.com/kristina71/bitlytest/pkg/grpcserver"
 	"github.com/kristina71/bitlytest/pkg/repositories"
 	"github.com/kristina71/bitlytest/pkg/service"
 
@@ -19,8 +22,25 @@ func main() {
 	cfg := config.New()
 	db := adapters.DBConnect(cfg)
 	adapters := adapters.New(db)
-	repo := repositories.New(adapters)
-	service := service.New(repo)
+	repo := repositories.New(adapters, cfg)
+	service := service.New(repo, cfg)
+
+	if cfg.EnrichEnabled {
+		go service.RunEnrichment(context.Background())
+	}
+	go service.RunPurge(context.Background())
+	go service.RunWebhooks(context.Background())
+	if cfg.EventsSink != "" {
+		go service.RunEventRelay(context.Background())
+	}
+
+	listener, err := net.Listen("tcp", cfg.GrpcAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		log.Fatal(grpcserver.New(service).Serve(listener))
+	}()
 
 	srv := &http.Server{
 		Handler:      endpoints.New(service),
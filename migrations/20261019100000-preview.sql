@@ -0,0 +1,6 @@
+
+-- +migrate Up
+ALTER TABLE bitlytest ADD COLUMN always_preview BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +migrate Down
+ALTER TABLE bitlytest DROP COLUMN always_preview;
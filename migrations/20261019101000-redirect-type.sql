@@ -0,0 +1,6 @@
+
+-- +migrate Up
+ALTER TABLE bitlytest ADD COLUMN redirect_type TEXT NOT NULL DEFAULT '308';
+
+-- +migrate Down
+ALTER TABLE bitlytest DROP COLUMN redirect_type;
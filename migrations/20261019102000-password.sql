@@ -0,0 +1,6 @@
+
+-- +migrate Up
+ALTER TABLE bitlytest ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
+
+-- +migrate Down
+ALTER TABLE bitlytest DROP COLUMN password_hash;
@@ -0,0 +1,8 @@
+
+-- +migrate Up
+ALTER TABLE bitlytest ADD COLUMN active_from TIMESTAMP WITHOUT TIME ZONE;
+ALTER TABLE bitlytest ADD COLUMN active_until TIMESTAMP WITHOUT TIME ZONE;
+
+-- +migrate Down
+ALTER TABLE bitlytest DROP COLUMN active_until;
+ALTER TABLE bitlytest DROP COLUMN active_from;
@@ -0,0 +1,12 @@
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS geo_rules(
+    id SERIAL8 PRIMARY KEY,
+    url_id INT8 NOT NULL REFERENCES bitlytest (id) ON DELETE CASCADE,
+    country TEXT NOT NULL CHECK (country ~ '^[A-Z]{2}$'),
+    target_url TEXT NOT NULL CHECK (target_url <> ''),
+    UNIQUE (url_id, country)
+);
+
+-- +migrate Down
+DROP TABLE geo_rules;
@@ -0,0 +1,15 @@
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS device_rules(
+    id SERIAL8 PRIMARY KEY,
+    url_id INT8 NOT NULL REFERENCES bitlytest (id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    os TEXT NOT NULL DEFAULT '',
+    device TEXT NOT NULL DEFAULT '',
+    browser TEXT NOT NULL DEFAULT '',
+    target_url TEXT NOT NULL CHECK (target_url <> ''),
+    UNIQUE (url_id, position)
+);
+
+-- +migrate Down
+DROP TABLE device_rules;
@@ -0,0 +1,14 @@
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS variants(
+    id SERIAL8 PRIMARY KEY,
+    url_id INT8 NOT NULL REFERENCES bitlytest (id) ON DELETE CASCADE,
+    target_url TEXT NOT NULL CHECK (target_url <> ''),
+    weight INT NOT NULL CHECK (weight >= 0),
+    clicks INT8 NOT NULL DEFAULT 0
+);
+
+CREATE INDEX ON variants (url_id);
+
+-- +migrate Down
+DROP TABLE variants;
@@ -0,0 +1,12 @@
+
+-- +migrate Up
+ALTER TABLE bitlytest ADD COLUMN query_policy TEXT NOT NULL DEFAULT 'drop';
+ALTER TABLE bitlytest ADD COLUMN utm_source TEXT NOT NULL DEFAULT '';
+ALTER TABLE bitlytest ADD COLUMN utm_medium TEXT NOT NULL DEFAULT '';
+ALTER TABLE bitlytest ADD COLUMN utm_campaign TEXT NOT NULL DEFAULT '';
+
+-- +migrate Down
+ALTER TABLE bitlytest DROP COLUMN utm_campaign;
+ALTER TABLE bitlytest DROP COLUMN utm_medium;
+ALTER TABLE bitlytest DROP COLUMN utm_source;
+ALTER TABLE bitlytest DROP COLUMN query_policy;
@@ -0,0 +1,23 @@
+
+-- +migrate Up
+ALTER TABLE bitlytest ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE bitlytest ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS tags(
+    id SERIAL8 PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS url_tags(
+    url_id INT8 NOT NULL REFERENCES bitlytest (id) ON DELETE CASCADE,
+    tag_id INT8 NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (url_id, tag_id)
+);
+
+CREATE INDEX ON url_tags (tag_id);
+
+-- +migrate Down
+DROP TABLE url_tags;
+DROP TABLE tags;
+ALTER TABLE bitlytest DROP COLUMN notes;
+ALTER TABLE bitlytest DROP COLUMN title;
@@ -0,0 +1,14 @@
+
+-- +migrate Up
+ALTER TABLE bitlytest ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE bitlytest ADD COLUMN image_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE bitlytest ADD COLUMN favicon_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE bitlytest ADD COLUMN enriched_at TIMESTAMP WITHOUT TIME ZONE;
+
+CREATE INDEX ON bitlytest (id) WHERE enriched_at IS NULL;
+
+-- +migrate Down
+ALTER TABLE bitlytest DROP COLUMN enriched_at;
+ALTER TABLE bitlytest DROP COLUMN favicon_url;
+ALTER TABLE bitlytest DROP COLUMN image_url;
+ALTER TABLE bitlytest DROP COLUMN description;
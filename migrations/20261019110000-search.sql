@@ -0,0 +1,59 @@
+
+-- +migrate Up
+ALTER TABLE bitlytest ADD COLUMN search TSVECTOR;
+
+-- +migrate StatementBegin
+CREATE FUNCTION bitlytest_search_vector(link bitlytest) RETURNS TSVECTOR AS $$
+    SELECT setweight(to_tsvector('simple', link.small_url), 'A') ||
+           setweight(to_tsvector('simple', link.title), 'A') ||
+           setweight(to_tsvector('simple', coalesce((
+               SELECT string_agg(tags.name, ' ') FROM url_tags JOIN tags ON tags.id = url_tags.tag_id WHERE url_tags.url_id = link.id
+           ), '')), 'B') ||
+           setweight(to_tsvector('simple', regexp_replace(link.origin_url, '[/:?&=.#_~+-]+', ' ', 'g')), 'C') ||
+           setweight(to_tsvector('simple', link.notes), 'D');
+$$ LANGUAGE SQL STABLE;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE FUNCTION bitlytest_search_update() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search := bitlytest_search_vector(NEW);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE FUNCTION url_tags_search_update() RETURNS TRIGGER AS $$
+DECLARE
+    link_id INT8;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        link_id := OLD.url_id;
+    ELSE
+        link_id := NEW.url_id;
+    END IF;
+    UPDATE bitlytest SET search = bitlytest_search_vector(bitlytest) WHERE id = link_id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+CREATE TRIGGER bitlytest_search BEFORE INSERT OR UPDATE ON bitlytest
+    FOR EACH ROW EXECUTE PROCEDURE bitlytest_search_update();
+
+CREATE TRIGGER url_tags_search AFTER INSERT OR DELETE ON url_tags
+    FOR EACH ROW EXECUTE PROCEDURE url_tags_search_update();
+
+UPDATE bitlytest SET search = bitlytest_search_vector(bitlytest);
+
+CREATE INDEX bitlytest_search_idx ON bitlytest USING GIN (search);
+
+-- +migrate Down
+DROP INDEX bitlytest_search_idx;
+DROP TRIGGER url_tags_search ON url_tags;
+DROP TRIGGER bitlytest_search ON bitlytest;
+DROP FUNCTION url_tags_search_update();
+DROP FUNCTION bitlytest_search_update();
+DROP FUNCTION bitlytest_search_vector(bitlytest);
+ALTER TABLE bitlytest DROP COLUMN search;
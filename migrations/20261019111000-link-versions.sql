@@ -0,0 +1,16 @@
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS link_versions(
+    id SERIAL8 PRIMARY KEY,
+    url_id INT8 NOT NULL REFERENCES bitlytest (id) ON DELETE CASCADE,
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    changed_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    old_value JSONB,
+    new_value JSONB
+);
+
+CREATE INDEX ON link_versions (url_id, id);
+
+-- +migrate Down
+DROP TABLE link_versions;
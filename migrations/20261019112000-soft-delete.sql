@@ -0,0 +1,9 @@
+
+-- +migrate Up
+ALTER TABLE bitlytest ADD COLUMN deleted_at TIMESTAMP WITHOUT TIME ZONE;
+
+CREATE INDEX ON bitlytest (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +migrate Down
+DELETE FROM bitlytest WHERE deleted_at IS NOT NULL;
+ALTER TABLE bitlytest DROP COLUMN deleted_at;
@@ -0,0 +1,38 @@
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS aliases(
+    id SERIAL8 PRIMARY KEY,
+    url_id INT8 NOT NULL REFERENCES bitlytest (id) ON DELETE CASCADE,
+    code TEXT NOT NULL UNIQUE CHECK (code <> ''),
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+);
+
+CREATE INDEX ON aliases (url_id);
+CREATE UNIQUE INDEX ON aliases (url_id) WHERE is_primary;
+
+-- Every existing short code becomes the primary alias of its link.
+INSERT INTO aliases (url_id, code, is_primary, created_at)
+SELECT id, small_url, TRUE, created_at FROM bitlytest;
+
+-- bitlytest.small_url stays the primary code, the trigger keeps its alias in sync.
+-- +migrate StatementBegin
+CREATE FUNCTION bitlytest_primary_alias() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO aliases (url_id, code, is_primary, created_at) VALUES (NEW.id, NEW.small_url, TRUE, NEW.created_at);
+    ELSIF NEW.small_url <> OLD.small_url THEN
+        UPDATE aliases SET code = NEW.small_url WHERE url_id = NEW.id AND is_primary;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+CREATE TRIGGER bitlytest_primary_alias AFTER INSERT OR UPDATE OF small_url ON bitlytest
+    FOR EACH ROW EXECUTE PROCEDURE bitlytest_primary_alias();
+
+-- +migrate Down
+DROP TRIGGER bitlytest_primary_alias ON bitlytest;
+DROP FUNCTION bitlytest_primary_alias();
+DROP TABLE aliases;
@@ -0,0 +1,16 @@
+
+-- +migrate Up
+ALTER TABLE bitlytest ADD COLUMN owner TEXT NOT NULL DEFAULT 'anonymous';
+ALTER TABLE bitlytest ADD COLUMN origin_hash TEXT;
+
+UPDATE bitlytest SET owner = link_versions.actor FROM link_versions
+    WHERE link_versions.url_id = bitlytest.id AND link_versions.action = 'create';
+UPDATE bitlytest SET origin_hash = encode(sha256(convert_to(origin_url, 'UTF8')), 'hex');
+
+ALTER TABLE bitlytest ALTER COLUMN origin_hash SET NOT NULL;
+CREATE INDEX bitlytest_owner_origin_hash ON bitlytest (owner, origin_hash) WHERE deleted_at IS NULL;
+
+-- +migrate Down
+DROP INDEX bitlytest_owner_origin_hash;
+ALTER TABLE bitlytest DROP COLUMN origin_hash;
+ALTER TABLE bitlytest DROP COLUMN owner;
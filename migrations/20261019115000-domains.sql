@@ -0,0 +1,56 @@
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS domains(
+    id SERIAL8 PRIMARY KEY,
+    host TEXT NOT NULL UNIQUE CHECK (host <> ''),
+    fallback_url TEXT NOT NULL DEFAULT '',
+    verify_token TEXT NOT NULL,
+    verified_at TIMESTAMP WITHOUT TIME ZONE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+);
+
+-- An empty domain stands for the host the server runs on.
+ALTER TABLE bitlytest ADD COLUMN domain TEXT NOT NULL DEFAULT '';
+ALTER TABLE bitlytest DROP CONSTRAINT bitlytest_small_url_key;
+CREATE UNIQUE INDEX bitlytest_domain_small_url ON bitlytest (domain, small_url);
+
+ALTER TABLE aliases ADD COLUMN domain TEXT NOT NULL DEFAULT '';
+ALTER TABLE aliases DROP CONSTRAINT aliases_code_key;
+ALTER TABLE aliases ADD CONSTRAINT aliases_domain_code_key UNIQUE (domain, code);
+
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION bitlytest_primary_alias() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO aliases (url_id, domain, code, is_primary, created_at) VALUES (NEW.id, NEW.domain, NEW.small_url, TRUE, NEW.created_at);
+    ELSIF NEW.small_url <> OLD.small_url THEN
+        UPDATE aliases SET code = NEW.small_url WHERE url_id = NEW.id AND is_primary;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION bitlytest_primary_alias() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO aliases (url_id, code, is_primary, created_at) VALUES (NEW.id, NEW.small_url, TRUE, NEW.created_at);
+    ELSIF NEW.small_url <> OLD.small_url THEN
+        UPDATE aliases SET code = NEW.small_url WHERE url_id = NEW.id AND is_primary;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+ALTER TABLE aliases DROP CONSTRAINT aliases_domain_code_key;
+ALTER TABLE aliases ADD CONSTRAINT aliases_code_key UNIQUE (code);
+ALTER TABLE aliases DROP COLUMN domain;
+
+DROP INDEX bitlytest_domain_small_url;
+ALTER TABLE bitlytest ADD CONSTRAINT bitlytest_small_url_key UNIQUE (small_url);
+ALTER TABLE bitlytest DROP COLUMN domain;
+
+DROP TABLE domains;
@@ -0,0 +1,10 @@
+
+-- +migrate Up
+-- Lookups of codes regardless of case. The indexes are not unique, codes differing only in case may
+-- exist until CASE_INSENSITIVE_CODES is enabled, see migrations/optional/case-insensitive-codes.sql.
+CREATE INDEX bitlytest_domain_lower_small_url ON bitlytest (domain, lower(small_url));
+CREATE INDEX aliases_domain_lower_code ON aliases (domain, lower(code));
+
+-- +migrate Down
+DROP INDEX aliases_domain_lower_code;
+DROP INDEX bitlytest_domain_lower_small_url;
@@ -0,0 +1,33 @@
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS webhooks(
+    id SERIAL8 PRIMARY KEY,
+    url TEXT NOT NULL CHECK (url <> ''),
+    events TEXT[] NOT NULL,
+    secret TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+);
+
+-- Deliveries are the outbox of webhooks: they are written in the transaction of the link change
+-- and sent afterwards, so a change is never announced without being stored or stored without being announced.
+CREATE TABLE IF NOT EXISTS webhook_deliveries(
+    id SERIAL8 PRIMARY KEY,
+    webhook_id INT8 NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    last_status INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    delivered_at TIMESTAMP WITHOUT TIME ZONE
+);
+
+CREATE INDEX webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, id);
+
+-- +migrate Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
@@ -0,0 +1,26 @@
+
+-- +migrate Up
+-- link_events is the outbox of link changes, written in the transaction of the change. txid is the
+-- writing transaction: the relay reads events in (txid, id) order and only from transactions older than
+-- every running one, so an event never shows up behind a checkpoint that was already passed.
+CREATE TABLE IF NOT EXISTS link_events(
+    id BIGSERIAL PRIMARY KEY,
+    txid BIGINT NOT NULL DEFAULT txid_current(),
+    type TEXT NOT NULL,
+    link_id INT8 NOT NULL,
+    payload JSONB NOT NULL,
+    occurred_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+);
+
+CREATE INDEX link_events_position ON link_events (txid, id);
+
+CREATE TABLE IF NOT EXISTS event_checkpoints(
+    name TEXT PRIMARY KEY,
+    txid BIGINT NOT NULL,
+    event_id INT8 NOT NULL,
+    updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+);
+
+-- +migrate Down
+DROP TABLE event_checkpoints;
+DROP TABLE link_events;
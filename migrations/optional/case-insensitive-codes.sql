@@ -0,0 +1,10 @@
+-- Codes differing only in case can't coexist once short codes are matched case-insensitively.
+-- Apply with `make case-insensitive-codes` before setting CASE_INSENSITIVE_CODES=true: it runs
+-- cmd/collisions first, the indexes can't be built while it reports collisions.
+-- It is kept out of the migrations sql-migrate applies, deployments matching codes by case don't need it.
+BEGIN;
+DROP INDEX IF EXISTS bitlytest_domain_lower_small_url;
+DROP INDEX IF EXISTS aliases_domain_lower_code;
+CREATE UNIQUE INDEX bitlytest_domain_lower_small_url ON bitlytest (domain, lower(small_url));
+CREATE UNIQUE INDEX aliases_domain_lower_code ON aliases (domain, lower(code));
+COMMIT;
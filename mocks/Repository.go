@@ -4,6 +4,7 @@ package mocks
 
 import (
 	context "context"
+	time "time"
 
 	models "github.com/kristina71/bitlytest/pkg/models"
 	mock "github.com/stretchr/testify/mock"
@@ -14,6 +15,106 @@ type Repository struct {
 	mock.Mock
 }
 
+// AddAlias provides a mock function with given fields: ctx, alias
+func (_m *Repository) AddAlias(ctx context.Context, alias models.Alias) (models.Alias, error) {
+	ret := _m.Called(ctx, alias)
+
+	var r0 models.Alias
+	if rf, ok := ret.Get(0).(func(context.Context, models.Alias) models.Alias); ok {
+		r0 = rf(ctx, alias)
+	} else {
+		r0 = ret.Get(0).(models.Alias)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Alias) error); ok {
+		r1 = rf(ctx, alias)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AddDomain provides a mock function with given fields: ctx, domain
+func (_m *Repository) AddDomain(ctx context.Context, domain models.Domain) (models.Domain, error) {
+	ret := _m.Called(ctx, domain)
+
+	var r0 models.Domain
+	if rf, ok := ret.Get(0).(func(context.Context, models.Domain) models.Domain); ok {
+		r0 = rf(ctx, domain)
+	} else {
+		r0 = ret.Get(0).(models.Domain)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Domain) error); ok {
+		r1 = rf(ctx, domain)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AddWebhook provides a mock function with given fields: ctx, webhook
+func (_m *Repository) AddWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error) {
+	ret := _m.Called(ctx, webhook)
+
+	var r0 models.Webhook
+	if rf, ok := ret.Get(0).(func(context.Context, models.Webhook) models.Webhook); ok {
+		r0 = rf(ctx, webhook)
+	} else {
+		r0 = ret.Get(0).(models.Webhook)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Webhook) error); ok {
+		r1 = rf(ctx, webhook)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ClaimDeliveries provides a mock function with given fields: ctx, now, limit, leaseUntil
+func (_m *Repository) ClaimDeliveries(ctx context.Context, now time.Time, limit int, leaseUntil time.Time) ([]models.Delivery, error) {
+	ret := _m.Called(ctx, now, limit, leaseUntil)
+
+	var r0 []models.Delivery
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, int, time.Time) []models.Delivery); ok {
+		r0 = rf(ctx, now, limit, leaseUntil)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Delivery)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, int, time.Time) error); ok {
+		r1 = rf(ctx, now, limit, leaseUntil)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ComparePassword provides a mock function with given fields: ctx, hash, password
+func (_m *Repository) ComparePassword(ctx context.Context, hash string, password string) bool {
+	ret := _m.Called(ctx, hash, password)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) bool); ok {
+		r0 = rf(ctx, hash, password)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
 // Delete provides a mock function with given fields: ctx, url
 func (_m *Repository) Delete(ctx context.Context, url models.Url) error {
 	ret := _m.Called(ctx, url)
@@ -28,6 +129,85 @@ func (_m *Repository) Delete(ctx context.Context, url models.Url) error {
 	return r0
 }
 
+// DeleteBatch provides a mock function with given fields: ctx, ids
+func (_m *Repository) DeleteBatch(ctx context.Context, ids []uint16) ([]uint16, error) {
+	ret := _m.Called(ctx, ids)
+
+	var r0 []uint16
+	if rf, ok := ret.Get(0).(func(context.Context, []uint16) []uint16); ok {
+		r0 = rf(ctx, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]uint16)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []uint16) error); ok {
+		r1 = rf(ctx, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Export provides a mock function with given fields: ctx, fn
+func (_m *Repository) Export(ctx context.Context, fn func(url models.Url) error) error {
+	ret := _m.Called(ctx, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func(url models.Url) error) error); ok {
+		r0 = rf(ctx, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// FetchPageMeta provides a mock function with given fields: ctx, url
+func (_m *Repository) FetchPageMeta(ctx context.Context, url string) (models.PageMeta, error) {
+	ret := _m.Called(ctx, url)
+
+	var r0 models.PageMeta
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.PageMeta); ok {
+		r0 = rf(ctx, url)
+	} else {
+		r0 = ret.Get(0).(models.PageMeta)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, url)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindByOrigin provides a mock function with given fields: ctx, url
+func (_m *Repository) FindByOrigin(ctx context.Context, url models.Url) (models.Url, error) {
+	ret := _m.Called(ctx, url)
+
+	var r0 models.Url
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url) models.Url); ok {
+		r0 = rf(ctx, url)
+	} else {
+		r0 = ret.Get(0).(models.Url)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Url) error); ok {
+		r1 = rf(ctx, url)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GenerateUrl provides a mock function with given fields: ctx
 func (_m *Repository) GenerateUrl(ctx context.Context) string {
 	ret := _m.Called(ctx)
@@ -42,13 +222,13 @@ func (_m *Repository) GenerateUrl(ctx context.Context) string {
 	return r0
 }
 
-// Get provides a mock function with given fields: ctx
-func (_m *Repository) Get(ctx context.Context) ([]models.Url, error) {
-	ret := _m.Called(ctx)
+// Get provides a mock function with given fields: ctx, filter
+func (_m *Repository) Get(ctx context.Context, filter models.UrlFilter) ([]models.Url, error) {
+	ret := _m.Called(ctx, filter)
 
 	var r0 []models.Url
-	if rf, ok := ret.Get(0).(func(context.Context) []models.Url); ok {
-		r0 = rf(ctx)
+	if rf, ok := ret.Get(0).(func(context.Context, models.UrlFilter) []models.Url); ok {
+		r0 = rf(ctx, filter)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]models.Url)
@@ -56,8 +236,8 @@ func (_m *Repository) Get(ctx context.Context) ([]models.Url, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
-		r1 = rf(ctx)
+	if rf, ok := ret.Get(1).(func(context.Context, models.UrlFilter) error); ok {
+		r1 = rf(ctx, filter)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -65,8 +245,31 @@ func (_m *Repository) Get(ctx context.Context) ([]models.Url, error) {
 	return r0, r1
 }
 
-// GetBySmallUrl provides a mock function with given fields: ctx, url
-func (_m *Repository) GetBySmallUrl(ctx context.Context, url models.Url) (models.Url, error) {
+// GetAliases provides a mock function with given fields: ctx, url
+func (_m *Repository) GetAliases(ctx context.Context, url models.Url) ([]models.Alias, error) {
+	ret := _m.Called(ctx, url)
+
+	var r0 []models.Alias
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url) []models.Alias); ok {
+		r0 = rf(ctx, url)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Alias)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Url) error); ok {
+		r1 = rf(ctx, url)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetById provides a mock function with given fields: ctx, url
+func (_m *Repository) GetById(ctx context.Context, url models.Url) (models.Url, error) {
 	ret := _m.Called(ctx, url)
 
 	var r0 models.Url
@@ -86,15 +289,15 @@ func (_m *Repository) GetBySmallUrl(ctx context.Context, url models.Url) (models
 	return r0, r1
 }
 
-// Insert provides a mock function with given fields: ctx, url
-func (_m *Repository) Insert(ctx context.Context, url models.Url) (uint16, error) {
+// GetBySmallUrl provides a mock function with given fields: ctx, url
+func (_m *Repository) GetBySmallUrl(ctx context.Context, url models.Url) (models.Url, error) {
 	ret := _m.Called(ctx, url)
 
-	var r0 uint16
-	if rf, ok := ret.Get(0).(func(context.Context, models.Url) uint16); ok {
+	var r0 models.Url
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url) models.Url); ok {
 		r0 = rf(ctx, url)
 	} else {
-		r0 = ret.Get(0).(uint16)
+		r0 = ret.Get(0).(models.Url)
 	}
 
 	var r1 error
@@ -107,30 +310,803 @@ func (_m *Repository) Insert(ctx context.Context, url models.Url) (uint16, error
 	return r0, r1
 }
 
-// Update provides a mock function with given fields: ctx, url
-func (_m *Repository) Update(ctx context.Context, url models.Url) error {
+// GetCheckpoint provides a mock function with given fields: ctx, name
+func (_m *Repository) GetCheckpoint(ctx context.Context, name string) (models.Checkpoint, error) {
+	ret := _m.Called(ctx, name)
+
+	var r0 models.Checkpoint
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.Checkpoint); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Get(0).(models.Checkpoint)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDeliveries provides a mock function with given fields: ctx, filter
+func (_m *Repository) GetDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]models.Delivery, error) {
+	ret := _m.Called(ctx, filter)
+
+	var r0 []models.Delivery
+	if rf, ok := ret.Get(0).(func(context.Context, models.DeliveryFilter) []models.Delivery); ok {
+		r0 = rf(ctx, filter)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Delivery)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.DeliveryFilter) error); ok {
+		r1 = rf(ctx, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDeviceRules provides a mock function with given fields: ctx, url
+func (_m *Repository) GetDeviceRules(ctx context.Context, url models.Url) ([]models.DeviceRule, error) {
 	ret := _m.Called(ctx, url)
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, models.Url) error); ok {
+	var r0 []models.DeviceRule
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url) []models.DeviceRule); ok {
 		r0 = rf(ctx, url)
 	} else {
-		r0 = ret.Error(0)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.DeviceRule)
+		}
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Url) error); ok {
+		r1 = rf(ctx, url)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
-// ValidateUrl provides a mock function with given fields: ctx, url
-func (_m *Repository) ValidateUrl(ctx context.Context, url string) bool {
+// GetDomain provides a mock function with given fields: ctx, domain
+func (_m *Repository) GetDomain(ctx context.Context, domain models.Domain) (models.Domain, error) {
+	ret := _m.Called(ctx, domain)
+
+	var r0 models.Domain
+	if rf, ok := ret.Get(0).(func(context.Context, models.Domain) models.Domain); ok {
+		r0 = rf(ctx, domain)
+	} else {
+		r0 = ret.Get(0).(models.Domain)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Domain) error); ok {
+		r1 = rf(ctx, domain)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDomains provides a mock function with given fields: ctx
+func (_m *Repository) GetDomains(ctx context.Context) ([]models.Domain, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []models.Domain
+	if rf, ok := ret.Get(0).(func(context.Context) []models.Domain); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Domain)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetEvents provides a mock function with given fields: ctx, after, limit
+func (_m *Repository) GetEvents(ctx context.Context, after models.Checkpoint, limit int) ([]models.LinkEvent, error) {
+	ret := _m.Called(ctx, after, limit)
+
+	var r0 []models.LinkEvent
+	if rf, ok := ret.Get(0).(func(context.Context, models.Checkpoint, int) []models.LinkEvent); ok {
+		r0 = rf(ctx, after, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.LinkEvent)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Checkpoint, int) error); ok {
+		r1 = rf(ctx, after, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetGeoRules provides a mock function with given fields: ctx, url
+func (_m *Repository) GetGeoRules(ctx context.Context, url models.Url) ([]models.GeoRule, error) {
 	ret := _m.Called(ctx, url)
 
-	var r0 bool
-	if rf, ok := ret.Get(0).(func(context.Context, string) bool); ok {
+	var r0 []models.GeoRule
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url) []models.GeoRule); ok {
 		r0 = rf(ctx, url)
 	} else {
-		r0 = ret.Get(0).(bool)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.GeoRule)
+		}
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Url) error); ok {
+		r1 = rf(ctx, url)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetHistory provides a mock function with given fields: ctx, url
+func (_m *Repository) GetHistory(ctx context.Context, url models.Url) ([]models.LinkVersion, error) {
+	ret := _m.Called(ctx, url)
+
+	var r0 []models.LinkVersion
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url) []models.LinkVersion); ok {
+		r0 = rf(ctx, url)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.LinkVersion)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Url) error); ok {
+		r1 = rf(ctx, url)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUnenriched provides a mock function with given fields: ctx, limit
+func (_m *Repository) GetUnenriched(ctx context.Context, limit int) ([]models.Url, error) {
+	ret := _m.Called(ctx, limit)
+
+	var r0 []models.Url
+	if rf, ok := ret.Get(0).(func(context.Context, int) []models.Url); ok {
+		r0 = rf(ctx, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Url)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetVariants provides a mock function with given fields: ctx, url
+func (_m *Repository) GetVariants(ctx context.Context, url models.Url) ([]models.Variant, error) {
+	ret := _m.Called(ctx, url)
+
+	var r0 []models.Variant
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url) []models.Variant); ok {
+		r0 = rf(ctx, url)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Variant)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Url) error); ok {
+		r1 = rf(ctx, url)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetVersion provides a mock function with given fields: ctx, version
+func (_m *Repository) GetVersion(ctx context.Context, version models.LinkVersion) (models.LinkVersion, error) {
+	ret := _m.Called(ctx, version)
+
+	var r0 models.LinkVersion
+	if rf, ok := ret.Get(0).(func(context.Context, models.LinkVersion) models.LinkVersion); ok {
+		r0 = rf(ctx, version)
+	} else {
+		r0 = ret.Get(0).(models.LinkVersion)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.LinkVersion) error); ok {
+		r1 = rf(ctx, version)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetWebhooks provides a mock function with given fields: ctx
+func (_m *Repository) GetWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []models.Webhook
+	if rf, ok := ret.Get(0).(func(context.Context) []models.Webhook); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Webhook)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// HashPassword provides a mock function with given fields: ctx, password
+func (_m *Repository) HashPassword(ctx context.Context, password string) (string, error) {
+	ret := _m.Called(ctx, password)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
+		r0 = rf(ctx, password)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, password)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IncrementVariantClicks provides a mock function with given fields: ctx, variant
+func (_m *Repository) IncrementVariantClicks(ctx context.Context, variant models.Variant) error {
+	ret := _m.Called(ctx, variant)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Variant) error); ok {
+		r0 = rf(ctx, variant)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Insert provides a mock function with given fields: ctx, url
+func (_m *Repository) Insert(ctx context.Context, url models.Url) (uint16, error) {
+	ret := _m.Called(ctx, url)
+
+	var r0 uint16
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url) uint16); ok {
+		r0 = rf(ctx, url)
+	} else {
+		r0 = ret.Get(0).(uint16)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Url) error); ok {
+		r1 = rf(ctx, url)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// InsertBatch provides a mock function with given fields: ctx, urls
+func (_m *Repository) InsertBatch(ctx context.Context, urls []models.Url) ([]models.Url, error) {
+	ret := _m.Called(ctx, urls)
+
+	var r0 []models.Url
+	if rf, ok := ret.Get(0).(func(context.Context, []models.Url) []models.Url); ok {
+		r0 = rf(ctx, urls)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Url)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []models.Url) error); ok {
+		r1 = rf(ctx, urls)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// LookupCountry provides a mock function with given fields: ctx, ip
+func (_m *Repository) LookupCountry(ctx context.Context, ip string) string {
+	ret := _m.Called(ctx, ip)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
+		r0 = rf(ctx, ip)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// LookupTXT provides a mock function with given fields: ctx, name
+func (_m *Repository) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	ret := _m.Called(ctx, name)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, string) []string); ok {
+		r0 = rf(ctx, name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PruneDeliveries provides a mock function with given fields: ctx, before
+func (_m *Repository) PruneDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	ret := _m.Called(ctx, before)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) int64); ok {
+		r0 = rf(ctx, before)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PruneEvents provides a mock function with given fields: ctx, before
+func (_m *Repository) PruneEvents(ctx context.Context, before time.Time) (int64, error) {
+	ret := _m.Called(ctx, before)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) int64); ok {
+		r0 = rf(ctx, before)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PublishEvents provides a mock function with given fields: ctx, linkEvents
+func (_m *Repository) PublishEvents(ctx context.Context, linkEvents []models.LinkEvent) error {
+	ret := _m.Called(ctx, linkEvents)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []models.LinkEvent) error); ok {
+		r0 = rf(ctx, linkEvents)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Purge provides a mock function with given fields: ctx, before
+func (_m *Repository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	ret := _m.Called(ctx, before)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) int64); ok {
+		r0 = rf(ctx, before)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// QueueClick provides a mock function with given fields: ctx, url, destination
+func (_m *Repository) QueueClick(ctx context.Context, url models.Url, destination string) error {
+	ret := _m.Called(ctx, url, destination)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url, string) error); ok {
+		r0 = rf(ctx, url, destination)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RemoveAlias provides a mock function with given fields: ctx, alias
+func (_m *Repository) RemoveAlias(ctx context.Context, alias models.Alias) error {
+	ret := _m.Called(ctx, alias)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Alias) error); ok {
+		r0 = rf(ctx, alias)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RemoveWebhook provides a mock function with given fields: ctx, webhook
+func (_m *Repository) RemoveWebhook(ctx context.Context, webhook models.Webhook) error {
+	ret := _m.Called(ctx, webhook)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Webhook) error); ok {
+		r0 = rf(ctx, webhook)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Restore provides a mock function with given fields: ctx, url
+func (_m *Repository) Restore(ctx context.Context, url models.Url) (models.Url, error) {
+	ret := _m.Called(ctx, url)
+
+	var r0 models.Url
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url) models.Url); ok {
+		r0 = rf(ctx, url)
+	} else {
+		r0 = ret.Get(0).(models.Url)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Url) error); ok {
+		r1 = rf(ctx, url)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RetryDelivery provides a mock function with given fields: ctx, delivery
+func (_m *Repository) RetryDelivery(ctx context.Context, delivery models.Delivery) (models.Delivery, error) {
+	ret := _m.Called(ctx, delivery)
+
+	var r0 models.Delivery
+	if rf, ok := ret.Get(0).(func(context.Context, models.Delivery) models.Delivery); ok {
+		r0 = rf(ctx, delivery)
+	} else {
+		r0 = ret.Get(0).(models.Delivery)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Delivery) error); ok {
+		r1 = rf(ctx, delivery)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Rollback provides a mock function with given fields: ctx, url
+func (_m *Repository) Rollback(ctx context.Context, url models.Url) (models.Url, error) {
+	ret := _m.Called(ctx, url)
+
+	var r0 models.Url
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url) models.Url); ok {
+		r0 = rf(ctx, url)
+	} else {
+		r0 = ret.Get(0).(models.Url)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Url) error); ok {
+		r1 = rf(ctx, url)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SaveCheckpoint provides a mock function with given fields: ctx, checkpoint
+func (_m *Repository) SaveCheckpoint(ctx context.Context, checkpoint models.Checkpoint) error {
+	ret := _m.Called(ctx, checkpoint)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Checkpoint) error); ok {
+		r0 = rf(ctx, checkpoint)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveDelivery provides a mock function with given fields: ctx, delivery
+func (_m *Repository) SaveDelivery(ctx context.Context, delivery models.Delivery) error {
+	ret := _m.Called(ctx, delivery)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Delivery) error); ok {
+		r0 = rf(ctx, delivery)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Search provides a mock function with given fields: ctx, search
+func (_m *Repository) Search(ctx context.Context, search models.Search) ([]models.SearchResult, error) {
+	ret := _m.Called(ctx, search)
+
+	var r0 []models.SearchResult
+	if rf, ok := ret.Get(0).(func(context.Context, models.Search) []models.SearchResult); ok {
+		r0 = rf(ctx, search)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.SearchResult)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Search) error); ok {
+		r1 = rf(ctx, search)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SendWebhook provides a mock function with given fields: ctx, delivery
+func (_m *Repository) SendWebhook(ctx context.Context, delivery models.Delivery) (int, error) {
+	ret := _m.Called(ctx, delivery)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, models.Delivery) int); ok {
+		r0 = rf(ctx, delivery)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Delivery) error); ok {
+		r1 = rf(ctx, delivery)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetDeviceRules provides a mock function with given fields: ctx, url, rules
+func (_m *Repository) SetDeviceRules(ctx context.Context, url models.Url, rules []models.DeviceRule) error {
+	ret := _m.Called(ctx, url, rules)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url, []models.DeviceRule) error); ok {
+		r0 = rf(ctx, url, rules)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetGeoRules provides a mock function with given fields: ctx, url, rules
+func (_m *Repository) SetGeoRules(ctx context.Context, url models.Url, rules []models.GeoRule) error {
+	ret := _m.Called(ctx, url, rules)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url, []models.GeoRule) error); ok {
+		r0 = rf(ctx, url, rules)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetPageMeta provides a mock function with given fields: ctx, url, meta
+func (_m *Repository) SetPageMeta(ctx context.Context, url models.Url, meta models.PageMeta) error {
+	ret := _m.Called(ctx, url, meta)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url, models.PageMeta) error); ok {
+		r0 = rf(ctx, url, meta)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetTags provides a mock function with given fields: ctx, url, tags
+func (_m *Repository) SetTags(ctx context.Context, url models.Url, tags []string) error {
+	ret := _m.Called(ctx, url, tags)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url, []string) error); ok {
+		r0 = rf(ctx, url, tags)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetVariants provides a mock function with given fields: ctx, url, variants
+func (_m *Repository) SetVariants(ctx context.Context, url models.Url, variants []models.Variant) error {
+	ret := _m.Called(ctx, url, variants)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url, []models.Variant) error); ok {
+		r0 = rf(ctx, url, variants)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Update provides a mock function with given fields: ctx, url
+func (_m *Repository) Update(ctx context.Context, url models.Url) error {
+	ret := _m.Called(ctx, url)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, models.Url) error); ok {
+		r0 = rf(ctx, url)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateDomain provides a mock function with given fields: ctx, domain
+func (_m *Repository) UpdateDomain(ctx context.Context, domain models.Domain) (models.Domain, error) {
+	ret := _m.Called(ctx, domain)
+
+	var r0 models.Domain
+	if rf, ok := ret.Get(0).(func(context.Context, models.Domain) models.Domain); ok {
+		r0 = rf(ctx, domain)
+	} else {
+		r0 = ret.Get(0).(models.Domain)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Domain) error); ok {
+		r1 = rf(ctx, domain)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateWebhook provides a mock function with given fields: ctx, webhook
+func (_m *Repository) UpdateWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error) {
+	ret := _m.Called(ctx, webhook)
+
+	var r0 models.Webhook
+	if rf, ok := ret.Get(0).(func(context.Context, models.Webhook) models.Webhook); ok {
+		r0 = rf(ctx, webhook)
+	} else {
+		r0 = ret.Get(0).(models.Webhook)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Webhook) error); ok {
+		r1 = rf(ctx, webhook)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ValidateUrl provides a mock function with given fields: ctx, url
+func (_m *Repository) ValidateUrl(ctx context.Context, url string) bool {
+	ret := _m.Called(ctx, url)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, string) bool); ok {
+		r0 = rf(ctx, url)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
+// VerifyDomain provides a mock function with given fields: ctx, domain
+func (_m *Repository) VerifyDomain(ctx context.Context, domain models.Domain) (models.Domain, error) {
+	ret := _m.Called(ctx, domain)
+
+	var r0 models.Domain
+	if rf, ok := ret.Get(0).(func(context.Context, models.Domain) models.Domain); ok {
+		r0 = rf(ctx, domain)
+	} else {
+		r0 = ret.Get(0).(models.Domain)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, models.Domain) error); ok {
+		r1 = rf(ctx, domain)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
@@ -0,0 +1,37 @@
+package actor
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Anonymous is recorded for changes made without a user header.
+const Anonymous = "anonymous"
+
+// Header names the user making the request. Authentication happens in front of the service.
+const Header = "X-User"
+
+type key struct{}
+
+func With(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, key{}, name)
+}
+
+// From returns who is making the change in ctx.
+func From(ctx context.Context) string {
+	if name, ok := ctx.Value(key{}).(string); ok && name != "" {
+		return name
+	}
+	return Anonymous
+}
+
+// Middleware stores the user from the request header in the request context.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name := strings.TrimSpace(r.Header.Get(Header)); name != "" {
+			r = r.WithContext(With(r.Context(), name))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
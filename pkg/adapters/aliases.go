@@ -0,0 +1,183 @@
+package adapters
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/events"
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/pkg/errors"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const aliasesTable = "aliases"
+
+var aliasColumns = []string{"id", "url_id", "domain", "code", "is_primary", "created_at"}
+
+func (s *Storage) GetAliases(ctx context.Context, url models.Url) ([]models.Alias, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select(aliasColumns...).From(aliasesTable).Where(squirrel.Eq{"url_id": url.Id}).OrderBy("is_primary DESC", "id").ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	aliases := []models.Alias{}
+	err = s.db.Select(&aliases, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return aliases, nil
+}
+
+func (s *Storage) AddAlias(ctx context.Context, alias models.Alias) (models.Alias, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Insert(aliasesTable).Columns("url_id", "domain", "code", "is_primary", "created_at").
+		Values(alias.UrlId, alias.Domain, alias.Code, false, time.Now().UTC()).Suffix("RETURNING " + strings.Join(aliasColumns, ", ")).ToSql()
+	if err != nil {
+		log.Println(err)
+		return models.Alias{}, err
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return models.Alias{}, err
+	}
+	defer tx.Rollback()
+
+	added := models.Alias{}
+	err = tx.Get(&added, query, args...)
+	if err != nil {
+		return models.Alias{}, err
+	}
+
+	if err = s.addUpdateEvent(ctx, tx, models.Url{Id: added.UrlId, Domain: added.Domain}, events.ChangeAliases); err != nil {
+		return models.Alias{}, err
+	}
+
+	return added, tx.Commit()
+}
+
+// RemoveAlias deletes a secondary alias of the link. The primary alias only changes with the small url.
+func (s *Storage) RemoveAlias(ctx context.Context, alias models.Alias) error {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Delete(aliasesTable).
+		Where(squirrel.Eq{"url_id": alias.UrlId, "code": alias.Code, "is_primary": false}).ToSql()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.WithStack(models.NotFoundError())
+	}
+
+	if err = s.addUpdateEvent(ctx, tx, models.Url{Id: alias.UrlId, Domain: alias.Domain}, events.ChangeAliases); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// aliasedBy matches the link any of whose aliases is code on the domain.
+func (s *Storage) aliasedBy(domain, code string) squirrel.Sqlizer {
+	if s.caseInsensitive {
+		return squirrel.Expr("id = (SELECT url_id FROM "+aliasesTable+" WHERE domain = ? AND lower(code) = lower(?))", domain, code)
+	}
+	return squirrel.Expr("id = (SELECT url_id FROM "+aliasesTable+" WHERE domain = ? AND code = ?)", domain, code)
+}
+
+// withoutAliased drops the urls whose small url is already an alias. ON CONFLICT only covers the links
+// table, the primary alias the trigger adds for them would fail the whole insert instead.
+func (s *Storage) withoutAliased(tx *sqlx.Tx, urls []models.Url) ([]models.Url, error) {
+	if len(urls) == 0 {
+		return urls, nil
+	}
+
+	codes := squirrel.Or{}
+	for _, url := range urls {
+		if s.caseInsensitive {
+			codes = append(codes, squirrel.Expr("(domain = ? AND lower(code) = lower(?))", url.Domain, url.SmallUrl))
+		} else {
+			codes = append(codes, squirrel.Eq{"domain": url.Domain, "code": url.SmallUrl})
+		}
+	}
+
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select("domain", "code").From(aliasesTable).Where(codes).ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	taken := []models.Alias{}
+	err = tx.Select(&taken, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	aliased := make(map[string]bool, len(taken))
+	for _, alias := range taken {
+		aliased[s.codeKey(alias.Domain, alias.Code)] = true
+	}
+
+	free := make([]models.Url, 0, len(urls))
+	for _, url := range urls {
+		if !aliased[s.codeKey(url.Domain, url.SmallUrl)] {
+			free = append(free, url)
+		}
+	}
+	return free, nil
+}
+
+func (s *Storage) codeKey(domain, code string) string {
+	if s.caseInsensitive {
+		code = strings.ToLower(code)
+	}
+	return domain + "/" + code
+}
+
+// CaseCollisions finds codes that would resolve to more than one link if case were ignored.
+func (s *Storage) CaseCollisions(ctx context.Context) ([]models.Collision, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select("domain", "lower(code) AS folded", "array_agg(code ORDER BY code) AS codes").
+		From(aliasesTable).GroupBy("domain", "lower(code)").Having("count(*) > 1").OrderBy("domain", "folded").ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	rows := []struct {
+		Domain string         `db:"domain"`
+		Folded string         `db:"folded"`
+		Codes  pq.StringArray `db:"codes"`
+	}{}
+	err = s.db.Select(&rows, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	collisions := make([]models.Collision, 0, len(rows))
+	for _, row := range rows {
+		collisions = append(collisions, models.Collision{Domain: row.Domain, Folded: row.Folded, Codes: row.Codes})
+	}
+	return collisions, nil
+}
@@ -0,0 +1,135 @@
+package adapters_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dailymotion/allure-go"
+	"github.com/kristina71/bitlytest/pkg/adapters"
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	sqlxmock "github.com/zhashkevych/go-sqlxmock"
+)
+
+func TestGetAliasesDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Select aliases of a link, primary first"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+			createdAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id", "url_id", "code", "is_primary", "created_at"}).
+					AddRow(1, 1, "xyz", true, createdAt).
+					AddRow(4, 1, "spring", false, createdAt)
+				mock.ExpectQuery("^SELECT (.+) FROM aliases WHERE url_id = \\$1 ORDER BY is_primary DESC, id").
+					WithArgs(1).WillReturnRows(rows)
+			}))
+
+			allure.Step(allure.Description("Select data and check result"), allure.Action(func() {
+				aliases, err := storage.GetAliases(context.TODO(), models.Url{Id: 1})
+
+				require.NoError(t, err)
+				require.Equal(t, []models.Alias{
+					{Id: 1, UrlId: 1, Code: "xyz", Primary: true, CreatedAt: createdAt},
+					{Id: 4, UrlId: 1, Code: "spring", CreatedAt: createdAt},
+				}, aliases)
+			}))
+		}))
+}
+
+func TestRemoveAliasDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Only secondary aliases are removed"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("^DELETE FROM aliases WHERE code = \\$1 AND is_primary = \\$2 AND url_id = \\$3").
+					WithArgs("spring", false, 1).WillReturnResult(sqlxmock.NewResult(0, 1))
+				mock.ExpectExec("^INSERT INTO link_events").WithArgs("LinkUpdated", 1, sqlxmock.AnyArg(), sqlxmock.AnyArg()).WillReturnResult(sqlxmock.NewResult(1, 1))
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec("^DELETE FROM aliases WHERE code = \\$1 AND is_primary = \\$2 AND url_id = \\$3").
+					WithArgs("xyz", false, 1).WillReturnResult(sqlxmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			}))
+
+			allure.Step(allure.Description("Remove aliases and check result"), allure.Action(func() {
+				err := storage.RemoveAlias(context.TODO(), models.Alias{UrlId: 1, Code: "spring"})
+				require.NoError(t, err)
+
+				err = storage.RemoveAlias(context.TODO(), models.Alias{UrlId: 1, Code: "xyz"})
+				require.ErrorAs(t, err, &models.NotFound{})
+				require.NoError(t, mock.ExpectationsWereMet())
+			}))
+		}))
+}
+
+func TestCaseInsensitiveSelectDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Codes are matched regardless of case when enabled"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db).CaseInsensitive(true)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id", "small_url", "origin_url"}).AddRow(1, "Sale", "http://google.com")
+				mock.ExpectQuery("^SELECT (.+) FROM bitlytest WHERE id = \\(SELECT url_id FROM aliases WHERE domain = \\$1 AND lower\\(code\\) = lower\\(\\$2\\)\\)").
+					WithArgs("", "SALE").WillReturnRows(rows)
+			}))
+
+			allure.Step(allure.Description("Select data and check result"), allure.Action(func() {
+				url, err := storage.GetBySmallUrl(context.TODO(), models.Url{SmallUrl: "SALE"})
+				require.NoError(t, err)
+				require.Equal(t, models.Url{Id: 1, SmallUrl: "Sale", OriginUrl: "http://google.com"}, url)
+			}))
+		}))
+}
+
+func TestCaseCollisionsDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Report codes differing only in case"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"domain", "folded", "codes"}).
+					AddRow("", "sale", "{Sale,sale}").
+					AddRow("go.example.com", "promo", "{PROMO,Promo,promo}")
+				mock.ExpectQuery("^SELECT domain, lower\\(code\\) AS folded, array_agg\\(code ORDER BY code\\) AS codes FROM aliases GROUP BY domain, lower\\(code\\) HAVING count\\(\\*\\) > 1").
+					WillReturnRows(rows)
+			}))
+
+			allure.Step(allure.Description("Select data and check result"), allure.Action(func() {
+				collisions, err := storage.CaseCollisions(context.TODO())
+				require.NoError(t, err)
+				require.Equal(t, []models.Collision{
+					{Domain: "", Folded: "sale", Codes: []string{"Sale", "sale"}},
+					{Domain: "go.example.com", Folded: "promo", Codes: []string{"PROMO", "Promo", "promo"}},
+				}, collisions)
+			}))
+		}))
+}
@@ -0,0 +1,49 @@
+package adapters
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+
+	"github.com/kristina71/bitlytest/pkg/actor"
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/pkg/errors"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// originHash keys the destination index. The migration backfills it with the same sha256 in SQL.
+func originHash(origin string) string {
+	sum := sha256.Sum256([]byte(origin))
+	return hex.EncodeToString(sum[:])
+}
+
+// relatedTables hold settings of a link outside of its row, a link with any of them is not reused.
+var relatedTables = []string{urlTagsTable, geoRulesTable, deviceRulesTable, variantsTable}
+
+// FindByOrigin returns the oldest live link of the current actor on the domain shortening the same destination.
+// Links with tags, targeting rules or variants are skipped.
+func (s *Storage) FindByOrigin(ctx context.Context, url models.Url) (models.Url, error) {
+	builder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select(selectColumns...).From(tableName).
+		Where(squirrel.Eq{"owner": actor.From(ctx), "domain": url.Domain, "origin_hash": originHash(url.OriginUrl), "origin_url": url.OriginUrl, "deleted_at": nil})
+	for _, table := range relatedTables {
+		builder = builder.Where("NOT EXISTS (SELECT 1 FROM " + table + " WHERE " + table + ".url_id = " + tableName + ".id)")
+	}
+
+	query, args, err := builder.OrderBy("id").Limit(1).ToSql()
+	if err != nil {
+		log.Println(err)
+		return models.Url{}, err
+	}
+
+	url = models.Url{}
+	err = s.db.Get(&url, query, args...)
+
+	if err == sql.ErrNoRows {
+		return models.Url{}, errors.WithStack(models.NotFoundError())
+	}
+
+	return url, err
+}
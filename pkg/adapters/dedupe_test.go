@@ -0,0 +1,59 @@
+package adapters_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dailymotion/allure-go"
+	"github.com/kristina71/bitlytest/pkg/actor"
+	"github.com/kristina71/bitlytest/pkg/adapters"
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	sqlxmock "github.com/zhashkevych/go-sqlxmock"
+)
+
+// withoutRelated matches the conditions skipping links with tags, targeting rules or variants.
+const withoutRelated = "AND NOT EXISTS \\(SELECT 1 FROM url_tags WHERE url_tags.url_id = bitlytest.id\\) " +
+	"AND NOT EXISTS \\(SELECT 1 FROM geo_rules WHERE geo_rules.url_id = bitlytest.id\\) " +
+	"AND NOT EXISTS \\(SELECT 1 FROM device_rules WHERE device_rules.url_id = bitlytest.id\\) " +
+	"AND NOT EXISTS \\(SELECT 1 FROM variants WHERE variants.url_id = bitlytest.id\\) "
+
+func TestFindByOriginDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Find a live link of the actor by its destination"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+			ctx := actor.With(context.TODO(), "alice")
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id", "small_url", "origin_url", "owner"}).
+					AddRow(7, "xyz", "http://google.com", "alice")
+				mock.ExpectQuery("^SELECT (.+) FROM bitlytest WHERE deleted_at IS NULL AND domain = \\$1 AND origin_hash = \\$2 AND origin_url = \\$3 AND owner = \\$4 "+withoutRelated+"ORDER BY id LIMIT 1").
+					WithArgs("", "aa2239c17609b21eba034c564af878f3eec8ce83ed0f2768597d2bc2fd4e4da5", "http://google.com", "alice").WillReturnRows(rows)
+				mock.ExpectQuery("^SELECT (.+) FROM bitlytest WHERE deleted_at IS NULL AND domain = \\$1 AND origin_hash = \\$2 AND origin_url = \\$3 AND owner = \\$4 " + withoutRelated + "ORDER BY id LIMIT 1").
+					WillReturnRows(sqlxmock.NewRows([]string{"id"}))
+				// The only link to the destination has tags, so the conditions leave nothing.
+				mock.ExpectQuery("^SELECT (.+) FROM bitlytest WHERE deleted_at IS NULL AND domain = \\$1 AND origin_hash = \\$2 AND origin_url = \\$3 AND owner = \\$4 "+withoutRelated+"ORDER BY id LIMIT 1").
+					WithArgs("", sqlxmock.AnyArg(), "http://google.com/tagged", "alice").WillReturnRows(sqlxmock.NewRows([]string{"id"}))
+			}))
+
+			allure.Step(allure.Description("Select data and check result"), allure.Action(func() {
+				url, err := storage.FindByOrigin(ctx, models.Url{OriginUrl: "http://google.com"})
+				require.NoError(t, err)
+				require.Equal(t, models.Url{Id: 7, SmallUrl: "xyz", OriginUrl: "http://google.com", Owner: "alice"}, url)
+
+				_, err = storage.FindByOrigin(ctx, models.Url{OriginUrl: "http://yandex.ru"})
+				require.ErrorAs(t, err, &models.NotFound{})
+
+				_, err = storage.FindByOrigin(ctx, models.Url{OriginUrl: "http://google.com/tagged"})
+				require.ErrorAs(t, err, &models.NotFound{})
+				require.NoError(t, mock.ExpectationsWereMet())
+			}))
+		}))
+}
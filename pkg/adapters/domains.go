@@ -0,0 +1,93 @@
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/pkg/errors"
+
+	"github.com/Masterminds/squirrel"
+)
+
+const domainsTable = "domains"
+
+var domainColumns = []string{"id", "host", "fallback_url", "verify_token", "verified_at", "created_at"}
+
+func (s *Storage) GetDomains(ctx context.Context) ([]models.Domain, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select(domainColumns...).From(domainsTable).OrderBy("host").ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	domains := []models.Domain{}
+	err = s.db.Select(&domains, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return domains, nil
+}
+
+func (s *Storage) GetDomain(ctx context.Context, domain models.Domain) (models.Domain, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select(domainColumns...).From(domainsTable).Where(squirrel.Eq{"host": domain.Host}).ToSql()
+	if err != nil {
+		log.Println(err)
+		return models.Domain{}, err
+	}
+
+	domain = models.Domain{}
+	err = s.db.Get(&domain, query, args...)
+
+	if err == sql.ErrNoRows {
+		return models.Domain{}, errors.WithStack(models.NotFoundError())
+	}
+
+	return domain, err
+}
+
+func (s *Storage) AddDomain(ctx context.Context, domain models.Domain) (models.Domain, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Insert(domainsTable).Columns("host", "fallback_url", "verify_token", "created_at").
+		Values(domain.Host, domain.FallbackUrl, domain.VerifyToken, time.Now().UTC()).Suffix("RETURNING " + strings.Join(domainColumns, ", ")).ToSql()
+	if err != nil {
+		log.Println(err)
+		return models.Domain{}, err
+	}
+
+	added := models.Domain{}
+	err = s.db.Get(&added, query, args...)
+	return added, err
+}
+
+// UpdateDomain changes the fallback url, the host and its verification stay as they are.
+func (s *Storage) UpdateDomain(ctx context.Context, domain models.Domain) (models.Domain, error) {
+	return s.setDomain(squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Update(domainsTable).
+		Set("fallback_url", domain.FallbackUrl).Where(squirrel.Eq{"host": domain.Host}))
+}
+
+func (s *Storage) VerifyDomain(ctx context.Context, domain models.Domain) (models.Domain, error) {
+	return s.setDomain(squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Update(domainsTable).
+		Set("verified_at", time.Now().UTC()).Where(squirrel.Eq{"host": domain.Host}))
+}
+
+func (s *Storage) setDomain(builder squirrel.UpdateBuilder) (models.Domain, error) {
+	query, args, err := builder.Suffix("RETURNING " + strings.Join(domainColumns, ", ")).ToSql()
+	if err != nil {
+		log.Println(err)
+		return models.Domain{}, err
+	}
+
+	updated := models.Domain{}
+	err = s.db.Get(&updated, query, args...)
+
+	if err == sql.ErrNoRows {
+		return models.Domain{}, errors.WithStack(models.NotFoundError())
+	}
+
+	return updated, err
+}
@@ -0,0 +1,73 @@
+package adapters_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dailymotion/allure-go"
+	"github.com/kristina71/bitlytest/pkg/adapters"
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	sqlxmock "github.com/zhashkevych/go-sqlxmock"
+)
+
+func TestGetDomainDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Select a domain by host"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+			createdAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id", "host", "fallback_url", "verify_token", "verified_at", "created_at"}).
+					AddRow(1, "go.example.com", "https://example.com", "token", nil, createdAt)
+				mock.ExpectQuery("^SELECT (.+) FROM domains WHERE host = \\$1").
+					WithArgs("go.example.com").WillReturnRows(rows)
+				mock.ExpectQuery("^SELECT (.+) FROM domains WHERE host = \\$1").
+					WithArgs("unknown.example.com").WillReturnRows(sqlxmock.NewRows([]string{"id"}))
+			}))
+
+			allure.Step(allure.Description("Select data and check result"), allure.Action(func() {
+				domain, err := storage.GetDomain(context.TODO(), models.Domain{Host: "go.example.com"})
+				require.NoError(t, err)
+				require.Equal(t, models.Domain{Id: 1, Host: "go.example.com", FallbackUrl: "https://example.com", VerifyToken: "token", CreatedAt: createdAt}, domain)
+
+				_, err = storage.GetDomain(context.TODO(), models.Domain{Host: "unknown.example.com"})
+				require.ErrorAs(t, err, &models.NotFound{})
+			}))
+		}))
+}
+
+func TestVerifyDomainDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Mark a domain as verified"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+			verifiedAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id", "host", "verified_at"}).AddRow(1, "go.example.com", verifiedAt)
+				mock.ExpectQuery("^UPDATE domains SET verified_at = \\$1 WHERE host = \\$2 RETURNING").
+					WithArgs(sqlxmock.AnyArg(), "go.example.com").WillReturnRows(rows)
+			}))
+
+			allure.Step(allure.Description("Update data and check result"), allure.Action(func() {
+				domain, err := storage.VerifyDomain(context.TODO(), models.Domain{Host: "go.example.com"})
+				require.NoError(t, err)
+				require.True(t, domain.Verified())
+				require.NoError(t, mock.ExpectationsWereMet())
+			}))
+		}))
+}
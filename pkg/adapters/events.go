@@ -0,0 +1,135 @@
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/actor"
+	"github.com/kristina71/bitlytest/pkg/events"
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	eventsTable      = "link_events"
+	checkpointsTable = "event_checkpoints"
+)
+
+var eventColumns = []string{"id", "txid", "type", "link_id", "payload", "occurred_at"}
+
+// addEvents stores the events in the outbox with the transaction of the change they describe.
+func (s *Storage) addEvents(tx *sqlx.Tx, changes []events.Event) error {
+	if !s.events || len(changes) == 0 {
+		return nil
+	}
+
+	builder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Insert(eventsTable).Columns("type", "link_id", "payload", "occurred_at")
+	for _, change := range changes {
+		event, err := events.Stored(change)
+		if err != nil {
+			return err
+		}
+		builder = builder.Values(event.Type, event.LinkId, []byte(event.Payload), event.OccurredAt)
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	_, err = tx.Exec(query, args...)
+	return err
+}
+
+// announceChange queues webhooks and stores events for a change recorded with action, taking old and
+// updated the way addVersions does. It is called with the transaction of the change.
+func (s *Storage) announceChange(ctx context.Context, tx *sqlx.Tx, action string, old, updated []models.Url) error {
+	if err := queueWebhooks(ctx, tx, models.EventOf(action), webhookPayloads(ctx, action, old, updated)); err != nil {
+		return err
+	}
+	return s.addEvents(tx, events.Of(action, actor.From(ctx), time.Now().UTC(), old, updated))
+}
+
+// addUpdateEvent records a change of settings that are not versioned.
+func (s *Storage) addUpdateEvent(ctx context.Context, tx *sqlx.Tx, url models.Url, change string) error {
+	return s.addEvents(tx, []events.Event{events.LinkUpdated{
+		Meta:   events.Meta{LinkId: url.Id, Domain: url.Domain, Actor: actor.From(ctx), OccurredAt: time.Now().UTC()},
+		Change: change,
+	}})
+}
+
+// GetEvents returns up to limit events after the checkpoint. Only events of transactions older than
+// every running one are returned, a transaction still in flight could otherwise add an event before them.
+func (s *Storage) GetEvents(ctx context.Context, after models.Checkpoint, limit int) ([]models.LinkEvent, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select(eventColumns...).From(eventsTable).
+		Where("(txid, id) > (?, ?)", after.TxId, after.EventId).
+		Where("txid < txid_snapshot_xmin(txid_current_snapshot())").
+		OrderBy("txid", "id").Limit(uint64(limit)).ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	linkEvents := []models.LinkEvent{}
+	err = s.db.Select(&linkEvents, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return linkEvents, nil
+}
+
+// GetCheckpoint returns where the relay called name stopped, the start of the outbox for a new one.
+func (s *Storage) GetCheckpoint(ctx context.Context, name string) (models.Checkpoint, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select("name", "txid", "event_id").From(checkpointsTable).Where(squirrel.Eq{"name": name}).ToSql()
+	if err != nil {
+		log.Println(err)
+		return models.Checkpoint{}, err
+	}
+
+	checkpoint := models.Checkpoint{}
+	err = s.db.Get(&checkpoint, query, args...)
+	if err == sql.ErrNoRows {
+		return models.Checkpoint{Name: name}, nil
+	}
+
+	return checkpoint, err
+}
+
+func (s *Storage) SaveCheckpoint(ctx context.Context, checkpoint models.Checkpoint) error {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Insert(checkpointsTable).Columns("name", "txid", "event_id", "updated_at").
+		Values(checkpoint.Name, checkpoint.TxId, checkpoint.EventId, time.Now().UTC()).
+		Suffix("ON CONFLICT (name) DO UPDATE SET txid = EXCLUDED.txid, event_id = EXCLUDED.event_id, updated_at = EXCLUDED.updated_at").ToSql()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	_, err = s.db.Exec(query, args...)
+	return err
+}
+
+// PruneEvents deletes events that occurred before the given time and that every relay has passed. With no
+// relay checkpoint at all, nothing reads the outbox and every event older than that goes.
+func (s *Storage) PruneEvents(ctx context.Context, before time.Time) (int64, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Delete(eventsTable).Where(squirrel.Lt{"occurred_at": before}).
+		Where("(txid, id) <= ALL (SELECT txid, event_id FROM " + checkpointsTable + ")").ToSql()
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
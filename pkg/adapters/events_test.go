@@ -0,0 +1,128 @@
+package adapters_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dailymotion/allure-go"
+	"github.com/kristina71/bitlytest/pkg/adapters"
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	sqlxmock "github.com/zhashkevych/go-sqlxmock"
+)
+
+func TestGetEventsDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Select the events after a checkpoint"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+			occurredAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id", "txid", "type", "link_id", "payload", "occurred_at"}).
+					AddRow(5, 10, "LinkCreated", 7, []byte(`{"link_id":7}`), occurredAt)
+				mock.ExpectQuery("^SELECT id, txid, type, link_id, payload, occurred_at FROM link_events WHERE \\(txid, id\\) > \\(\\$1, \\$2\\) "+
+					"AND txid < txid_snapshot_xmin\\(txid_current_snapshot\\(\\)\\) ORDER BY txid, id LIMIT 100$").
+					WithArgs(10, 4).WillReturnRows(rows)
+			}))
+
+			allure.Step(allure.Description("Select data and check result"), allure.Action(func() {
+				linkEvents, err := storage.GetEvents(context.TODO(), models.Checkpoint{Name: "warehouse", TxId: 10, EventId: 4}, 100)
+				require.NoError(t, err)
+				require.Equal(t, []models.LinkEvent{{Id: 5, TxId: 10, Type: "LinkCreated", LinkId: 7, Payload: json.RawMessage(`{"link_id":7}`), OccurredAt: occurredAt}}, linkEvents)
+			}))
+		}))
+}
+
+func TestCheckpointDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Read and save a relay checkpoint"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				mock.ExpectQuery("^SELECT name, txid, event_id FROM event_checkpoints WHERE name = \\$1").
+					WithArgs("warehouse").WillReturnRows(sqlxmock.NewRows([]string{"name", "txid", "event_id"}))
+				mock.ExpectExec("^INSERT INTO event_checkpoints \\(name,txid,event_id,updated_at\\) VALUES \\(\\$1,\\$2,\\$3,\\$4\\) ON CONFLICT \\(name\\) DO UPDATE").
+					WithArgs("warehouse", 12, 3, sqlxmock.AnyArg()).WillReturnResult(sqlxmock.NewResult(0, 1))
+			}))
+
+			allure.Step(allure.Description("A new relay starts from the beginning"), allure.Action(func() {
+				checkpoint, err := storage.GetCheckpoint(context.TODO(), "warehouse")
+				require.NoError(t, err)
+				require.Equal(t, models.Checkpoint{Name: "warehouse"}, checkpoint)
+
+				err = storage.SaveCheckpoint(context.TODO(), models.Checkpoint{Name: "warehouse", TxId: 12, EventId: 3})
+				require.NoError(t, err)
+				require.NoError(t, mock.ExpectationsWereMet())
+			}))
+		}))
+}
+
+func TestPruneEventsDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Delete old events every relay has passed"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+			before := time.Date(2026, 10, 12, 12, 0, 0, 0, time.UTC)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				mock.ExpectExec("^DELETE FROM link_events WHERE occurred_at < \\$1 AND \\(txid, id\\) <= ALL \\(SELECT txid, event_id FROM event_checkpoints\\)$").
+					WithArgs(before).WillReturnResult(sqlxmock.NewResult(0, 4))
+			}))
+
+			allure.Step(allure.Description("Prune data and check result"), allure.Action(func() {
+				n, err := storage.PruneEvents(context.TODO(), before)
+				require.NoError(t, err)
+				require.Equal(t, int64(4), n)
+				require.NoError(t, mock.ExpectationsWereMet())
+			}))
+		}))
+}
+
+func TestEventsDisabledDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Store no events when nothing relays them"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db).Events(false)
+			before := time.Now()
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id", "small_url", "origin_url"}).AddRow(1, "abc", "http://google.com")
+				mock.ExpectBegin()
+				mock.ExpectQuery("^DELETE FROM bitlytest WHERE deleted_at < \\$1 RETURNING").
+					WithArgs(before).WillReturnRows(rows)
+				mock.ExpectCommit()
+			}))
+
+			allure.Step(allure.Description("Purge data and check no event was stored"), allure.Action(func() {
+				n, err := storage.Purge(context.TODO(), before)
+				require.NoError(t, err)
+				require.Equal(t, int64(1), n)
+				require.NoError(t, mock.ExpectationsWereMet())
+			}))
+		}))
+}
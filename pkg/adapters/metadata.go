@@ -0,0 +1,49 @@
+package adapters
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// GetUnenriched returns links whose destination was never fetched, oldest first.
+func (s *Storage) GetUnenriched(ctx context.Context, limit int) ([]models.Url, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select(selectColumns...).From(tableName).
+		Where(squirrel.Eq{"enriched_at": nil, "deleted_at": nil}).OrderBy("id").Limit(uint64(limit)).ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	urls := []models.Url{}
+	err = s.db.Select(&urls, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+// SetPageMeta stores fetched page metadata and marks the link as enriched.
+// A title set by the user is kept, the page title only fills an empty one.
+func (s *Storage) SetPageMeta(ctx context.Context, url models.Url, meta models.PageMeta) error {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Update(tableName).
+		Set("title", squirrel.Expr("CASE WHEN title = '' THEN ? ELSE title END", meta.Title)).
+		Set("description", meta.Description).
+		Set("image_url", meta.ImageUrl).
+		Set("favicon_url", meta.FaviconUrl).
+		Set("enriched_at", time.Now().UTC()).
+		Where(squirrel.Eq{"id": url.Id}).ToSql()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	_, err = s.db.Exec(query, args...)
+	return err
+}
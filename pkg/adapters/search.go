@@ -0,0 +1,113 @@
+package adapters
+
+import (
+	"context"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+// Search finds links by small url, origin url, title, notes and tags, best matches first.
+// Postgres uses the search column kept up to date by triggers, other databases fall back to LIKE.
+func (s *Storage) Search(ctx context.Context, search models.Search) ([]models.SearchResult, error) {
+	var builder squirrel.SelectBuilder
+	if s.db.DriverName() == "postgres" {
+		query := tsQuery(search.Query)
+		if query == "" {
+			return []models.SearchResult{}, nil
+		}
+		builder = squirrel.Select(selectColumns...).Column(squirrel.Expr("ts_rank(search, to_tsquery('simple', ?)) AS rank", query)).
+			From(tableName).
+			Where("search @@ to_tsquery('simple', ?)", query).
+			Where(squirrel.Eq{"deleted_at": nil}).
+			OrderBy("rank DESC", "id")
+	} else {
+		builder = likeSearch(search.Query)
+	}
+
+	query, args, err := builder.PlaceholderFormat(s.placeholders()).Limit(uint64(search.Limit)).ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	results := []models.SearchResult{}
+	err = s.db.Select(&results, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	urls := make([]models.Url, len(results))
+	for i := range results {
+		urls[i] = results[i].Url
+	}
+	if err = s.loadTags(urls); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	for i := range results {
+		results[i].Url = urls[i]
+	}
+
+	return results, nil
+}
+
+// tsQuery turns free text into a prefix query matching every word, so "spr sal" finds "spring sale".
+func tsQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// placeholders is the bind style of the database driver.
+func (s *Storage) placeholders() squirrel.PlaceholderFormat {
+	switch sqlx.BindType(s.db.DriverName()) {
+	case sqlx.DOLLAR:
+		return squirrel.Dollar
+	case sqlx.AT:
+		return squirrel.AtP
+	case sqlx.NAMED:
+		return squirrel.Colon
+	default:
+		return squirrel.Question
+	}
+}
+
+// likeEscape is the escape character of LIKE patterns. Not every database has a default one, and a
+// backslash would itself need escaping in MySQL string literals.
+const likeEscape = "!"
+
+// likeSearch ranks a match in the short code above one in the title, tags, origin url and notes.
+func likeSearch(text string) squirrel.SelectBuilder {
+	pattern := "%" + escapeLike(strings.ToLower(strings.TrimSpace(text))) + "%"
+	like := " LIKE ? ESCAPE '" + likeEscape + "'"
+	tagMatch := "id IN (SELECT url_tags.url_id FROM url_tags JOIN tags ON tags.id = url_tags.tag_id WHERE tags.name" + like + ")"
+
+	rank := squirrel.Expr("CASE WHEN lower(small_url)"+like+" THEN 1.0 WHEN lower(title)"+like+" THEN 0.8 WHEN "+tagMatch+" THEN 0.6 WHEN lower(origin_url)"+like+" THEN 0.4 ELSE 0.2 END AS rank",
+		pattern, pattern, pattern, pattern)
+
+	return squirrel.Select(selectColumns...).Column(rank).From(tableName).
+		Where(squirrel.Or{
+			squirrel.Expr("lower(small_url)"+like, pattern),
+			squirrel.Expr("lower(origin_url)"+like, pattern),
+			squirrel.Expr("lower(title)"+like, pattern),
+			squirrel.Expr("lower(notes)"+like, pattern),
+			squirrel.Expr(tagMatch, pattern),
+		}).
+		Where(squirrel.Eq{"deleted_at": nil}).
+		OrderBy("rank DESC", "id")
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(likeEscape, likeEscape+likeEscape, `%`, likeEscape+`%`, `_`, likeEscape+`_`).Replace(value)
+}
@@ -0,0 +1,90 @@
+package adapters_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dailymotion/allure-go"
+	"github.com/jmoiron/sqlx"
+	"github.com/kristina71/bitlytest/pkg/adapters"
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	sqlxmock "github.com/zhashkevych/go-sqlxmock"
+)
+
+func TestSearchPostgresDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Full-text search on postgres"),
+		allure.Action(func() {
+			mockDb, mock, err := sqlxmock.New()
+			require.NoError(t, err)
+
+			db := sqlx.NewDb(mockDb, "postgres")
+			defer db.Close()
+
+			storage := adapters.New(db)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id", "small_url", "origin_url", "rank"}).
+					AddRow(2, "sale", "http://example.com/spring", 0.6).
+					AddRow(1, "xyz", "http://google.com", 0.1)
+				mock.ExpectQuery("^SELECT (.+), ts_rank\\(search, to_tsquery\\('simple', \\$1\\)\\) AS rank FROM bitlytest WHERE search @@ to_tsquery\\('simple', \\$2\\) AND deleted_at IS NULL ORDER BY rank DESC, id LIMIT 10").
+					WithArgs("spring:* & sale:*", "spring:* & sale:*").WillReturnRows(rows)
+
+				tags := sqlxmock.NewRows([]string{"url_id", "name"}).AddRow(2, "print")
+				mock.ExpectQuery("^SELECT url_tags.url_id, tags.name FROM url_tags").
+					WithArgs(2, 1).WillReturnRows(tags)
+			}))
+
+			allure.Step(allure.Description("Search and check ranked results"), allure.Action(func() {
+				results, err := storage.Search(context.TODO(), models.Search{Query: "Spring, SALE!", Limit: 10})
+
+				require.NoError(t, err)
+				require.Equal(t, []models.SearchResult{
+					{Url: models.Url{Id: 2, SmallUrl: "sale", OriginUrl: "http://example.com/spring", Tags: []string{"print"}}, Rank: 0.6},
+					{Url: models.Url{Id: 1, SmallUrl: "xyz", OriginUrl: "http://google.com", Tags: []string{}}, Rank: 0.1},
+				}, results)
+			}))
+
+			allure.Step(allure.Description("Query without words matches nothing"), allure.Action(func() {
+				results, err := storage.Search(context.TODO(), models.Search{Query: "!!!", Limit: 10})
+
+				require.NoError(t, err)
+				require.Empty(t, results)
+				require.NoError(t, mock.ExpectationsWereMet())
+			}))
+		}))
+}
+
+func TestSearchLikeDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("LIKE search on other databases"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id", "small_url", "origin_url", "rank"}).
+					AddRow(3, "a_b", "http://google.com", 1.0)
+				mock.ExpectQuery("^SELECT (.+) AS rank FROM bitlytest WHERE \\(lower\\(small_url\\) LIKE \\? ESCAPE '!' OR (.+)\\) AND deleted_at IS NULL ORDER BY rank DESC, id LIMIT 5").
+					WithArgs("%a!_b!!%", "%a!_b!!%", "%a!_b!!%", "%a!_b!!%", "%a!_b!!%", "%a!_b!!%", "%a!_b!!%", "%a!_b!!%", "%a!_b!!%").WillReturnRows(rows)
+
+				mock.ExpectQuery("^SELECT url_tags.url_id, tags.name FROM url_tags").
+					WithArgs(3).WillReturnRows(sqlxmock.NewRows([]string{"url_id", "name"}))
+			}))
+
+			allure.Step(allure.Description("Search and check result"), allure.Action(func() {
+				results, err := storage.Search(context.TODO(), models.Search{Query: " A_B! ", Limit: 5})
+
+				require.NoError(t, err)
+				require.Equal(t, []models.SearchResult{
+					{Url: models.Url{Id: 3, SmallUrl: "a_b", OriginUrl: "http://google.com", Tags: []string{}}, Rank: 1.0},
+				}, results)
+			}))
+		}))
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/kristina71/bitlytest/pkg/actor"
 	"github.com/kristina71/bitlytest/pkg/config"
+	"github.com/kristina71/bitlytest/pkg/events"
 	"github.com/kristina71/bitlytest/pkg/models"
 	"github.com/pkg/errors"
 
@@ -15,17 +18,44 @@ import (
 )
 
 type Storage struct {
-	db *sqlx.DB
+	db              *sqlx.DB
+	caseInsensitive bool
+	events          bool
+	clicks          clickSubscribers
 }
 
 func New(db *sqlx.DB) *Storage {
-	return &Storage{db: db}
+	return &Storage{db: db, events: true}
+}
+
+// CaseInsensitive makes short codes match regardless of case.
+func (s *Storage) CaseInsensitive(enabled bool) *Storage {
+	s.caseInsensitive = enabled
+	return s
+}
+
+// Events stores link changes in the outbox for the relay. Without a relay reading them they would only pile up.
+func (s *Storage) Events(enabled bool) *Storage {
+	s.events = enabled
+	return s
 }
 
 const (
 	tableName = "bitlytest"
+	// exportBatch is how many exported links get their tags loaded at once.
+	exportBatch = 500
 )
 
+var (
+	selectColumns = []string{"id", "domain", "small_url", "origin_url", "owner", "created_at", "updated_at", "always_preview", "redirect_type", "password_hash", "active_from", "active_until", "query_policy", "utm_source", "utm_medium", "utm_campaign", "title", "notes", "description", "image_url", "favicon_url", "enriched_at", "deleted_at"}
+	insertColumns = []string{"domain", "small_url", "origin_url", "origin_hash", "owner", "created_at", "updated_at", "always_preview", "redirect_type", "password_hash", "active_from", "active_until", "query_policy", "utm_source", "utm_medium", "utm_campaign", "title", "notes", "description", "image_url", "favicon_url"}
+)
+
+// insertValues must follow the order of insertColumns.
+func insertValues(url models.Url, owner string) []interface{} {
+	return []interface{}{url.Domain, url.SmallUrl, url.OriginUrl, originHash(url.OriginUrl), owner, url.CreatedAt, url.UpdateAt, url.AlwaysPreview, url.RedirectType, url.PasswordHash, url.ActiveFrom, url.ActiveUntil, url.QueryPolicy, url.UtmSource, url.UtmMedium, url.UtmCampaign, url.Title, url.Notes, url.Description, url.ImageUrl, url.FaviconUrl}
+}
+
 func (s *Storage) Insert(ctx context.Context, url models.Url) (uint16, error) {
 	if url.CreatedAt.IsZero() {
 		url.CreatedAt = time.Now().UTC()
@@ -34,47 +64,354 @@ func (s *Storage) Insert(ctx context.Context, url models.Url) (uint16, error) {
 		url.UpdateAt = time.Now().UTC()
 	}
 
-	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Insert(tableName).Columns("small_url", "origin_url", "created_at", "updated_at").Values(url.SmallUrl, url.OriginUrl, url.CreatedAt, url.UpdateAt).Suffix("RETURNING \"id\"").ToSql()
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Insert(tableName).Columns(insertColumns...).Values(insertValues(url, actor.From(ctx))...).Suffix("RETURNING \"id\"").ToSql()
 	if err != nil {
 		log.Println(err)
 		return 0, err
 	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	var id uint16
-	err = s.db.QueryRow(query, args...).Scan(&id)
+	err = tx.QueryRow(query, args...).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	url.Id = id
+	err = addVersions(ctx, tx, models.ActionCreate, nil, []models.Url{url})
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.announceChange(ctx, tx, models.ActionCreate, nil, []models.Url{url})
+	if err != nil {
+		return 0, err
+	}
 
-	return id, err
+	return id, tx.Commit()
 }
 
-func (s *Storage) Update(ctx context.Context, url models.Url) error {
-	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Update(tableName).Set("small_url", url.SmallUrl).Set("origin_url", url.OriginUrl).Where(squirrel.Eq{"id": url.Id}).ToSql()
+// InsertBatch inserts the links whose small url is free and returns them. Codes taken by a link or
+// by an alias of one are skipped.
+func (s *Storage) InsertBatch(ctx context.Context, urls []models.Url) ([]models.Url, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	urls, err = s.withoutAliased(tx, urls)
+	if err != nil {
+		return nil, err
+	}
+	if len(urls) == 0 {
+		return []models.Url{}, nil
+	}
+
+	builder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Insert(tableName).Columns(insertColumns...)
+	now := time.Now().UTC()
+	for _, url := range urls {
+		if url.CreatedAt.IsZero() {
+			url.CreatedAt = now
+		}
+		if url.UpdateAt.IsZero() {
+			url.UpdateAt = now
+		}
+		builder = builder.Values(insertValues(url, actor.From(ctx))...)
+	}
+
+	query, args, err := builder.Suffix("ON CONFLICT DO NOTHING RETURNING " + strings.Join(selectColumns, ", ")).ToSql()
 	if err != nil {
 		log.Println(err)
-		return err
+		return nil, err
+	}
+
+	inserted := []models.Url{}
+	err = tx.Select(&inserted, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	err = addVersions(ctx, tx, models.ActionCreate, nil, inserted)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.announceChange(ctx, tx, models.ActionCreate, nil, inserted)
+	if err != nil {
+		return nil, err
 	}
-	_, err = s.db.Exec(query, args...)
+
+	return inserted, tx.Commit()
+}
+
+func (s *Storage) Update(ctx context.Context, url models.Url) error {
+	_, err := s.update(ctx, url, models.ActionUpdate)
 	return err
 }
 
-func (s *Storage) Delete(ctx context.Context, url models.Url) error {
-	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Delete(tableName).Where(squirrel.Eq{"id": url.Id}).ToSql()
+type setting struct {
+	column string
+	value  interface{}
+}
+
+// optionalSettings returns the optional settings the update sets, those it omitted keep their stored values.
+func optionalSettings(url models.Url) []setting {
+	omitted := map[string]bool{}
+	for _, name := range url.Omitted {
+		omitted[name] = true
+	}
+
+	settings := []setting{}
+	for _, candidate := range []setting{
+		{models.SettingAlwaysPreview, url.AlwaysPreview},
+		{models.SettingActiveFrom, url.ActiveFrom},
+		{models.SettingActiveUntil, url.ActiveUntil},
+		{models.SettingUtmSource, url.UtmSource},
+		{models.SettingUtmMedium, url.UtmMedium},
+		{models.SettingUtmCampaign, url.UtmCampaign},
+		{models.SettingTitle, url.Title},
+		{models.SettingNotes, url.Notes},
+	} {
+		if !omitted[candidate.column] {
+			settings = append(settings, candidate)
+		}
+	}
+	return settings
+}
+
+// update changes the link and records the change in the same transaction.
+func (s *Storage) update(ctx context.Context, url models.Url, action string) (models.Url, error) {
+	builder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Update(tableName).Set("small_url", url.SmallUrl).Set("origin_url", url.OriginUrl).Set("origin_hash", originHash(url.OriginUrl))
+	// The page metadata described the old destination, the enricher fetches the new one. The expressions
+	// see the row before the update.
+	for _, column := range []string{"description", "image_url", "favicon_url"} {
+		builder = builder.Set(column, squirrel.Expr("CASE WHEN origin_url = ? THEN "+column+" ELSE '' END", url.OriginUrl))
+	}
+	builder = builder.Set("enriched_at", squirrel.Expr("CASE WHEN origin_url = ? THEN enriched_at END", url.OriginUrl))
+	for _, setting := range optionalSettings(url) {
+		builder = builder.Set(setting.column, setting.value)
+	}
+	builder = builder.Set("updated_at", time.Now().UTC())
+	if url.RedirectType != "" {
+		builder = builder.Set("redirect_type", url.RedirectType)
+	}
+	if url.QueryPolicy != "" {
+		builder = builder.Set("query_policy", url.QueryPolicy)
+	}
+	if url.PasswordHash != "" || url.ClearPassword {
+		builder = builder.Set("password_hash", url.PasswordHash)
+	}
+
+	query, args, err := builder.Where(squirrel.Eq{"id": url.Id}).Suffix("RETURNING " + strings.Join(selectColumns, ", ")).ToSql()
+	if err != nil {
+		log.Println(err)
+		return models.Url{}, err
+	}
+
+	selectQuery, selectArgs, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select(selectColumns...).From(tableName).Where(squirrel.Eq{"id": url.Id, "deleted_at": nil}).Suffix("FOR UPDATE").ToSql()
 	if err != nil {
 		log.Println(err)
+		return models.Url{}, err
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return models.Url{}, err
+	}
+	defer tx.Rollback()
+
+	old := models.Url{}
+	err = tx.Get(&old, selectQuery, selectArgs...)
+	if err == sql.ErrNoRows {
+		return models.Url{}, errors.WithStack(models.NotFoundError())
+	}
+	if err != nil {
+		return models.Url{}, err
+	}
+
+	updated := models.Url{}
+	err = tx.Get(&updated, query, args...)
+	if err != nil {
+		return models.Url{}, err
+	}
+
+	err = addVersions(ctx, tx, action, []models.Url{old}, []models.Url{updated})
+	if err != nil {
+		return models.Url{}, err
+	}
+
+	err = s.announceChange(ctx, tx, action, []models.Url{old}, []models.Url{updated})
+	if err != nil {
+		return models.Url{}, err
+	}
+
+	return updated, tx.Commit()
+}
+
+// Delete moves the link to the trash. It keeps its small url until it is purged.
+func (s *Storage) Delete(ctx context.Context, url models.Url) error {
+	deleted, err := s.DeleteBatch(ctx, []uint16{url.Id})
+	if err != nil {
 		return err
 	}
-	_, err = s.db.Exec(query, args...)
-	return err
+	if len(deleted) == 0 {
+		return errors.WithStack(models.NotFoundError())
+	}
+	return nil
+}
+
+// DeleteBatch moves the links to the trash and returns the ids of those that were live.
+func (s *Storage) DeleteBatch(ctx context.Context, ids []uint16) ([]uint16, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Update(tableName).Set("deleted_at", time.Now().UTC()).
+		Where(squirrel.Eq{"id": ids, "deleted_at": nil}).Suffix("RETURNING " + strings.Join(selectColumns, ", ")).ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	urls := []models.Url{}
+	err = tx.Select(&urls, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	err = addVersions(ctx, tx, models.ActionDelete, urls, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.announceChange(ctx, tx, models.ActionDelete, urls, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make([]uint16, 0, len(urls))
+	for _, url := range urls {
+		deleted = append(deleted, url.Id)
+	}
+	return deleted, tx.Commit()
+}
+
+// Restore takes the link out of the trash.
+func (s *Storage) Restore(ctx context.Context, url models.Url) (models.Url, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Update(tableName).Set("deleted_at", nil).
+		Where(squirrel.And{squirrel.Eq{"id": url.Id}, squirrel.NotEq{"deleted_at": nil}}).Suffix("RETURNING " + strings.Join(selectColumns, ", ")).ToSql()
+	if err != nil {
+		log.Println(err)
+		return models.Url{}, err
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return models.Url{}, err
+	}
+	defer tx.Rollback()
+
+	restored := models.Url{}
+	err = tx.Get(&restored, query, args...)
+	if err == sql.ErrNoRows {
+		return models.Url{}, errors.WithStack(models.NotFoundError())
+	}
+	if err != nil {
+		return models.Url{}, err
+	}
+
+	err = addVersions(ctx, tx, models.ActionRestore, nil, []models.Url{restored})
+	if err != nil {
+		return models.Url{}, err
+	}
+
+	err = s.announceChange(ctx, tx, models.ActionRestore, nil, []models.Url{restored})
+	if err != nil {
+		return models.Url{}, err
+	}
+
+	return restored, tx.Commit()
 }
 
-func (s *Storage) Get(ctx context.Context) ([]models.Url, error) {
-	query, _, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select("id", "small_url", "origin_url").From(tableName).ToSql()
+// Purge removes links deleted before the given time for good, releasing their small urls. Their
+// history goes with them, a LinkDeleted event marked purged is stored in the same transaction.
+func (s *Storage) Purge(ctx context.Context, before time.Time) (int64, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Delete(tableName).Where(squirrel.Lt{"deleted_at": before}).
+		Suffix("RETURNING " + strings.Join(selectColumns, ", ")).ToSql()
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	purged := []models.Url{}
+	err = tx.Select(&purged, query, args...)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+
+	err = s.addEvents(tx, events.Purged(actor.From(ctx), time.Now().UTC(), purged))
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(purged)), tx.Commit()
+}
+
+func (s *Storage) Get(ctx context.Context, filter models.UrlFilter) ([]models.Url, error) {
+	builder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select(selectColumns...).From(tableName)
+	if filter.Deleted {
+		builder = builder.Where(squirrel.NotEq{"deleted_at": nil}).OrderBy("deleted_at DESC")
+	} else {
+		builder = builder.Where(squirrel.Eq{"deleted_at": nil})
+	}
+
+	now := time.Now().UTC()
+	switch filter.Status {
+	case models.StatusScheduled:
+		builder = builder.Where(squirrel.Gt{"active_from": now})
+	case models.StatusActive:
+		builder = builder.Where(squirrel.Or{squirrel.Eq{"active_from": nil}, squirrel.LtOrEq{"active_from": now}}).
+			Where(squirrel.Or{squirrel.Eq{"active_until": nil}, squirrel.Gt{"active_until": now}})
+	case models.StatusEnded:
+		builder = builder.Where(squirrel.LtOrEq{"active_until": now})
+	}
+
+	if filter.Tag != "" {
+		builder = builder.Where(squirrel.Expr("id IN (SELECT url_tags.url_id FROM url_tags JOIN tags ON tags.id = url_tags.tag_id WHERE tags.name = ?)", filter.Tag))
+	}
+
+	query, args, err := builder.ToSql()
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
 	urls := []models.Url{}
-	err = s.db.Select(&urls, query)
+	err = s.db.Select(&urls, query, args...)
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
 
+	err = s.loadTags(urls)
 	if err != nil {
 		log.Println(err)
 		return nil, err
@@ -83,8 +420,73 @@ func (s *Storage) Get(ctx context.Context) ([]models.Url, error) {
 	return urls, nil
 }
 
+func (s *Storage) Export(ctx context.Context, fn func(url models.Url) error) error {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select(selectColumns...).From(tableName).Where(squirrel.Eq{"deleted_at": nil}).OrderBy("id").ToSql()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	rows, err := s.db.Queryx(query, args...)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer rows.Close()
+
+	// Tags are loaded for a batch of links at a time, the export itself is streamed.
+	batch := make([]models.Url, 0, exportBatch)
+	flush := func() error {
+		if err := s.loadTags(batch); err != nil {
+			return err
+		}
+		for _, url := range batch {
+			if err := fn(url); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for rows.Next() {
+		url := models.Url{}
+		if err = rows.StructScan(&url); err != nil {
+			return err
+		}
+		batch = append(batch, url)
+		if len(batch) == exportBatch {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
+
 func (s *Storage) GetBySmallUrl(ctx context.Context, url models.Url) (models.Url, error) {
-	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select("id", "small_url", "origin_url").From(tableName).Where(squirrel.Eq{"small_url": url.SmallUrl}).ToSql()
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select(selectColumns...).From(tableName).Where(s.aliasedBy(url.Domain, url.SmallUrl)).ToSql()
+	if err != nil {
+		log.Println(err)
+		return models.Url{}, err
+	}
+
+	url = models.Url{}
+	err = s.db.Get(&url, query, args...)
+
+	if err == sql.ErrNoRows {
+		return models.Url{}, errors.WithStack(models.NotFoundError())
+	}
+
+	return url, err
+}
+
+func (s *Storage) GetById(ctx context.Context, url models.Url) (models.Url, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select(selectColumns...).From(tableName).Where(squirrel.Eq{"id": url.Id}).ToSql()
 	if err != nil {
 		log.Println(err)
 		return models.Url{}, err
@@ -2,6 +2,7 @@ package adapters_test
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -36,14 +37,22 @@ func TestInsertDB(t *testing.T) {
 				{
 					name: "OK",
 					url: models.Url{
-						SmallUrl:  "xyz",
-						OriginUrl: "dsfsdfds",
-						CreatedAt: time.Now(),
-						UpdateAt:  time.Now(),
+						SmallUrl:    "xyz",
+						OriginUrl:   "dsfsdfds",
+						CreatedAt:   time.Now(),
+						UpdateAt:    time.Now(),
+						Description: "Search the web",
+						ImageUrl:    "http://google.com/logo.png",
+						FaviconUrl:  "http://google.com/favicon.ico",
 					},
 					mock: func(tc *testCase) {
 						rows := sqlxmock.NewRows([]string{"id"}).AddRow(1)
-						mock.ExpectQuery("INSERT INTO bitlytest").WithArgs(tc.url.SmallUrl, tc.url.OriginUrl, tc.url.CreatedAt, tc.url.UpdateAt).WillReturnRows(rows)
+						mock.ExpectBegin()
+						mock.ExpectQuery("INSERT INTO bitlytest").WithArgs(tc.url.Domain, tc.url.SmallUrl, tc.url.OriginUrl, sqlxmock.AnyArg(), "anonymous", tc.url.CreatedAt, tc.url.UpdateAt, tc.url.AlwaysPreview, tc.url.RedirectType, tc.url.PasswordHash, tc.url.ActiveFrom, tc.url.ActiveUntil, tc.url.QueryPolicy, tc.url.UtmSource, tc.url.UtmMedium, tc.url.UtmCampaign, tc.url.Title, tc.url.Notes, tc.url.Description, tc.url.ImageUrl, tc.url.FaviconUrl).WillReturnRows(rows)
+						mock.ExpectExec("^INSERT INTO link_versions").WithArgs(1, "anonymous", models.ActionCreate, sqlxmock.AnyArg(), nil, sqlxmock.AnyArg()).WillReturnResult(sqlxmock.NewResult(1, 1))
+						mock.ExpectExec("^INSERT INTO webhook_deliveries").WillReturnResult(sqlxmock.NewResult(0, 0))
+						mock.ExpectExec("^INSERT INTO link_events").WillReturnResult(sqlxmock.NewResult(1, 1))
+						mock.ExpectCommit()
 					},
 					id:      1,
 					wantErr: false,
@@ -58,7 +67,12 @@ func TestInsertDB(t *testing.T) {
 					},
 					mock: func(tc *testCase) {
 						rows := sqlxmock.NewRows([]string{"id"}).AddRow(1)
-						mock.ExpectQuery("INSERT INTO bitlytest").WithArgs(tc.url.SmallUrl, tc.url.OriginUrl, tc.url.CreatedAt, tc.url.UpdateAt).WillReturnRows(rows)
+						mock.ExpectBegin()
+						mock.ExpectQuery("INSERT INTO bitlytest").WithArgs(tc.url.Domain, tc.url.SmallUrl, tc.url.OriginUrl, sqlxmock.AnyArg(), "anonymous", tc.url.CreatedAt, tc.url.UpdateAt, tc.url.AlwaysPreview, tc.url.RedirectType, tc.url.PasswordHash, tc.url.ActiveFrom, tc.url.ActiveUntil, tc.url.QueryPolicy, tc.url.UtmSource, tc.url.UtmMedium, tc.url.UtmCampaign, tc.url.Title, tc.url.Notes, tc.url.Description, tc.url.ImageUrl, tc.url.FaviconUrl).WillReturnRows(rows)
+						mock.ExpectExec("^INSERT INTO link_versions").WithArgs(1, "anonymous", models.ActionCreate, sqlxmock.AnyArg(), nil, sqlxmock.AnyArg()).WillReturnResult(sqlxmock.NewResult(1, 1))
+						mock.ExpectExec("^INSERT INTO webhook_deliveries").WillReturnResult(sqlxmock.NewResult(0, 0))
+						mock.ExpectExec("^INSERT INTO link_events").WillReturnResult(sqlxmock.NewResult(1, 1))
+						mock.ExpectCommit()
 					},
 					wantErr: true,
 				},
@@ -105,8 +119,8 @@ func TestSelectDB(t *testing.T) {
 					mock: func(tc *testCase) {
 						rows := sqlxmock.NewRows([]string{"id", "small_url", "origin_url", "created_at", "updated_at"}).
 							AddRow(tc.url.Id, tc.url.SmallUrl, tc.url.OriginUrl, tc.url.CreatedAt, tc.url.UpdateAt)
-						mock.ExpectQuery("^SELECT (.+) FROM bitlytest WHERE small_url = \\$1").
-							WithArgs(tc.url.SmallUrl).
+						mock.ExpectQuery("^SELECT (.+) FROM bitlytest WHERE id = \\(SELECT url_id FROM aliases WHERE domain = \\$1 AND code = \\$2\\)").
+							WithArgs(tc.url.Domain, tc.url.SmallUrl).
 							WillReturnRows(rows)
 					},
 					id:      1,
@@ -147,8 +161,15 @@ func TestDeleteDB(t *testing.T) {
 						Id: 1,
 					},
 					mock: func(tc *testCase) {
-						mock.ExpectExec("^DELETE FROM bitlytest WHERE id = \\$1").
-							WithArgs(tc.url.Id).WillReturnResult(sqlxmock.NewResult(1, 1))
+						mock.ExpectBegin()
+						mock.ExpectQuery("^UPDATE bitlytest SET deleted_at = \\$1 WHERE deleted_at IS NULL AND id IN \\(\\$2\\) RETURNING").
+							WithArgs(sqlxmock.AnyArg(), tc.url.Id).WillReturnRows(sqlxmock.NewRows([]string{"id", "small_url"}).AddRow(tc.url.Id, "xyz"))
+						mock.ExpectExec("^INSERT INTO link_versions").
+							WithArgs(tc.url.Id, "anonymous", models.ActionDelete, sqlxmock.AnyArg(), sqlxmock.AnyArg(), nil).
+							WillReturnResult(sqlxmock.NewResult(1, 1))
+						mock.ExpectExec("^INSERT INTO webhook_deliveries").WillReturnResult(sqlxmock.NewResult(0, 0))
+						mock.ExpectExec("^INSERT INTO link_events").WillReturnResult(sqlxmock.NewResult(1, 1))
+						mock.ExpectCommit()
 
 					},
 					id:      1,
@@ -170,6 +191,15 @@ func TestDeleteDB(t *testing.T) {
 		}))
 }
 
+// resetMetadata matches the settings clearing the page metadata of a changed destination, with their
+// placeholders numbered from first.
+func resetMetadata(first int) string {
+	return fmt.Sprintf("description = CASE WHEN origin_url = \\$%d THEN description ELSE '' END, "+
+		"image_url = CASE WHEN origin_url = \\$%d THEN image_url ELSE '' END, "+
+		"favicon_url = CASE WHEN origin_url = \\$%d THEN favicon_url ELSE '' END, "+
+		"enriched_at = CASE WHEN origin_url = \\$%d THEN enriched_at END", first, first+1, first+2, first+3)
+}
+
 func TestUpdateDB(t *testing.T) {
 	allure.Test(t,
 		allure.Description("Delete data in DB"),
@@ -190,11 +220,36 @@ func TestUpdateDB(t *testing.T) {
 						OriginUrl: "dsfsdfds",
 					},
 					mock: func(tc *testCase) {
-						mock.ExpectExec("^UPDATE bitlytest SET small_url = \\$1, origin_url = \\$2 WHERE id = \\$3").
+						mock.ExpectBegin()
+						mock.ExpectQuery("^SELECT (.+) FROM bitlytest WHERE deleted_at IS NULL AND id = \\$1 FOR UPDATE").
+							WithArgs(tc.url.Id).
+							WillReturnRows(sqlxmock.NewRows([]string{"id", "small_url", "origin_url"}).AddRow(tc.url.Id, "old", "http://old.com"))
+						mock.ExpectQuery("^UPDATE bitlytest SET small_url = \\$1, origin_url = \\$2, origin_hash = \\$3, "+resetMetadata(4)+", always_preview = \\$8, active_from = \\$9, active_until = \\$10, utm_source = \\$11, utm_medium = \\$12, utm_campaign = \\$13, title = \\$14, notes = \\$15, updated_at = \\$16 WHERE id = \\$17 RETURNING").
 							WithArgs(tc.url.SmallUrl,
 								tc.url.OriginUrl,
+								sqlxmock.AnyArg(),
+								tc.url.OriginUrl,
+								tc.url.OriginUrl,
+								tc.url.OriginUrl,
+								tc.url.OriginUrl,
+								tc.url.AlwaysPreview,
+								tc.url.ActiveFrom,
+								tc.url.ActiveUntil,
+								tc.url.UtmSource,
+								tc.url.UtmMedium,
+								tc.url.UtmCampaign,
+								tc.url.Title,
+								tc.url.Notes,
+								sqlxmock.AnyArg(),
 								tc.url.Id,
-							).WillReturnResult(sqlxmock.NewResult(1, 1))
+							).
+							WillReturnRows(sqlxmock.NewRows([]string{"id", "small_url", "origin_url"}).AddRow(tc.url.Id, tc.url.SmallUrl, tc.url.OriginUrl))
+						mock.ExpectExec("^INSERT INTO link_versions").
+							WithArgs(tc.url.Id, "anonymous", models.ActionUpdate, sqlxmock.AnyArg(), sqlxmock.AnyArg(), sqlxmock.AnyArg()).
+							WillReturnResult(sqlxmock.NewResult(1, 1))
+						mock.ExpectExec("^INSERT INTO webhook_deliveries").WillReturnResult(sqlxmock.NewResult(0, 0))
+						mock.ExpectExec("^INSERT INTO link_events").WillReturnResult(sqlxmock.NewResult(1, 1))
+						mock.ExpectCommit()
 					},
 					id:      1,
 					wantErr: false,
@@ -207,11 +262,63 @@ func TestUpdateDB(t *testing.T) {
 						OriginUrl: "",
 					},
 					mock: func(tc *testCase) {
-						mock.ExpectExec("^UPDATE bitlytest SET small_url = \\$1, origin_url = \\$2 WHERE id = \\$3").
+						mock.ExpectBegin()
+						mock.ExpectQuery("^SELECT (.+) FROM bitlytest WHERE deleted_at IS NULL AND id = \\$1 FOR UPDATE").
+							WithArgs(tc.url.Id).
+							WillReturnRows(sqlxmock.NewRows([]string{"id", "small_url", "origin_url"}).AddRow(tc.url.Id, "old", "http://old.com"))
+						mock.ExpectQuery("^UPDATE bitlytest SET small_url = \\$1, origin_url = \\$2, origin_hash = \\$3, "+resetMetadata(4)+", always_preview = \\$8, active_from = \\$9, active_until = \\$10, utm_source = \\$11, utm_medium = \\$12, utm_campaign = \\$13, title = \\$14, notes = \\$15, updated_at = \\$16 WHERE id = \\$17 RETURNING").
 							WithArgs(tc.url.SmallUrl,
 								tc.url.OriginUrl,
+								sqlxmock.AnyArg(),
+								tc.url.OriginUrl,
+								tc.url.OriginUrl,
+								tc.url.OriginUrl,
+								tc.url.OriginUrl,
+								tc.url.AlwaysPreview,
+								tc.url.ActiveFrom,
+								tc.url.ActiveUntil,
+								tc.url.UtmSource,
+								tc.url.UtmMedium,
+								tc.url.UtmCampaign,
+								tc.url.Title,
+								tc.url.Notes,
+								sqlxmock.AnyArg(),
 								tc.url.Id,
-							).WillReturnResult(sqlxmock.NewResult(1, 1))
+							).
+							WillReturnRows(sqlxmock.NewRows([]string{"id", "small_url", "origin_url"}).AddRow(tc.url.Id, tc.url.SmallUrl, tc.url.OriginUrl))
+						mock.ExpectExec("^INSERT INTO link_versions").
+							WithArgs(tc.url.Id, "anonymous", models.ActionUpdate, sqlxmock.AnyArg(), sqlxmock.AnyArg(), sqlxmock.AnyArg()).
+							WillReturnResult(sqlxmock.NewResult(1, 1))
+						mock.ExpectExec("^INSERT INTO webhook_deliveries").WillReturnResult(sqlxmock.NewResult(0, 0))
+						mock.ExpectExec("^INSERT INTO link_events").WillReturnResult(sqlxmock.NewResult(1, 1))
+						mock.ExpectCommit()
+					},
+					id:      1,
+					wantErr: false,
+				},
+				{
+					name: "Omitted settings keep their stored values",
+					url: models.Url{
+						Id:        1,
+						SmallUrl:  "xyz",
+						OriginUrl: "http://google.com",
+						Title:     "Sale",
+						Omitted:   []string{models.SettingAlwaysPreview, models.SettingActiveFrom, models.SettingActiveUntil, models.SettingUtmSource, models.SettingUtmMedium, models.SettingUtmCampaign, models.SettingNotes},
+					},
+					mock: func(tc *testCase) {
+						mock.ExpectBegin()
+						mock.ExpectQuery("^SELECT (.+) FROM bitlytest WHERE deleted_at IS NULL AND id = \\$1 FOR UPDATE").
+							WithArgs(tc.url.Id).
+							WillReturnRows(sqlxmock.NewRows([]string{"id", "small_url", "origin_url"}).AddRow(tc.url.Id, "old", "http://old.com"))
+						mock.ExpectQuery("^UPDATE bitlytest SET small_url = \\$1, origin_url = \\$2, origin_hash = \\$3, "+resetMetadata(4)+", title = \\$8, updated_at = \\$9 WHERE id = \\$10 RETURNING").
+							WithArgs(tc.url.SmallUrl, tc.url.OriginUrl, sqlxmock.AnyArg(), tc.url.OriginUrl, tc.url.OriginUrl, tc.url.OriginUrl, tc.url.OriginUrl, tc.url.Title, sqlxmock.AnyArg(), tc.url.Id).
+							WillReturnRows(sqlxmock.NewRows([]string{"id", "small_url", "origin_url"}).AddRow(tc.url.Id, tc.url.SmallUrl, tc.url.OriginUrl))
+						mock.ExpectExec("^INSERT INTO link_versions").
+							WithArgs(tc.url.Id, "anonymous", models.ActionUpdate, sqlxmock.AnyArg(), sqlxmock.AnyArg(), sqlxmock.AnyArg()).
+							WillReturnResult(sqlxmock.NewResult(1, 1))
+						mock.ExpectExec("^INSERT INTO webhook_deliveries").WillReturnResult(sqlxmock.NewResult(0, 0))
+						mock.ExpectExec("^INSERT INTO link_events").WillReturnResult(sqlxmock.NewResult(1, 1))
+						mock.ExpectCommit()
 					},
 					id:      1,
 					wantErr: false,
@@ -231,8 +338,199 @@ func TestUpdateDB(t *testing.T) {
 		}))
 }
 
+func TestInsertBatchDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Insert several rows in DB, skipping codes taken by aliases"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+			createdAt := time.Now()
+
+			urls := []models.Url{
+				{SmallUrl: "xyz", OriginUrl: "http://google.com", CreatedAt: createdAt, UpdateAt: createdAt},
+				{SmallUrl: "abc", OriginUrl: "http://yandex.ru", CreatedAt: createdAt, UpdateAt: createdAt},
+				{SmallUrl: "spring", OriginUrl: "http://mail.ru", CreatedAt: createdAt, UpdateAt: createdAt},
+			}
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id", "small_url", "origin_url", "created_at", "updated_at"}).
+					AddRow(1, "xyz", "http://google.com", createdAt, createdAt)
+				mock.ExpectBegin()
+				// spring is a secondary alias of another link.
+				mock.ExpectQuery("^SELECT domain, code FROM aliases WHERE \\(code = \\$1 AND domain = \\$2 OR code = \\$3 AND domain = \\$4 OR code = \\$5 AND domain = \\$6\\)").
+					WithArgs("xyz", "", "abc", "", "spring", "").
+					WillReturnRows(sqlxmock.NewRows([]string{"domain", "code"}).AddRow("", "spring"))
+				mock.ExpectQuery("^INSERT INTO bitlytest (.+) ON CONFLICT DO NOTHING").
+					WithArgs("", "xyz", "http://google.com", sqlxmock.AnyArg(), "anonymous", createdAt, createdAt, false, "", "", nil, nil, "", "", "", "", "", "", "", "", "", "", "abc", "http://yandex.ru", sqlxmock.AnyArg(), "anonymous", createdAt, createdAt, false, "", "", nil, nil, "", "", "", "", "", "", "", "", "").
+					WillReturnRows(rows)
+				mock.ExpectExec("^INSERT INTO link_versions \\(url_id,actor,action,changed_at,old_value,new_value\\) VALUES \\(\\$1,\\$2,\\$3,\\$4,\\$5,\\$6\\)$").
+					WithArgs(1, "anonymous", models.ActionCreate, sqlxmock.AnyArg(), nil, sqlxmock.AnyArg()).
+					WillReturnResult(sqlxmock.NewResult(1, 1))
+				mock.ExpectExec("^INSERT INTO webhook_deliveries").WillReturnResult(sqlxmock.NewResult(0, 0))
+				mock.ExpectExec("^INSERT INTO link_events").WillReturnResult(sqlxmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			}))
+
+			allure.Step(allure.Description("Insert data and check only new rows are returned"), allure.Action(func() {
+				inserted, err := storage.InsertBatch(context.TODO(), urls)
+
+				require.NoError(t, err)
+				require.Equal(t, []models.Url{{Id: 1, SmallUrl: "xyz", OriginUrl: "http://google.com", CreatedAt: createdAt, UpdateAt: createdAt}}, inserted)
+			}))
+		}))
+}
+
+func TestDeleteBatchDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Delete several rows in DB"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id"}).AddRow(2)
+				mock.ExpectBegin()
+				mock.ExpectQuery("^UPDATE bitlytest SET deleted_at = \\$1 WHERE deleted_at IS NULL AND id IN \\(\\$2,\\$3\\) RETURNING").
+					WithArgs(sqlxmock.AnyArg(), 1, 2).WillReturnRows(rows)
+				mock.ExpectExec("^INSERT INTO link_versions").
+					WithArgs(2, "anonymous", models.ActionDelete, sqlxmock.AnyArg(), sqlxmock.AnyArg(), nil).
+					WillReturnResult(sqlxmock.NewResult(1, 1))
+				mock.ExpectExec("^INSERT INTO webhook_deliveries").WillReturnResult(sqlxmock.NewResult(0, 0))
+				mock.ExpectExec("^INSERT INTO link_events").WillReturnResult(sqlxmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			}))
+
+			allure.Step(allure.Description("Delete data and check result"), allure.Action(func() {
+				deleted, err := storage.DeleteBatch(context.TODO(), []uint16{1, 2})
+
+				require.NoError(t, err)
+				require.Equal(t, []uint16{2}, deleted)
+			}))
+		}))
+}
+
+func TestGetWithTagsDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Select rows filtered by tag with their tags"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id", "small_url", "origin_url"}).
+					AddRow(1, "xyz", "http://google.com").
+					AddRow(2, "abc", "http://yandex.ru")
+				mock.ExpectQuery("^SELECT (.+) FROM bitlytest WHERE deleted_at IS NULL AND id IN \\(SELECT url_tags.url_id (.+) WHERE tags.name = \\$1\\)").
+					WithArgs("spring").WillReturnRows(rows)
+
+				tags := sqlxmock.NewRows([]string{"url_id", "name"}).
+					AddRow(1, "print").
+					AddRow(1, "spring").
+					AddRow(2, "spring")
+				mock.ExpectQuery("^SELECT url_tags.url_id, tags.name FROM url_tags JOIN tags ON tags.id = url_tags.tag_id WHERE url_tags.url_id IN \\(\\$1,\\$2\\)").
+					WithArgs(1, 2).WillReturnRows(tags)
+			}))
+
+			allure.Step(allure.Description("Select data and check tags are loaded"), allure.Action(func() {
+				urls, err := storage.Get(context.TODO(), models.UrlFilter{Tag: "spring"})
+
+				require.NoError(t, err)
+				require.Equal(t, []models.Url{
+					{Id: 1, SmallUrl: "xyz", OriginUrl: "http://google.com", Tags: []string{"print", "spring"}},
+					{Id: 2, SmallUrl: "abc", OriginUrl: "http://yandex.ru", Tags: []string{"spring"}},
+				}, urls)
+			}))
+		}))
+}
+
 func mockData(testCase testCase) {
 	allure.Step(allure.Description("Mock data"), allure.Action(func() {
 		testCase.mock(&testCase)
 	}))
 }
+
+func TestRestoreDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Restore a link from the trash"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("^UPDATE bitlytest SET deleted_at = \\$1 WHERE \\(id = \\$2 AND deleted_at IS NOT NULL\\) RETURNING").
+					WithArgs(nil, 1).WillReturnRows(sqlxmock.NewRows([]string{"id", "small_url"}).AddRow(1, "xyz"))
+				mock.ExpectExec("^INSERT INTO link_versions").
+					WithArgs(1, "anonymous", models.ActionRestore, sqlxmock.AnyArg(), nil, sqlxmock.AnyArg()).
+					WillReturnResult(sqlxmock.NewResult(1, 1))
+				mock.ExpectExec("^INSERT INTO webhook_deliveries").WillReturnResult(sqlxmock.NewResult(0, 0))
+				mock.ExpectExec("^INSERT INTO link_events").WillReturnResult(sqlxmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery("^UPDATE bitlytest SET deleted_at = \\$1 WHERE \\(id = \\$2 AND deleted_at IS NOT NULL\\) RETURNING").
+					WithArgs(nil, 2).WillReturnRows(sqlxmock.NewRows([]string{"id", "small_url"}))
+				mock.ExpectRollback()
+			}))
+
+			allure.Step(allure.Description("Restore data and check result"), allure.Action(func() {
+				url, err := storage.Restore(context.TODO(), models.Url{Id: 1})
+				require.NoError(t, err)
+				require.Equal(t, models.Url{Id: 1, SmallUrl: "xyz"}, url)
+
+				_, err = storage.Restore(context.TODO(), models.Url{Id: 2})
+				require.ErrorAs(t, err, &models.NotFound{})
+			}))
+		}))
+}
+
+func TestPurgeDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Purge old links from the trash"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+			before := time.Now()
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id", "small_url", "origin_url"}).
+					AddRow(1, "abc", "http://google.com").
+					AddRow(2, "xyz", "http://yandex.ru").
+					AddRow(3, "qwe", "http://mail.ru")
+				mock.ExpectBegin()
+				mock.ExpectQuery("^DELETE FROM bitlytest WHERE deleted_at < \\$1 RETURNING").
+					WithArgs(before).WillReturnRows(rows)
+				mock.ExpectExec("^INSERT INTO link_events").
+					WithArgs("LinkDeleted", 1, sqlxmock.AnyArg(), sqlxmock.AnyArg(), "LinkDeleted", 2, sqlxmock.AnyArg(), sqlxmock.AnyArg(), "LinkDeleted", 3, sqlxmock.AnyArg(), sqlxmock.AnyArg()).
+					WillReturnResult(sqlxmock.NewResult(3, 3))
+				mock.ExpectCommit()
+			}))
+
+			allure.Step(allure.Description("Purge data and check result"), allure.Action(func() {
+				n, err := storage.Purge(context.TODO(), before)
+				require.NoError(t, err)
+				require.Equal(t, int64(3), n)
+				require.NoError(t, mock.ExpectationsWereMet())
+			}))
+		}))
+}
@@ -0,0 +1,104 @@
+package adapters
+
+import (
+	"context"
+	"log"
+
+	"github.com/kristina71/bitlytest/pkg/events"
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"github.com/Masterminds/squirrel"
+)
+
+const (
+	tagsTable    = "tags"
+	urlTagsTable = "url_tags"
+)
+
+// loadTags fills the tags of all urls with a single query.
+func (s *Storage) loadTags(urls []models.Url) error {
+	if len(urls) == 0 {
+		return nil
+	}
+
+	index := make(map[uint16]int, len(urls))
+	ids := make([]uint16, 0, len(urls))
+	for i, url := range urls {
+		index[url.Id] = i
+		ids = append(ids, url.Id)
+		urls[i].Tags = []string{}
+	}
+
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select("url_tags.url_id", "tags.name").
+		From(urlTagsTable).Join(tagsTable + " ON tags.id = url_tags.tag_id").
+		Where(squirrel.Eq{"url_tags.url_id": ids}).OrderBy("tags.name").ToSql()
+	if err != nil {
+		return err
+	}
+
+	rows := []struct {
+		UrlId uint16 `db:"url_id"`
+		Name  string `db:"name"`
+	}{}
+	err = s.db.Select(&rows, query, args...)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if i, ok := index[row.UrlId]; ok {
+			urls[i].Tags = append(urls[i].Tags, row.Name)
+		}
+	}
+	return nil
+}
+
+// SetTags replaces the tags of the link in one transaction, creating tags that do not exist yet.
+func (s *Storage) SetTags(ctx context.Context, url models.Url, tags []string) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Delete(urlTagsTable).Where(squirrel.Eq{"url_id": url.Id}).ToSql()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if _, err = tx.Exec(query, args...); err != nil {
+		return err
+	}
+
+	if len(tags) > 0 {
+		builder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Insert(tagsTable).Columns("name")
+		for _, tag := range tags {
+			builder = builder.Values(tag)
+		}
+
+		query, args, err = builder.Suffix("ON CONFLICT (name) DO NOTHING").ToSql()
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		if _, err = tx.Exec(query, args...); err != nil {
+			return err
+		}
+
+		query, args, err = squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Insert(urlTagsTable).Columns("url_id", "tag_id").
+			Select(squirrel.Select().Column(squirrel.Expr("?", url.Id)).Column("id").From(tagsTable).Where(squirrel.Eq{"name": tags})).ToSql()
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		if _, err = tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+
+	if err = s.addUpdateEvent(ctx, tx, url, events.ChangeTags); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,215 @@
+package adapters
+
+import (
+	"context"
+	"log"
+
+	"github.com/kristina71/bitlytest/pkg/events"
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"github.com/Masterminds/squirrel"
+)
+
+const (
+	geoRulesTable    = "geo_rules"
+	deviceRulesTable = "device_rules"
+	variantsTable    = "variants"
+)
+
+func (s *Storage) GetGeoRules(ctx context.Context, url models.Url) ([]models.GeoRule, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select("id", "url_id", "country", "target_url").From(geoRulesTable).Where(squirrel.Eq{"url_id": url.Id}).OrderBy("country").ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	rules := []models.GeoRule{}
+	err = s.db.Select(&rules, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// SetGeoRules replaces all geo rules of the link in one transaction.
+func (s *Storage) SetGeoRules(ctx context.Context, url models.Url, rules []models.GeoRule) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Delete(geoRulesTable).Where(squirrel.Eq{"url_id": url.Id}).ToSql()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if _, err = tx.Exec(query, args...); err != nil {
+		return err
+	}
+
+	if len(rules) > 0 {
+		builder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Insert(geoRulesTable).Columns("url_id", "country", "target_url")
+		for _, rule := range rules {
+			builder = builder.Values(url.Id, rule.Country, rule.TargetUrl)
+		}
+
+		query, args, err = builder.ToSql()
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		if _, err = tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+
+	if err = s.addUpdateEvent(ctx, tx, url, events.ChangeGeoRules); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) GetDeviceRules(ctx context.Context, url models.Url) ([]models.DeviceRule, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select("id", "url_id", "position", "os", "device", "browser", "target_url").From(deviceRulesTable).Where(squirrel.Eq{"url_id": url.Id}).OrderBy("position").ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	rules := []models.DeviceRule{}
+	err = s.db.Select(&rules, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// SetDeviceRules replaces all device rules of the link in one transaction, keeping their order.
+func (s *Storage) SetDeviceRules(ctx context.Context, url models.Url, rules []models.DeviceRule) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Delete(deviceRulesTable).Where(squirrel.Eq{"url_id": url.Id}).ToSql()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if _, err = tx.Exec(query, args...); err != nil {
+		return err
+	}
+
+	if len(rules) > 0 {
+		builder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Insert(deviceRulesTable).Columns("url_id", "position", "os", "device", "browser", "target_url")
+		for i, rule := range rules {
+			builder = builder.Values(url.Id, i, rule.OS, rule.Device, rule.Browser, rule.TargetUrl)
+		}
+
+		query, args, err = builder.ToSql()
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		if _, err = tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+
+	if err = s.addUpdateEvent(ctx, tx, url, events.ChangeDeviceRules); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) GetVariants(ctx context.Context, url models.Url) ([]models.Variant, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select("id", "url_id", "target_url", "weight", "clicks").From(variantsTable).Where(squirrel.Eq{"url_id": url.Id}).OrderBy("id").ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	variants := []models.Variant{}
+	err = s.db.Select(&variants, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return variants, nil
+}
+
+// SetVariants replaces the variants of the link in one transaction. Variants sent with their id
+// are updated in place so their click counts survive a change of weights.
+func (s *Storage) SetVariants(ctx context.Context, url models.Url, variants []models.Variant) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	keep := []int64{}
+	for _, variant := range variants {
+		if variant.Id != 0 {
+			keep = append(keep, variant.Id)
+		}
+	}
+
+	builder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Delete(variantsTable).Where(squirrel.Eq{"url_id": url.Id})
+	if len(keep) > 0 {
+		builder = builder.Where(squirrel.NotEq{"id": keep})
+	}
+	query, args, err := builder.ToSql()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if _, err = tx.Exec(query, args...); err != nil {
+		return err
+	}
+
+	for _, variant := range variants {
+		if variant.Id != 0 {
+			query, args, err = squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Update(variantsTable).
+				Set("target_url", variant.TargetUrl).
+				Set("weight", variant.Weight).
+				Where(squirrel.Eq{"id": variant.Id, "url_id": url.Id}).ToSql()
+		} else {
+			query, args, err = squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Insert(variantsTable).
+				Columns("url_id", "target_url", "weight").
+				Values(url.Id, variant.TargetUrl, variant.Weight).ToSql()
+		}
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		if _, err = tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+
+	if err = s.addUpdateEvent(ctx, tx, url, events.ChangeVariants); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) IncrementVariantClicks(ctx context.Context, variant models.Variant) error {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Update(variantsTable).Set("clicks", squirrel.Expr("clicks + 1")).Where(squirrel.Eq{"id": variant.Id}).ToSql()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	_, err = s.db.Exec(query, args...)
+	return err
+}
@@ -0,0 +1,75 @@
+package adapters_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dailymotion/allure-go"
+	"github.com/kristina71/bitlytest/pkg/adapters"
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	sqlxmock "github.com/zhashkevych/go-sqlxmock"
+)
+
+func TestGetDeviceRulesDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Select device rules in order, ids past 65535 included"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id", "url_id", "position", "os", "device", "browser", "target_url"}).
+					AddRow(70001, 1, 0, "ios", "", "", "http://apple.com").
+					AddRow(70002, 1, 1, "", "desktop", "", "http://google.com")
+				mock.ExpectQuery("^SELECT (.+) FROM device_rules WHERE url_id = \\$1 ORDER BY position").
+					WithArgs(1).WillReturnRows(rows)
+			}))
+
+			allure.Step(allure.Description("Select data and check result"), allure.Action(func() {
+				rules, err := storage.GetDeviceRules(context.TODO(), models.Url{Id: 1})
+
+				require.NoError(t, err)
+				require.Equal(t, []models.DeviceRule{
+					{Id: 70001, UrlId: 1, Position: 0, OS: "ios", TargetUrl: "http://apple.com"},
+					{Id: 70002, UrlId: 1, Position: 1, Device: "desktop", TargetUrl: "http://google.com"},
+				}, rules)
+			}))
+		}))
+}
+
+func TestGetGeoRulesDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Select geo rules by country, ids past 65535 included"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id", "url_id", "country", "target_url"}).
+					AddRow(70001, 1, "DE", "http://google.de").
+					AddRow(70002, 1, "RU", "http://yandex.ru")
+				mock.ExpectQuery("^SELECT id, url_id, country, target_url FROM geo_rules WHERE url_id = \\$1 ORDER BY country").
+					WithArgs(1).WillReturnRows(rows)
+			}))
+
+			allure.Step(allure.Description("Select data and check result"), allure.Action(func() {
+				rules, err := storage.GetGeoRules(context.TODO(), models.Url{Id: 1})
+
+				require.NoError(t, err)
+				require.Equal(t, []models.GeoRule{
+					{Id: 70001, UrlId: 1, Country: "DE", TargetUrl: "http://google.de"},
+					{Id: 70002, UrlId: 1, Country: "RU", TargetUrl: "http://yandex.ru"},
+				}, rules)
+			}))
+		}))
+}
@@ -0,0 +1,94 @@
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/actor"
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/pkg/errors"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+const versionsTable = "link_versions"
+
+var versionColumns = []string{"id", "url_id", "actor", "action", "changed_at", "old_value", "new_value"}
+
+// addVersions records a change of every url. old has the state before the change and is nil for
+// created links, updated has the state after it and is nil for deleted links. When both are set,
+// they hold the same urls at the same indexes.
+func addVersions(ctx context.Context, tx *sqlx.Tx, action string, old, updated []models.Url) error {
+	links := updated
+	if links == nil {
+		links = old
+	}
+	if len(links) == 0 {
+		return nil
+	}
+
+	who := actor.From(ctx)
+	now := time.Now().UTC()
+	builder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Insert(versionsTable).Columns("url_id", "actor", "action", "changed_at", "old_value", "new_value")
+	for i, url := range links {
+		var before, after *models.Snapshot
+		if old != nil {
+			before = models.SnapshotOf(old[i])
+		}
+		if updated != nil {
+			after = models.SnapshotOf(updated[i])
+		}
+		builder = builder.Values(url.Id, who, action, now, before, after)
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	_, err = tx.Exec(query, args...)
+	return err
+}
+
+// GetHistory returns the changes of the link, newest first.
+func (s *Storage) GetHistory(ctx context.Context, url models.Url) ([]models.LinkVersion, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select(versionColumns...).From(versionsTable).Where(squirrel.Eq{"url_id": url.Id}).OrderBy("id DESC").ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	versions := []models.LinkVersion{}
+	err = s.db.Select(&versions, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func (s *Storage) GetVersion(ctx context.Context, version models.LinkVersion) (models.LinkVersion, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select(versionColumns...).From(versionsTable).Where(squirrel.Eq{"id": version.Id}).ToSql()
+	if err != nil {
+		log.Println(err)
+		return models.LinkVersion{}, err
+	}
+
+	version = models.LinkVersion{}
+	err = s.db.Get(&version, query, args...)
+	if err == sql.ErrNoRows {
+		return models.LinkVersion{}, errors.WithStack(models.NotFoundError())
+	}
+
+	return version, err
+}
+
+// Rollback writes the settings of a previous version back to the link and records it as a new change.
+func (s *Storage) Rollback(ctx context.Context, url models.Url) (models.Url, error) {
+	return s.update(ctx, url, models.ActionRollback)
+}
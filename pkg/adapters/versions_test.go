@@ -0,0 +1,99 @@
+package adapters_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dailymotion/allure-go"
+	"github.com/kristina71/bitlytest/pkg/actor"
+	"github.com/kristina71/bitlytest/pkg/adapters"
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	sqlxmock "github.com/zhashkevych/go-sqlxmock"
+)
+
+func TestGetHistoryDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Select versions of a link"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+			changedAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id", "url_id", "actor", "action", "changed_at", "old_value", "new_value"}).
+					AddRow(70002, 1, "alice", models.ActionUpdate, changedAt, []byte(`{"small_url":"xyz","origin_url":"http://google.com"}`), []byte(`{"small_url":"xyz","origin_url":"http://yandex.ru"}`)).
+					AddRow(1, 1, "anonymous", models.ActionCreate, changedAt, nil, []byte(`{"small_url":"xyz","origin_url":"http://google.com"}`))
+				mock.ExpectQuery("^SELECT (.+) FROM link_versions WHERE url_id = \\$1 ORDER BY id DESC").
+					WithArgs(1).WillReturnRows(rows)
+			}))
+
+			allure.Step(allure.Description("Select data and check snapshots are decoded"), allure.Action(func() {
+				versions, err := storage.GetHistory(context.TODO(), models.Url{Id: 1})
+
+				require.NoError(t, err)
+				require.Equal(t, []models.LinkVersion{
+					{Id: 70002, UrlId: 1, Actor: "alice", Action: models.ActionUpdate, ChangedAt: changedAt, Old: &models.Snapshot{SmallUrl: "xyz", OriginUrl: "http://google.com"}, New: &models.Snapshot{SmallUrl: "xyz", OriginUrl: "http://yandex.ru"}},
+					{Id: 1, UrlId: 1, Actor: "anonymous", Action: models.ActionCreate, ChangedAt: changedAt, New: &models.Snapshot{SmallUrl: "xyz", OriginUrl: "http://google.com"}},
+				}, versions)
+			}))
+		}))
+}
+
+func TestRollbackDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Rollback is recorded with the actor"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+			ctx := actor.With(context.TODO(), "alice")
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("^SELECT (.+) FOR UPDATE").WithArgs(1).
+					WillReturnRows(sqlxmock.NewRows([]string{"id", "small_url", "origin_url"}).AddRow(1, "xyz", "http://yandex.ru"))
+				mock.ExpectQuery("^UPDATE bitlytest SET (.+) RETURNING").
+					WillReturnRows(sqlxmock.NewRows([]string{"id", "small_url", "origin_url"}).AddRow(1, "xyz", "http://google.com"))
+				mock.ExpectExec("^INSERT INTO link_versions").
+					WithArgs(1, "alice", models.ActionRollback, sqlxmock.AnyArg(), sqlxmock.AnyArg(), sqlxmock.AnyArg()).
+					WillReturnResult(sqlxmock.NewResult(1, 1))
+				mock.ExpectExec("^INSERT INTO webhook_deliveries").WillReturnResult(sqlxmock.NewResult(0, 0))
+				mock.ExpectExec("^INSERT INTO link_events").WillReturnResult(sqlxmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			}))
+
+			allure.Step(allure.Description("Rollback and check result"), allure.Action(func() {
+				url, err := storage.Rollback(ctx, models.Url{Id: 1, SmallUrl: "xyz", OriginUrl: "http://google.com"})
+
+				require.NoError(t, err)
+				require.Equal(t, models.Url{Id: 1, SmallUrl: "xyz", OriginUrl: "http://google.com"}, url)
+				require.NoError(t, mock.ExpectationsWereMet())
+			}))
+		}))
+}
+
+func TestUpdateMissingDB(t *testing.T) {
+	db, mock, err := sqlxmock.Newx()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	storage := adapters.New(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("^SELECT (.+) FOR UPDATE").WithArgs(9).WillReturnRows(sqlxmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	err = storage.Update(context.TODO(), models.Url{Id: 9, SmallUrl: "xyz", OriginUrl: "http://google.com"})
+	require.ErrorAs(t, err, &models.NotFound{})
+}
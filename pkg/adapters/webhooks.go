@@ -0,0 +1,360 @@
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/actor"
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/pkg/errors"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	webhooksTable   = "webhooks"
+	deliveriesTable = "webhook_deliveries"
+	// deliveriesLimit caps how many deliveries are listed at once, newest first.
+	deliveriesLimit = 500
+	// clickCheckInterval is how long QueueClick trusts its last look at the webhooks subscribed to clicks.
+	// Changes made through this process are seen right away, those of other instances within the interval.
+	clickCheckInterval = 10 * time.Second
+)
+
+// clickSubscribers remembers whether an active webhook subscribes to clicks, so redirects do not
+// write anything while none does.
+type clickSubscribers struct {
+	mu         sync.Mutex
+	checkedAt  time.Time
+	subscribed bool
+}
+
+var (
+	webhookColumns  = []string{"id", "url", "events", "secret", "active", "created_at"}
+	deliveryColumns = []string{"id", "webhook_id", "event", "payload", "status", "attempts", "next_attempt_at", "last_status", "last_error", "created_at", "delivered_at"}
+)
+
+// queueWebhooks writes a delivery of every payload for each active webhook subscribed to event.
+// Called with the transaction of a link change, the deliveries are stored together with the change.
+func queueWebhooks(ctx context.Context, db sqlx.Execer, event string, payloads []models.WebhookPayload) error {
+	if len(payloads) == 0 {
+		return nil
+	}
+
+	bodies := make([]string, 0, len(payloads))
+	for _, payload := range payloads {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		bodies = append(bodies, string(body))
+	}
+
+	now := time.Now().UTC()
+	subscribed := squirrel.Select(webhooksTable+".id").Column(squirrel.Expr("?::text", event)).Column("payloads.payload").Column(squirrel.Expr("?::timestamp", now)).Column(squirrel.Expr("?::timestamp", now)).
+		From(webhooksTable).JoinClause("CROSS JOIN unnest(?::jsonb[]) AS payloads(payload)", pq.Array(bodies)).
+		Where(squirrel.Eq{webhooksTable + ".active": true}).Where("? = ANY("+webhooksTable+".events)", event)
+
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Insert(deliveriesTable).
+		Columns("webhook_id", "event", "payload", "next_attempt_at", "created_at").Select(subscribed).ToSql()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	_, err = db.Exec(query, args...)
+	return err
+}
+
+// webhookPayloads describes a change of every url the way addVersions receives it.
+func webhookPayloads(ctx context.Context, action string, old, updated []models.Url) []models.WebhookPayload {
+	links := updated
+	if links == nil {
+		links = old
+	}
+
+	who := actor.From(ctx)
+	now := time.Now().UTC()
+	payloads := make([]models.WebhookPayload, 0, len(links))
+	for i, url := range links {
+		payload := models.WebhookPayload{Event: models.EventOf(action), OccurredAt: now, Actor: who, LinkId: url.Id, Domain: url.Domain}
+		if old != nil {
+			payload.Previous = models.SnapshotOf(old[i])
+		}
+		if updated != nil {
+			payload.Link = models.SnapshotOf(updated[i])
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads
+}
+
+// QueueClick announces a visit of the link sent to destination.
+func (s *Storage) QueueClick(ctx context.Context, url models.Url, destination string) error {
+	subscribed, err := s.clicksSubscribed()
+	if err != nil || !subscribed {
+		return err
+	}
+
+	payload := models.WebhookPayload{
+		Event:       models.EventLinkClicked,
+		OccurredAt:  time.Now().UTC(),
+		Actor:       actor.From(ctx),
+		LinkId:      url.Id,
+		Domain:      url.Domain,
+		Link:        models.SnapshotOf(url),
+		Destination: destination,
+	}
+	return queueWebhooks(ctx, s.db, models.EventLinkClicked, []models.WebhookPayload{payload})
+}
+
+// clicksSubscribed tells whether an active webhook subscribes to clicks, looking it up again once the last look is too old.
+func (s *Storage) clicksSubscribed() (bool, error) {
+	s.clicks.mu.Lock()
+	defer s.clicks.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.clicks.checkedAt) < clickCheckInterval {
+		return s.clicks.subscribed, nil
+	}
+
+	subscribed := squirrel.Select("1").From(webhooksTable).
+		Where(squirrel.Eq{"active": true}).Where("? = ANY(events)", models.EventLinkClicked).Prefix("SELECT EXISTS (").Suffix(")")
+	query, args, err := subscribed.PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+
+	err = s.db.Get(&s.clicks.subscribed, query, args...)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+
+	s.clicks.checkedAt = now
+	return s.clicks.subscribed, nil
+}
+
+// forgetClickSubscribers makes the next click look the webhooks up again, after one of them changed.
+func (s *Storage) forgetClickSubscribers() {
+	s.clicks.mu.Lock()
+	s.clicks.checkedAt = time.Time{}
+	s.clicks.mu.Unlock()
+}
+
+func (s *Storage) GetWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select(webhookColumns...).From(webhooksTable).OrderBy("id").ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	webhooks := []models.Webhook{}
+	err = s.db.Select(&webhooks, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (s *Storage) AddWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Insert(webhooksTable).Columns("url", "events", "secret", "active", "created_at").
+		Values(webhook.Url, webhook.Events, webhook.Secret, webhook.Active, time.Now().UTC()).Suffix("RETURNING " + strings.Join(webhookColumns, ", ")).ToSql()
+	if err != nil {
+		log.Println(err)
+		return models.Webhook{}, err
+	}
+
+	added := models.Webhook{}
+	err = s.db.Get(&added, query, args...)
+	s.forgetClickSubscribers()
+	return added, err
+}
+
+// UpdateWebhook changes the url, the events and whether the webhook is active. The secret stays as it is.
+func (s *Storage) UpdateWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Update(webhooksTable).
+		Set("url", webhook.Url).Set("events", webhook.Events).Set("active", webhook.Active).Where(squirrel.Eq{"id": webhook.Id}).
+		Suffix("RETURNING " + strings.Join(webhookColumns, ", ")).ToSql()
+	if err != nil {
+		log.Println(err)
+		return models.Webhook{}, err
+	}
+
+	updated := models.Webhook{}
+	err = s.db.Get(&updated, query, args...)
+	s.forgetClickSubscribers()
+
+	if err == sql.ErrNoRows {
+		return models.Webhook{}, errors.WithStack(models.NotFoundError())
+	}
+
+	return updated, err
+}
+
+// RemoveWebhook deletes the webhook together with its deliveries.
+func (s *Storage) RemoveWebhook(ctx context.Context, webhook models.Webhook) error {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Delete(webhooksTable).Where(squirrel.Eq{"id": webhook.Id}).ToSql()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	s.forgetClickSubscribers()
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.WithStack(models.NotFoundError())
+	}
+	return nil
+}
+
+func (s *Storage) GetDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]models.Delivery, error) {
+	builder := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select(deliveryColumns...).From(deliveriesTable).OrderBy("id DESC").Limit(deliveriesLimit)
+	if filter.WebhookId != 0 {
+		builder = builder.Where(squirrel.Eq{"webhook_id": filter.WebhookId})
+	}
+	if filter.Status != "" {
+		builder = builder.Where(squirrel.Eq{"status": filter.Status})
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	deliveries := []models.Delivery{}
+	err = s.db.Select(&deliveries, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// ClaimDeliveries returns up to limit pending deliveries due at now and postpones them to leaseUntil,
+// so another worker does not send them meanwhile. Deliveries of inactive webhooks wait until they are active again.
+func (s *Storage) ClaimDeliveries(ctx context.Context, now time.Time, limit int, leaseUntil time.Time) ([]models.Delivery, error) {
+	due := squirrel.Select(deliveriesTable + ".id").From(deliveriesTable).Join(webhooksTable + " ON " + webhooksTable + ".id = " + deliveriesTable + ".webhook_id").
+		Where(squirrel.Eq{deliveriesTable + ".status": models.DeliveryPending, webhooksTable + ".active": true}).
+		Where(squirrel.LtOrEq{deliveriesTable + ".next_attempt_at": now}).
+		OrderBy(deliveriesTable + ".id").Limit(uint64(limit)).Suffix("FOR UPDATE OF " + deliveriesTable + " SKIP LOCKED")
+	dueQuery, dueArgs, err := due.ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Update(deliveriesTable).Set("next_attempt_at", leaseUntil).
+		Where("id IN ("+dueQuery+")", dueArgs...).Suffix("RETURNING " + strings.Join(deliveryColumns, ", ")).ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	deliveries := []models.Delivery{}
+	err = s.db.Select(&deliveries, query, args...)
+	if err != nil || len(deliveries) == 0 {
+		return deliveries, err
+	}
+
+	ids := make([]int64, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.WebhookId)
+	}
+
+	query, args, err = squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Select(webhookColumns...).From(webhooksTable).Where(squirrel.Eq{"id": ids}).ToSql()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	webhooks := []models.Webhook{}
+	err = s.db.Select(&webhooks, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	byId := map[int64]models.Webhook{}
+	for _, webhook := range webhooks {
+		byId[webhook.Id] = webhook
+	}
+	for i := range deliveries {
+		deliveries[i].Url = byId[deliveries[i].WebhookId].Url
+		deliveries[i].Secret = byId[deliveries[i].WebhookId].Secret
+	}
+
+	return deliveries, nil
+}
+
+// SaveDelivery stores the outcome of an attempt to send the delivery.
+func (s *Storage) SaveDelivery(ctx context.Context, delivery models.Delivery) error {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Update(deliveriesTable).
+		Set("status", delivery.Status).Set("attempts", delivery.Attempts).Set("next_attempt_at", delivery.NextAttemptAt).
+		Set("last_status", delivery.LastStatus).Set("last_error", delivery.LastError).Set("delivered_at", delivery.DeliveredAt).
+		Where(squirrel.Eq{"id": delivery.Id}).ToSql()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	_, err = s.db.Exec(query, args...)
+	return err
+}
+
+// RetryDelivery puts a dead delivery back in line with a fresh set of attempts.
+func (s *Storage) RetryDelivery(ctx context.Context, delivery models.Delivery) (models.Delivery, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Update(deliveriesTable).
+		Set("status", models.DeliveryPending).Set("attempts", 0).Set("next_attempt_at", time.Now().UTC()).
+		Where(squirrel.Eq{"id": delivery.Id, "status": models.DeliveryDead}).Suffix("RETURNING " + strings.Join(deliveryColumns, ", ")).ToSql()
+	if err != nil {
+		log.Println(err)
+		return models.Delivery{}, err
+	}
+
+	retried := models.Delivery{}
+	err = s.db.Get(&retried, query, args...)
+
+	if err == sql.ErrNoRows {
+		return models.Delivery{}, errors.WithStack(models.NotFoundError())
+	}
+
+	return retried, err
+}
+
+// PruneDeliveries deletes the delivered and dead deliveries created before the given time. Pending ones are kept.
+func (s *Storage) PruneDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	query, args, err := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar).Delete(deliveriesTable).
+		Where(squirrel.Eq{"status": []string{models.DeliveryDelivered, models.DeliveryDead}}).Where(squirrel.Lt{"created_at": before}).ToSql()
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,154 @@
+package adapters_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dailymotion/allure-go"
+	"github.com/kristina71/bitlytest/pkg/adapters"
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"github.com/stretchr/testify/require"
+	sqlxmock "github.com/zhashkevych/go-sqlxmock"
+)
+
+const clicksSubscribed = "^SELECT EXISTS \\( SELECT 1 FROM webhooks WHERE active = \\$1 AND \\$2 = ANY\\(events\\) \\)$"
+
+func TestQueueClickDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Queue a click for the webhooks subscribed to it"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				mock.ExpectQuery(clicksSubscribed).WithArgs(true, models.EventLinkClicked).WillReturnRows(sqlxmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectExec("^INSERT INTO webhook_deliveries \\(webhook_id,event,payload,next_attempt_at,created_at\\) "+
+					"SELECT webhooks.id, \\$1::text, payloads.payload, \\$2::timestamp, \\$3::timestamp FROM webhooks "+
+					"CROSS JOIN unnest\\(\\$4::jsonb\\[\\]\\) AS payloads\\(payload\\) WHERE webhooks.active = \\$5 AND \\$6 = ANY\\(webhooks.events\\)$").
+					WithArgs(models.EventLinkClicked, sqlxmock.AnyArg(), sqlxmock.AnyArg(), sqlxmock.AnyArg(), true, models.EventLinkClicked).
+					WillReturnResult(sqlxmock.NewResult(0, 2))
+			}))
+
+			allure.Step(allure.Description("Queue the click"), allure.Action(func() {
+				err := storage.QueueClick(context.TODO(), models.Url{Id: 7, SmallUrl: "sale", OriginUrl: "http://google.com"}, "http://google.com")
+				require.NoError(t, err)
+				require.NoError(t, mock.ExpectationsWereMet())
+			}))
+		}))
+}
+
+func TestQueueClickUnsubscribedDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Write nothing on clicks while no webhook subscribes to them"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+			url := models.Url{Id: 7, SmallUrl: "sale", OriginUrl: "http://google.com"}
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				mock.ExpectQuery(clicksSubscribed).WithArgs(true, models.EventLinkClicked).WillReturnRows(sqlxmock.NewRows([]string{"exists"}).AddRow(false))
+			}))
+
+			allure.Step(allure.Description("Later clicks do not look again"), allure.Action(func() {
+				for i := 0; i < 3; i++ {
+					require.NoError(t, storage.QueueClick(context.TODO(), url, "http://google.com"))
+				}
+				require.NoError(t, mock.ExpectationsWereMet())
+			}))
+
+			allure.Step(allure.Description("Mock a webhook subscribing to clicks"), allure.Action(func() {
+				mock.ExpectQuery("^INSERT INTO webhooks").
+					WillReturnRows(sqlxmock.NewRows([]string{"id", "url", "events", "active"}).AddRow(1, "https://crm.example.com/hooks", "{link.clicked}", true))
+				mock.ExpectQuery(clicksSubscribed).WithArgs(true, models.EventLinkClicked).WillReturnRows(sqlxmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectExec("^INSERT INTO webhook_deliveries").WillReturnResult(sqlxmock.NewResult(0, 1))
+			}))
+
+			allure.Step(allure.Description("The next click is queued"), allure.Action(func() {
+				_, err := storage.AddWebhook(context.TODO(), models.Webhook{Url: "https://crm.example.com/hooks", Events: []string{models.EventLinkClicked}, Active: true})
+				require.NoError(t, err)
+				require.NoError(t, storage.QueueClick(context.TODO(), url, "http://google.com"))
+				require.NoError(t, mock.ExpectationsWereMet())
+			}))
+		}))
+}
+
+func TestPruneDeliveriesDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Delete old finished deliveries"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+			before := time.Date(2026, 9, 19, 12, 0, 0, 0, time.UTC)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				mock.ExpectExec("^DELETE FROM webhook_deliveries WHERE status IN \\(\\$1,\\$2\\) AND created_at < \\$3$").
+					WithArgs(models.DeliveryDelivered, models.DeliveryDead, before).WillReturnResult(sqlxmock.NewResult(0, 5))
+			}))
+
+			allure.Step(allure.Description("Prune data and check result"), allure.Action(func() {
+				n, err := storage.PruneDeliveries(context.TODO(), before)
+				require.NoError(t, err)
+				require.Equal(t, int64(5), n)
+				require.NoError(t, mock.ExpectationsWereMet())
+			}))
+		}))
+}
+
+func TestClaimDeliveriesDB(t *testing.T) {
+	allure.Test(t,
+		allure.Description("Claim due deliveries and attach their webhook"),
+		allure.Action(func() {
+			db, mock, err := sqlxmock.Newx()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			storage := adapters.New(db)
+			now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+			lease := now.Add(20 * time.Second)
+
+			allure.Step(allure.Description("Mock data"), allure.Action(func() {
+				rows := sqlxmock.NewRows([]string{"id", "webhook_id", "event", "payload", "status", "attempts", "next_attempt_at", "last_status", "last_error", "created_at", "delivered_at"}).
+					AddRow(70003, 1, models.EventLinkCreated, []byte(`{"event":"link.created"}`), models.DeliveryPending, 0, lease, 0, "", now, nil)
+				mock.ExpectQuery("^UPDATE webhook_deliveries SET next_attempt_at = \\$1 WHERE id IN \\(SELECT webhook_deliveries.id FROM webhook_deliveries "+
+					"JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id WHERE webhook_deliveries.status = \\$2 AND webhooks.active = \\$3 "+
+					"AND webhook_deliveries.next_attempt_at <= \\$4 ORDER BY webhook_deliveries.id LIMIT 10 FOR UPDATE OF webhook_deliveries SKIP LOCKED\\) RETURNING (.+)$").
+					WithArgs(lease, models.DeliveryPending, true, now).WillReturnRows(rows)
+
+				webhooks := sqlxmock.NewRows([]string{"id", "url", "events", "secret", "active", "created_at"}).
+					AddRow(1, "https://crm.example.com/hooks", "{link.created}", "secret", true, now)
+				mock.ExpectQuery("^SELECT (.+) FROM webhooks WHERE id IN \\(\\$1\\)").WithArgs(1).WillReturnRows(webhooks)
+			}))
+
+			allure.Step(allure.Description("Claim and check result"), allure.Action(func() {
+				deliveries, err := storage.ClaimDeliveries(context.TODO(), now, 10, lease)
+				require.NoError(t, err)
+				require.Equal(t, []models.Delivery{{
+					Id:            70003,
+					WebhookId:     1,
+					Event:         models.EventLinkCreated,
+					Payload:       json.RawMessage(`{"event":"link.created"}`),
+					Status:        models.DeliveryPending,
+					NextAttemptAt: lease,
+					CreatedAt:     now,
+					Url:           "https://crm.example.com/hooks",
+					Secret:        "secret",
+				}}, deliveries)
+			}))
+		}))
+}
@@ -0,0 +1,195 @@
+package canonical
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Options switch on the steps that may change where a url leads.
+type Options struct {
+	// StripTracking drops utm_* and click id parameters.
+	StripTracking bool
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+var trackingParams = map[string]bool{
+	"fbclid": true,
+	"gclid":  true,
+}
+
+// Url brings an absolute url to one spelling, so equal destinations compare equal: scheme and host
+// are lowercased, international hosts converted to punycode, the default port dropped, dot segments
+// of the path resolved, percent-encoding normalized and query parameters sorted by name.
+// Urls without a host are returned untouched and left for validation.
+func Url(raw string, opts Options) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw, err
+	}
+	if u.Host == "" || u.Opaque != "" {
+		return raw, nil
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host, err = host(u)
+	if err != nil {
+		return raw, err
+	}
+
+	escaped := removeDotSegments(normalizeEscapes(u.EscapedPath()))
+	u.Path, err = url.PathUnescape(escaped)
+	if err != nil {
+		return raw, err
+	}
+	u.RawPath = escaped
+
+	u.RawQuery = query(u.RawQuery, opts)
+	u.ForceQuery = false
+	return u.String(), nil
+}
+
+// Host lowercases a host name and converts an international one to punycode.
+func Host(name string) (string, error) {
+	name = strings.ToLower(name)
+	if isASCII(name) {
+		return name, nil
+	}
+	return idna.Lookup.ToASCII(name)
+}
+
+func host(u *url.URL) (string, error) {
+	name, err := Host(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(name, ":") {
+		name = "[" + name + "]"
+	}
+
+	port := u.Port()
+	if port == "" || defaultPorts[u.Scheme] == port {
+		return name, nil
+	}
+	return name + ":" + port, nil
+}
+
+// query sorts the parameters by name keeping the order of repeated ones. Values are kept as sent
+// apart from percent-encoding, so a parameter without a value stays without one.
+func query(raw string, opts Options) string {
+	type param struct{ name, raw string }
+
+	params := []param{}
+	for _, part := range strings.Split(raw, "&") {
+		if part == "" {
+			continue
+		}
+		part = normalizeEscapes(part)
+
+		name := part
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			name = part[:i]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if opts.StripTracking && (strings.HasPrefix(name, "utm_") || trackingParams[name]) {
+			continue
+		}
+		params = append(params, param{name: name, raw: part})
+	}
+
+	sort.SliceStable(params, func(i, j int) bool { return params[i].name < params[j].name })
+
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.raw
+	}
+	return strings.Join(parts, "&")
+}
+
+// normalizeEscapes decodes escaped unreserved characters and uppercases the hex digits of the rest.
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		hi, lo := unhex(s[i+1]), unhex(s[i+2])
+		if hi < 0 || lo < 0 {
+			b.WriteByte(s[i])
+			continue
+		}
+		if c := byte(hi<<4 | lo); isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteString(strings.ToUpper(s[i : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+// removeDotSegments resolves "." and ".." in an absolute path the way RFC 3986 does.
+func removeDotSegments(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	out := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, segment)
+			continue
+		}
+		if last {
+			out = append(out, "")
+		}
+	}
+	return strings.Join(out, "/")
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func unhex(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c-'a') + 10
+	case 'A' <= c && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return -1
+}
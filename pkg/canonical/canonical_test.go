@@ -0,0 +1,40 @@
+package canonical_test
+
+import (
+	"testing"
+
+	"github.com/kristina71/bitlytest/pkg/canonical"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUrl(t *testing.T) {
+	testCases := []struct {
+		name     string
+		raw      string
+		opts     canonical.Options
+		expected string
+	}{
+		{name: "Scheme, host and default port", raw: "HTTP://Example.COM:80/Path", expected: "http://example.com/Path"},
+		{name: "Default https port", raw: "https://example.com:443", expected: "https://example.com"},
+		{name: "Other port is kept", raw: "https://example.com:8443/x", expected: "https://example.com:8443/x"},
+		{name: "International host", raw: "https://Пример.рф/", expected: "https://xn--e1afmkfd.xn--p1ai/"},
+		{name: "Dot segments", raw: "http://example.com/a/./b/../c/.", expected: "http://example.com/a/c/"},
+		{name: "Dot segments above root", raw: "http://example.com/../a", expected: "http://example.com/a"},
+		{name: "Percent-encoding", raw: "http://example.com/%7euser/%2f%c3%a9?q=%7e%2f", expected: "http://example.com/~user/%2F%C3%A9?q=~%2F"},
+		{name: "Sorted query", raw: "http://example.com/?b=2&flag&a=1&b=1#Top", expected: "http://example.com/?a=1&b=2&b=1&flag#Top"},
+		{name: "Tracking kept by default", raw: "http://example.com/?utm_source=x&id=1", expected: "http://example.com/?id=1&utm_source=x"},
+		{name: "Tracking stripped", raw: "http://example.com/?utm_source=x&id=1&fbclid=y&gclid=z", opts: canonical.Options{StripTracking: true}, expected: "http://example.com/?id=1"},
+		{name: "Only tracking", raw: "http://example.com/a?utm_medium=x", opts: canonical.Options{StripTracking: true}, expected: "http://example.com/a"},
+		{name: "Relative url is untouched", raw: "/a/../b", expected: "/a/../b"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, err := canonical.Url(testCase.raw, testCase.opts)
+
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, actual)
+		})
+	}
+}
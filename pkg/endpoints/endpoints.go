@@ -5,12 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/kristina71/bitlytest/pkg/actor"
 	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/kristina71/bitlytest/pkg/qr"
 	"github.com/kristina71/bitlytest/pkg/requestparser"
 	"github.com/kristina71/bitlytest/pkg/service"
+	"github.com/kristina71/bitlytest/pkg/transfer"
 
 	"github.com/gorilla/mux"
 )
@@ -20,10 +25,41 @@ func New(service *service.Service) http.Handler {
 
 	e := endpoint{service: service}
 
+	r.Use(actor.Middleware)
+
 	r.HandleFunc("/all", e.GetAllUrl).Methods(http.MethodPost)
+	r.HandleFunc("/search", e.Search).Methods(http.MethodPost)
 	r.HandleFunc("/create", e.CreateUrl).Methods(http.MethodPost)
 	r.HandleFunc("/delete", e.DeleteUrl).Methods(http.MethodPost)
 	r.HandleFunc("/edit", e.UpdateUrl).Methods(http.MethodPost)
+	r.HandleFunc("/trash", e.GetTrash).Methods(http.MethodPost)
+	r.HandleFunc("/restore", e.RestoreUrl).Methods(http.MethodPost)
+	r.HandleFunc("/bulk/create", e.BulkCreateUrl).Methods(http.MethodPost)
+	r.HandleFunc("/bulk/delete", e.BulkDeleteUrl).Methods(http.MethodPost)
+	r.HandleFunc("/export", e.ExportUrls).Methods(http.MethodGet)
+	r.HandleFunc("/import", e.ImportUrls).Methods(http.MethodPost)
+	r.HandleFunc("/qr/{small:.+}", e.GetQrCode).Methods(http.MethodGet)
+	r.HandleFunc("/domains/all", e.GetDomains).Methods(http.MethodPost)
+	r.HandleFunc("/domains/add", e.AddDomain).Methods(http.MethodPost)
+	r.HandleFunc("/domains/edit", e.UpdateDomain).Methods(http.MethodPost)
+	r.HandleFunc("/domains/verify", e.VerifyDomain).Methods(http.MethodPost)
+	r.HandleFunc("/webhooks/all", e.GetWebhooks).Methods(http.MethodPost)
+	r.HandleFunc("/webhooks/add", e.AddWebhook).Methods(http.MethodPost)
+	r.HandleFunc("/webhooks/edit", e.UpdateWebhook).Methods(http.MethodPost)
+	r.HandleFunc("/webhooks/remove", e.RemoveWebhook).Methods(http.MethodPost)
+	r.HandleFunc("/webhooks/deliveries", e.GetDeliveries).Methods(http.MethodPost)
+	r.HandleFunc("/webhooks/retry", e.RetryDelivery).Methods(http.MethodPost)
+	r.HandleFunc("/aliases/all", e.GetAliases).Methods(http.MethodPost)
+	r.HandleFunc("/aliases/add", e.AddAlias).Methods(http.MethodPost)
+	r.HandleFunc("/aliases/remove", e.RemoveAlias).Methods(http.MethodPost)
+	r.HandleFunc("/geo/all", e.GetGeoRules).Methods(http.MethodPost)
+	r.HandleFunc("/geo/edit", e.SetGeoRules).Methods(http.MethodPost)
+	r.HandleFunc("/variants/all", e.GetVariants).Methods(http.MethodPost)
+	r.HandleFunc("/variants/edit", e.SetVariants).Methods(http.MethodPost)
+	r.HandleFunc("/history", e.GetHistory).Methods(http.MethodPost)
+	r.HandleFunc("/rollback", e.RollbackUrl).Methods(http.MethodPost)
+	r.HandleFunc("/stats", e.GetStats).Methods(http.MethodPost)
+	r.HandleFunc("/{small:.*}", e.Unlock).Methods(http.MethodPost)
 	r.HandleFunc("/{small:.*}", e.Get)
 
 	r.Handle("/", http.FileServer(http.Dir("./ui"))).Methods(http.MethodGet)
@@ -31,28 +67,210 @@ func New(service *service.Service) http.Handler {
 	staticDir := "/ui/js/"
 	r.PathPrefix(staticDir).Handler(http.StripPrefix(staticDir, http.FileServer(http.Dir("."+staticDir))))
 
+	service.Reserve(routedWords(r)...)
+
 	return r
 }
 
+// routedWords lists the first path segments the router serves itself, short codes must not take them.
+func routedWords(r *mux.Router) []string {
+	words := []string{}
+	r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+
+		word := strings.SplitN(strings.TrimPrefix(template, "/"), "/", 2)[0]
+		if word != "" && !strings.Contains(word, "{") {
+			words = append(words, word)
+		}
+		return nil
+	})
+	return words
+}
+
 type endpoint struct {
 	service *service.Service
 }
 
+// previewSuffix appended to a short link shows where it leads instead of redirecting.
+const previewSuffix = "+"
+
 func (e endpoint) Get(w http.ResponseWriter, r *http.Request) {
 	url := models.Url{}
+	url.Domain = requestHost(r)
 	url.SmallUrl = strings.Trim(r.URL.Path, "/")
 
+	preview := strings.HasSuffix(url.SmallUrl, previewSuffix)
+	url.SmallUrl = strings.TrimSuffix(url.SmallUrl, previewSuffix)
+
 	url, err := e.service.GetUrl(r.Context(), url)
+	inactive := models.Inactive{}
+	notFound := models.NotFound{}
+	switch {
+	case errors.As(err, &notFound) && notFound.FallbackUrl != "":
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, notFound.FallbackUrl, http.StatusFound)
+		return
+	case errors.As(err, &inactive) && inactive.FallbackUrl != "":
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, inactive.FallbackUrl, http.StatusFound)
+		return
+	case errors.As(err, &inactive):
+		renderInactive(w, inactive)
+		return
+	case err != nil:
+		reportError(err, w)
+		return
+	}
+
+	if !e.isUnlocked(r, url) {
+		renderUnlock(w, http.StatusUnauthorized, url, "")
+		return
+	}
+
+	destination, err := e.service.Destination(r.Context(), url, visitor(r, url))
+	if err != nil {
+		// Targeting is best effort, the origin url is still a valid answer.
+		log.Println(err)
+	}
+
+	if destination.VariantId != 0 {
+		http.SetCookie(w, &http.Cookie{
+			Name:     variantCookie(url),
+			Value:    strconv.FormatInt(destination.VariantId, 10),
+			Path:     "/",
+			MaxAge:   variantCookieMaxAge,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	if preview || url.AlwaysPreview {
+		renderPreview(w, url, destination.Url)
+		return
+	}
+
+	if err = e.service.RecordClick(r.Context(), url, destination); err != nil {
+		log.Println(err)
+	}
+
+	redirect(w, r, url, destination.Url)
+}
+
+func (e endpoint) Unlock(w http.ResponseWriter, r *http.Request) {
+	url := models.Url{}
+	url.Domain = requestHost(r)
+	url.SmallUrl = strings.TrimSuffix(strings.Trim(r.URL.Path, "/"), previewSuffix)
+
+	url, err := e.service.UnlockUrl(r.Context(), url, r.PostFormValue("password"), clientIP(r))
+	if err != nil {
+		tooMany := models.TooManyRequests{}
+		switch {
+		case errors.As(err, &models.Unauthorized{}):
+			renderUnlock(w, http.StatusUnauthorized, url, "Wrong password")
+		case errors.As(err, &tooMany):
+			w.Header().Set("Retry-After", strconv.Itoa(int(tooMany.RetryAfter.Seconds())+1))
+			renderUnlock(w, http.StatusTooManyRequests, url, "Too many attempts, try again later")
+		default:
+			reportError(err, w)
+		}
+		return
+	}
+
+	token, expires := e.service.UnlockToken(url)
+	http.SetCookie(w, &http.Cookie{
+		Name:     unlockCookie(url),
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+}
+
+func (e endpoint) isUnlocked(r *http.Request, url models.Url) bool {
+	if url.PasswordHash == "" {
+		return true
+	}
+
+	cookie, err := r.Cookie(unlockCookie(url))
+	if err != nil {
+		return false
+	}
+	return e.service.IsUnlocked(url, cookie.Value)
+}
+
+func unlockCookie(url models.Url) string {
+	return "unlock_" + strconv.Itoa(int(url.Id))
+}
+
+// variantCookieMaxAge keeps a visitor on the same split variant for the length of a typical experiment.
+const variantCookieMaxAge = 30 * 24 * 60 * 60
+
+func variantCookie(url models.Url) string {
+	return "ab_" + strconv.Itoa(int(url.Id))
+}
+
+// permanentRedirectMaxAge bounds how long browsers keep 301 and 308 answers, so edits still reach returning visitors.
+const permanentRedirectMaxAge = 24 * 60 * 60
+
+func redirect(w http.ResponseWriter, r *http.Request, url models.Url, destination string) {
+	switch url.RedirectType {
+	case models.RedirectMetaRefresh:
+		renderRedirect(w, destination, true)
+	case models.RedirectJavaScript:
+		renderRedirect(w, destination, false)
+	case models.RedirectMovedPermanently, models.RedirectPermanent:
+		code, _ := strconv.Atoi(url.RedirectType)
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", permanentRedirectMaxAge))
+		http.Redirect(w, r, destination, code)
+	case models.RedirectFound, models.RedirectTemporary:
+		code, _ := strconv.Atoi(url.RedirectType)
+		w.Header().Set("Cache-Control", "private, no-cache, no-store, must-revalidate")
+		http.Redirect(w, r, destination, code)
+	default:
+		http.Redirect(w, r, destination, http.StatusPermanentRedirect)
+	}
+}
+
+func (e endpoint) GetQrCode(w http.ResponseWriter, r *http.Request) {
+	opts, err := qr.ParseOptions(r.URL.Query())
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	url := models.Url{}
+	url.Domain = requestHost(r)
+	url.SmallUrl = strings.Trim(mux.Vars(r)["small"], "/")
+
+	// Codes for scheduled links are printed before launch, so the activation window is not checked here.
+	url, err = e.service.GetUrl(r.Context(), url)
+	if err != nil && !errors.As(err, &models.Inactive{}) {
+		reportError(err, w)
+		return
+	}
+
+	b, err := qr.Encode(shortLink(r, url), opts)
 	if err != nil {
 		reportError(err, w)
 		return
 	}
 
-	http.Redirect(w, r, url.OriginUrl, http.StatusPermanentRedirect)
+	w.Header().Set("Content-Type", qr.ContentType(opts.Format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s.%s\"", url.SmallUrl, opts.Format))
+	w.Write(b)
 }
 
 func (e endpoint) GetAllUrl(w http.ResponseWriter, r *http.Request) {
-	urls, err := e.service.GetAllUrl(r.Context())
+	filter := requestparser.ParseFilter(r)
+
+	urls, err := e.service.GetAllUrl(r.Context(), filter)
 	if err != nil {
 		reportError(err, w)
 		return
@@ -67,16 +285,13 @@ func (e endpoint) GetAllUrl(w http.ResponseWriter, r *http.Request) {
 }
 
 func (e endpoint) CreateUrl(w http.ResponseWriter, r *http.Request) {
-	url, resp, err := requestparser.Unmarshal(w, r)
-	fmt.Println(string(resp))
+	url, _, err := requestparser.Unmarshal(w, r)
 
 	if err != nil {
 		reportError(err, w)
 		return
 	}
 
-	fmt.Println(url)
-
 	url, err = e.service.CreateUrl(r.Context(), url)
 
 	if err != nil {
@@ -93,15 +308,66 @@ func (e endpoint) CreateUrl(w http.ResponseWriter, r *http.Request) {
 	w.Write(b)
 }
 
-func (e endpoint) UpdateUrl(w http.ResponseWriter, r *http.Request) {
+func (e endpoint) Search(w http.ResponseWriter, r *http.Request) {
+	search := requestparser.ParseSearch(r)
+
+	results, err := e.service.Search(r.Context(), search)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(results)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) GetTrash(w http.ResponseWriter, r *http.Request) {
+	urls, err := e.service.GetTrash(r.Context())
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(urls)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) RestoreUrl(w http.ResponseWriter, r *http.Request) {
 	url, _, err := requestparser.Unmarshal(w, r)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
 
+	url, err = e.service.RestoreUrl(r.Context(), url)
 	if err != nil {
 		reportError(err, w)
 		return
 	}
 
-	fmt.Println(url)
+	b, err := json.Marshal(url)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) UpdateUrl(w http.ResponseWriter, r *http.Request) {
+	url, err := requestparser.UnmarshalUpdate(w, r)
+
+	if err != nil {
+		reportError(err, w)
+		return
+	}
 
 	url, err = e.service.UpdateUrl(r.Context(), url)
 	if err != nil {
@@ -124,14 +390,554 @@ func (e endpoint) DeleteUrl(w http.ResponseWriter, r *http.Request) {
 		reportError(err, w)
 		return
 	}
-	fmt.Println(url)
-	fmt.Println(url.Id)
 
 	err = e.service.DeleteUrl(r.Context(), url)
 
 	reportError(err, w)
 }
 
+func (e endpoint) BulkCreateUrl(w http.ResponseWriter, r *http.Request) {
+	urls, err := requestparser.UnmarshalList(w, r)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	results, err := e.service.BulkCreateUrl(r.Context(), urls)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(results)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) BulkDeleteUrl(w http.ResponseWriter, r *http.Request) {
+	urls, err := requestparser.UnmarshalList(w, r)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	results, err := e.service.BulkDeleteUrl(r.Context(), urls)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(results)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) ExportUrls(w http.ResponseWriter, r *http.Request) {
+	format := transfer.Format(r.URL.Query().Get("format"))
+	if format == "" {
+		format = transfer.JSON
+	}
+
+	encoder, err := transfer.NewEncoder(w, format)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", transfer.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"links.%s\"", format))
+
+	err = e.service.ExportUrls(r.Context(), encoder.Encode)
+	if err != nil {
+		// Headers and part of the body are already sent, so the response can only be cut short.
+		log.Println(err)
+		return
+	}
+
+	if err = encoder.Close(); err != nil {
+		log.Println(err)
+	}
+}
+
+func (e endpoint) ImportUrls(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := transfer.Format(query.Get("format"))
+	if format == "" {
+		format = transfer.JSON
+	}
+
+	opts := models.ImportOptions{Conflict: query.Get("conflict")}
+	opts.DryRun, _ = strconv.ParseBool(query.Get("dry_run"))
+
+	urls, err := transfer.Decode(r.Body, format)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	report, err := e.service.ImportUrls(r.Context(), urls, opts)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) GetGeoRules(w http.ResponseWriter, r *http.Request) {
+	url, _, err := requestparser.Unmarshal(w, r)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	rules, err := e.service.GetGeoRules(r.Context(), url)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(rules)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) SetGeoRules(w http.ResponseWriter, r *http.Request) {
+	geoRules := models.GeoRules{}
+	err := requestparser.UnmarshalBody(r, &geoRules)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	rules, err := e.service.SetGeoRules(r.Context(), geoRules)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(rules)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) GetVariants(w http.ResponseWriter, r *http.Request) {
+	url, _, err := requestparser.Unmarshal(w, r)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	variants, err := e.service.GetVariants(r.Context(), url)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(variants)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) SetVariants(w http.ResponseWriter, r *http.Request) {
+	variants := models.Variants{}
+	err := requestparser.UnmarshalBody(r, &variants)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	saved, err := e.service.SetVariants(r.Context(), variants)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(saved)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) GetDomains(w http.ResponseWriter, r *http.Request) {
+	domains, err := e.service.GetDomains(r.Context())
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(domains)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) AddDomain(w http.ResponseWriter, r *http.Request) {
+	domain := models.Domain{}
+	err := requestparser.UnmarshalBody(r, &domain)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	domain, err = e.service.AddDomain(r.Context(), domain)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(domain)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) UpdateDomain(w http.ResponseWriter, r *http.Request) {
+	domain := models.Domain{}
+	err := requestparser.UnmarshalBody(r, &domain)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	domain, err = e.service.UpdateDomain(r.Context(), domain)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(domain)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) VerifyDomain(w http.ResponseWriter, r *http.Request) {
+	domain := models.Domain{}
+	err := requestparser.UnmarshalBody(r, &domain)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	domain, err = e.service.VerifyDomain(r.Context(), domain)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(domain)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := e.service.GetWebhooks(r.Context())
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(webhooks)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) AddWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook := models.Webhook{}
+	err := requestparser.UnmarshalBody(r, &webhook)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	webhook, err = e.service.AddWebhook(r.Context(), webhook)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(webhook)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook := models.Webhook{}
+	err := requestparser.UnmarshalBody(r, &webhook)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	webhook, err = e.service.UpdateWebhook(r.Context(), webhook)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(webhook)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) RemoveWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook := models.Webhook{}
+	err := requestparser.UnmarshalBody(r, &webhook)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	err = e.service.RemoveWebhook(r.Context(), webhook)
+
+	reportError(err, w)
+}
+
+func (e endpoint) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	filter := requestparser.ParseDeliveryFilter(r)
+
+	deliveries, err := e.service.GetDeliveries(r.Context(), filter)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(deliveries)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) RetryDelivery(w http.ResponseWriter, r *http.Request) {
+	delivery := models.Delivery{}
+	err := requestparser.UnmarshalBody(r, &delivery)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	delivery, err = e.service.RetryDelivery(r.Context(), delivery)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(delivery)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) GetAliases(w http.ResponseWriter, r *http.Request) {
+	url, _, err := requestparser.Unmarshal(w, r)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	aliases, err := e.service.GetAliases(r.Context(), url)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(aliases)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) AddAlias(w http.ResponseWriter, r *http.Request) {
+	alias := models.Alias{}
+	err := requestparser.UnmarshalBody(r, &alias)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	alias, err = e.service.AddAlias(r.Context(), alias)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(alias)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) RemoveAlias(w http.ResponseWriter, r *http.Request) {
+	alias := models.Alias{}
+	err := requestparser.UnmarshalBody(r, &alias)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	err = e.service.RemoveAlias(r.Context(), alias)
+
+	reportError(err, w)
+}
+
+func (e endpoint) GetHistory(w http.ResponseWriter, r *http.Request) {
+	url, _, err := requestparser.Unmarshal(w, r)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	versions, err := e.service.GetHistory(r.Context(), url)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(versions)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) RollbackUrl(w http.ResponseWriter, r *http.Request) {
+	rollback := models.Rollback{}
+	err := requestparser.UnmarshalBody(r, &rollback)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	url, err := e.service.RollbackUrl(r.Context(), rollback)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(url)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func (e endpoint) GetStats(w http.ResponseWriter, r *http.Request) {
+	url, _, err := requestparser.Unmarshal(w, r)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	stats, err := e.service.GetStats(r.Context(), url)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+
+	b, err := json.Marshal(stats)
+	if err != nil {
+		reportError(err, w)
+		return
+	}
+	w.Write(b)
+}
+
+func shortLink(r *http.Request, url models.Url) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+	if url.Domain != "" {
+		host = url.Domain
+	}
+	return scheme + "://" + host + "/" + url.SmallUrl
+}
+
+// requestHost is the host name a request was sent to, without the port.
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+func visitor(r *http.Request, url models.Url) models.Visitor {
+	v := models.Visitor{
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		Query:     r.URL.Query(),
+	}
+
+	// A cookie that is not a variant id is ignored, the visitor is then picked a variant anew.
+	if cookie, err := r.Cookie(variantCookie(url)); err == nil {
+		if id, err := strconv.ParseInt(cookie.Value, 10, 64); err == nil && id > 0 {
+			v.VariantId = id
+		}
+	}
+	return v
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func reportError(err error, w http.ResponseWriter) {
 	if err != nil {
 		log.Println(err)
@@ -140,8 +946,14 @@ func reportError(err error, w http.ResponseWriter) {
 		switch {
 		case errors.As(err, &models.NotFound{}):
 			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.As(err, &models.Gone{}):
+			http.Error(w, err.Error(), http.StatusGone)
 		case errors.As(err, &models.BadRequest{}):
 			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.As(err, &models.Unauthorized{}):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		case errors.As(err, &models.TooManyRequests{}):
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
 		default:
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
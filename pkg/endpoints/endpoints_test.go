@@ -0,0 +1,240 @@
+package endpoints_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kristina71/bitlytest/mocks"
+	"github.com/kristina71/bitlytest/pkg/config"
+	"github.com/kristina71/bitlytest/pkg/endpoints"
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/kristina71/bitlytest/pkg/service"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// handler serves the api over the mocked repository. Requests go to a host that is not a custom domain.
+func handler(repo *mocks.Repository, cfg config.Cfg) http.Handler {
+	repo.On("GetDomain", mock.Anything, mock.Anything).Return(models.Domain{}, models.NotFoundError())
+	return endpoints.New(service.New(repo, cfg))
+}
+
+// visitable makes url resolvable and leads visitors to its origin url.
+func visitable(repo *mocks.Repository, url models.Url) {
+	repo.On("GetBySmallUrl", mock.Anything, models.Url{SmallUrl: url.SmallUrl}).Return(url, nil)
+	repo.On("GetDeviceRules", mock.Anything, url).Return([]models.DeviceRule{}, nil)
+	repo.On("GetGeoRules", mock.Anything, url).Return([]models.GeoRule{}, nil)
+	repo.On("GetVariants", mock.Anything, url).Return([]models.Variant{}, nil)
+	repo.On("QueueClick", mock.Anything, url, url.OriginUrl).Return(nil)
+}
+
+func get(h http.Handler, path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestPreview(t *testing.T) {
+	repo := &mocks.Repository{}
+	h := handler(repo, config.New())
+
+	url := models.Url{Id: 1, SmallUrl: "abc", OriginUrl: "http://google.com/search", RedirectType: models.RedirectFound}
+	always := models.Url{Id: 2, SmallUrl: "look", OriginUrl: "http://yandex.ru", RedirectType: models.RedirectFound, AlwaysPreview: true}
+	visitable(repo, url)
+	visitable(repo, always)
+
+	w := get(h, "/abc+")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	require.Contains(t, w.Body.String(), "http://google.com/search")
+	require.Contains(t, w.Body.String(), "Continue to google.com")
+
+	w = get(h, "/look")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "Continue to yandex.ru")
+
+	// Previews are not clicks.
+	repo.AssertNotCalled(t, "QueueClick", mock.Anything, mock.Anything, mock.Anything)
+
+	w = get(h, "/abc")
+	require.Equal(t, http.StatusFound, w.Code)
+	require.Equal(t, "http://google.com/search", w.Header().Get("Location"))
+	repo.AssertNumberOfCalls(t, "QueueClick", 1)
+}
+
+func TestRedirectTypes(t *testing.T) {
+	testCases := []struct {
+		redirectType string
+		code         int
+		cacheControl string
+		body         string
+	}{
+		{redirectType: models.RedirectMovedPermanently, code: http.StatusMovedPermanently, cacheControl: "public, max-age=86400"},
+		{redirectType: models.RedirectPermanent, code: http.StatusPermanentRedirect, cacheControl: "public, max-age=86400"},
+		{redirectType: models.RedirectFound, code: http.StatusFound, cacheControl: "private, no-cache, no-store, must-revalidate"},
+		{redirectType: models.RedirectTemporary, code: http.StatusTemporaryRedirect, cacheControl: "private, no-cache, no-store, must-revalidate"},
+		{redirectType: models.RedirectMetaRefresh, code: http.StatusOK, cacheControl: "no-store", body: `http-equiv="refresh"`},
+		{redirectType: models.RedirectJavaScript, code: http.StatusOK, cacheControl: "no-store", body: "window.location"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.redirectType, func(t *testing.T) {
+			repo := &mocks.Repository{}
+			h := handler(repo, config.New())
+			visitable(repo, models.Url{Id: 1, SmallUrl: "abc", OriginUrl: "http://google.com", RedirectType: testCase.redirectType})
+
+			w := get(h, "/abc")
+			require.Equal(t, testCase.code, w.Code)
+			require.Equal(t, testCase.cacheControl, w.Header().Get("Cache-Control"))
+			if testCase.body == "" {
+				require.Equal(t, "http://google.com", w.Header().Get("Location"))
+			} else {
+				require.Contains(t, w.Body.String(), testCase.body)
+				require.Contains(t, w.Body.String(), "http://google.com")
+			}
+		})
+	}
+}
+
+func unlock(h http.Handler, path, password string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(neturl.Values{"password": {password}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestUnlock(t *testing.T) {
+	repo := &mocks.Repository{}
+	cfg := config.New()
+	cfg.CookieSecret = "secret"
+	cfg.UnlockMaxAttempts = 2
+	h := handler(repo, cfg)
+
+	url := models.Url{Id: 4, SmallUrl: "secret", OriginUrl: "http://google.com", RedirectType: models.RedirectFound, PasswordHash: "hash"}
+	visitable(repo, url)
+	repo.On("ComparePassword", mock.Anything, "hash", "qwerty").Return(true)
+	repo.On("ComparePassword", mock.Anything, "hash", "wrong").Return(false)
+
+	w := get(h, "/secret")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	require.Contains(t, w.Body.String(), `type="password"`)
+
+	w = unlock(h, "/secret", "wrong")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Contains(t, w.Body.String(), "Wrong password")
+	require.Empty(t, w.Result().Cookies())
+
+	w = unlock(h, "/secret", "qwerty")
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "/secret", w.Header().Get("Location"))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	require.Equal(t, "unlock_4", cookies[0].Name)
+	require.True(t, cookies[0].HttpOnly)
+
+	w = get(h, "/secret", cookies[0])
+	require.Equal(t, http.StatusFound, w.Code)
+	require.Equal(t, "http://google.com", w.Header().Get("Location"))
+
+	// A forged token does not unlock it.
+	w = get(h, "/secret", &http.Cookie{Name: "unlock_4", Value: "9999999999.forged"})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Attempts are throttled per client and link.
+	unlock(h, "/secret", "wrong")
+	unlock(h, "/secret", "wrong")
+	w = unlock(h, "/secret", "qwerty")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func TestInactive(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+	scheduled := models.Url{Id: 1, SmallUrl: "soon", OriginUrl: "http://google.com", ActiveFrom: &future}
+	ended := models.Url{Id: 2, SmallUrl: "over", OriginUrl: "http://google.com", ActiveUntil: &past}
+
+	repo := &mocks.Repository{}
+	h := handler(repo, config.New())
+	repo.On("GetBySmallUrl", mock.Anything, models.Url{SmallUrl: "soon"}).Return(scheduled, nil)
+	repo.On("GetBySmallUrl", mock.Anything, models.Url{SmallUrl: "over"}).Return(ended, nil)
+
+	w := get(h, "/soon")
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	require.Contains(t, w.Body.String(), "not active yet")
+
+	w = get(h, "/over")
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Contains(t, w.Body.String(), "This link has ended")
+
+	cfg := config.New()
+	cfg.InactiveFallbackUrl = "http://fallback.com"
+	repo = &mocks.Repository{}
+	h = handler(repo, cfg)
+	repo.On("GetBySmallUrl", mock.Anything, models.Url{SmallUrl: "over"}).Return(ended, nil)
+
+	w = get(h, "/over")
+	require.Equal(t, http.StatusFound, w.Code)
+	require.Equal(t, "http://fallback.com", w.Header().Get("Location"))
+	require.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	repo.AssertNotCalled(t, "QueueClick", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestVariantCookie(t *testing.T) {
+	url := models.Url{Id: 1, SmallUrl: "split", OriginUrl: "http://google.com", RedirectType: models.RedirectFound}
+	variants := []models.Variant{
+		{Id: 70001, UrlId: 1, TargetUrl: "http://a.com", Weight: 1},
+		{Id: 70002, UrlId: 1, TargetUrl: "http://b.com", Weight: 1},
+	}
+
+	repo := &mocks.Repository{}
+	h := handler(repo, config.New())
+	repo.On("GetBySmallUrl", mock.Anything, models.Url{SmallUrl: "split"}).Return(url, nil)
+	repo.On("GetDeviceRules", mock.Anything, url).Return([]models.DeviceRule{}, nil)
+	repo.On("GetGeoRules", mock.Anything, url).Return([]models.GeoRule{}, nil)
+	repo.On("GetVariants", mock.Anything, url).Return(variants, nil)
+	repo.On("IncrementVariantClicks", mock.Anything, mock.Anything).Return(nil)
+	repo.On("QueueClick", mock.Anything, url, mock.Anything).Return(nil)
+
+	// Variant ids past 65535 keep returning visitors on their variant.
+	w := get(h, "/split", &http.Cookie{Name: "ab_1", Value: "70002"})
+	require.Equal(t, http.StatusFound, w.Code)
+	require.Equal(t, "http://b.com", w.Header().Get("Location"))
+	require.Equal(t, "70002", w.Result().Cookies()[0].Value)
+	repo.AssertCalled(t, "IncrementVariantClicks", mock.Anything, models.Variant{Id: 70002, UrlId: 1})
+
+	// A cookie out of range is ignored rather than wrapped around to another variant.
+	w = get(h, "/split", &http.Cookie{Name: "ab_1", Value: "18446744073709621618"})
+	require.Equal(t, http.StatusFound, w.Code)
+	require.Contains(t, []string{"70001", "70002"}, w.Result().Cookies()[0].Value)
+}
+
+func TestEditKeepsOmittedSettings(t *testing.T) {
+	repo := &mocks.Repository{}
+	h := handler(repo, config.New())
+	omitted := []string{models.SettingAlwaysPreview, models.SettingActiveFrom, models.SettingActiveUntil, models.SettingUtmSource, models.SettingUtmMedium, models.SettingUtmCampaign}
+	repo.On("ValidateUrl", mock.Anything, "http://google.com").Return(true)
+	repo.On("Update", mock.Anything, mock.MatchedBy(func(url models.Url) bool {
+		return url.Title == "Sale" && strings.Join(url.Omitted, ",") == strings.Join(omitted, ",")
+	})).Return(nil)
+	repo.On("SetTags", mock.Anything, mock.Anything, []string{"promo"}).Return(nil)
+
+	// The edit form of the ui sends only these fields, the activation window and the rest stay as stored.
+	body := `{"id":3,"small_url":"sale","origin_url":"http://google.com","title":"Sale","tags":["promo"],"notes":""}`
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/edit", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code)
+	repo.AssertCalled(t, "Update", mock.Anything, mock.Anything)
+}
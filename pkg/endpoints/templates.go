@@ -0,0 +1,90 @@
+package endpoints
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"log"
+	"net/http"
+	neturl "net/url"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+var templates = template.Must(template.ParseFS(templateFiles, "templates/*.html"))
+
+func renderTemplate(w http.ResponseWriter, status int, name string, data interface{}) {
+	buf := &bytes.Buffer{}
+	if err := templates.ExecuteTemplate(buf, name, data); err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+type previewPage struct {
+	Title       string
+	Url         models.Url
+	Destination string
+	Domain      string
+}
+
+func renderPreview(w http.ResponseWriter, url models.Url, destination string) {
+	page := previewPage{
+		Title:       "Preview /" + url.SmallUrl,
+		Url:         url,
+		Destination: destination,
+		Domain:      destination,
+	}
+	if parsed, err := neturl.Parse(destination); err == nil && parsed.Host != "" {
+		page.Domain = parsed.Hostname()
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	renderTemplate(w, http.StatusOK, "preview", page)
+}
+
+type redirectPage struct {
+	Destination string
+	Meta        bool
+}
+
+func renderRedirect(w http.ResponseWriter, destination string, meta bool) {
+	w.Header().Set("Cache-Control", "no-store")
+	renderTemplate(w, http.StatusOK, "redirect", redirectPage{Destination: destination, Meta: meta})
+}
+
+type unlockPage struct {
+	Title string
+	Url   models.Url
+	Error string
+}
+
+func renderUnlock(w http.ResponseWriter, status int, url models.Url, message string) {
+	w.Header().Set("Cache-Control", "no-store")
+	renderTemplate(w, status, "unlock", unlockPage{Title: "Protected link", Url: url, Error: message})
+}
+
+type inactivePage struct {
+	Title     string
+	Url       models.Url
+	Scheduled bool
+}
+
+func renderInactive(w http.ResponseWriter, inactive models.Inactive) {
+	page := inactivePage{
+		Title:     inactive.Error(),
+		Url:       inactive.Url,
+		Scheduled: inactive.Status == models.StatusScheduled,
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	renderTemplate(w, http.StatusNotFound, "inactive", page)
+}
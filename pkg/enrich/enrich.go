@@ -0,0 +1,135 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"strings"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"golang.org/x/net/html"
+)
+
+// Fetcher downloads destination pages and extracts what is worth showing next to a link.
+type Fetcher struct {
+	Client *http.Client
+	// MaxBytes caps how much of a page is read, metadata lives in the head anyway.
+	MaxBytes int64
+}
+
+func New(client *http.Client, maxBytes int64) *Fetcher {
+	return &Fetcher{Client: client, MaxBytes: maxBytes}
+}
+
+// Fetch reads the page at url and returns its title, description, Open Graph image and favicon.
+// Relative references are resolved against the final url after redirects.
+func (f *Fetcher) Fetch(ctx context.Context, url string) (models.PageMeta, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return models.PageMeta{}, err
+	}
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return models.PageMeta{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return models.PageMeta{}, fmt.Errorf("fetch %s: status %d", url, resp.StatusCode)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return models.PageMeta{}, fmt.Errorf("fetch %s: not an html page: %s", url, mediaType)
+	}
+
+	meta := Parse(io.LimitReader(resp.Body, f.MaxBytes))
+	base := resp.Request.URL
+
+	meta.ImageUrl = resolve(base, meta.ImageUrl)
+	if meta.FaviconUrl == "" {
+		meta.FaviconUrl = "/favicon.ico"
+	}
+	meta.FaviconUrl = resolve(base, meta.FaviconUrl)
+	return meta, nil
+}
+
+// Parse extracts page metadata from html, stopping at the end of the head.
+// References are returned as found in the document.
+func Parse(r io.Reader) models.PageMeta {
+	meta := models.PageMeta{}
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return meta
+		case html.TextToken:
+			if inTitle && meta.Title == "" {
+				meta.Title = strings.Join(strings.Fields(string(tokenizer.Text())), " ")
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return meta
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			attrs := map[string]string{}
+			for hasAttr {
+				var key, value []byte
+				key, value, hasAttr = tokenizer.TagAttr()
+				attrs[string(key)] = string(value)
+			}
+
+			switch string(name) {
+			case "title":
+				inTitle = true
+			case "meta":
+				content := strings.TrimSpace(attrs["content"])
+				switch {
+				case strings.EqualFold(attrs["name"], "description") && meta.Description == "":
+					meta.Description = content
+				case strings.EqualFold(attrs["property"], "og:image") && meta.ImageUrl == "":
+					meta.ImageUrl = content
+				case strings.EqualFold(attrs["property"], "og:title") && meta.Title == "":
+					meta.Title = content
+				}
+			case "link":
+				if isIcon(attrs["rel"]) && meta.FaviconUrl == "" {
+					meta.FaviconUrl = strings.TrimSpace(attrs["href"])
+				}
+			case "body":
+				return meta
+			}
+		}
+	}
+}
+
+func isIcon(rel string) bool {
+	for _, value := range strings.Fields(strings.ToLower(rel)) {
+		if value == "icon" {
+			return true
+		}
+	}
+	return false
+}
+
+func resolve(base *neturl.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	parsed, err := neturl.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(parsed).String()
+}
@@ -0,0 +1,119 @@
+package enrich_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/enrich"
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+const page = `<!DOCTYPE html>
+<html>
+<head>
+	<title>
+		Spring   sale
+	</title>
+	<meta name="Description" content=" Everything half price ">
+	<meta property="og:image" content="/img/cover.png">
+	<link rel="shortcut icon" href="static/icon.png">
+</head>
+<body><title>Not this one</title></body>
+</html>`
+
+func TestFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sale/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/sale/", http.StatusFound)
+	})
+	mux.HandleFunc("/bare", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>Bare</title></head></html>"))
+	})
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><!--" + strings.Repeat("x", 4096) + "--><title>Too late</title></head></html>"))
+	})
+	mux.HandleFunc("/file.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-1.4"))
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	fetcher := enrich.New(&http.Client{Timeout: 100 * time.Millisecond}, 1024)
+
+	testCases := []struct {
+		name     string
+		path     string
+		expected models.PageMeta
+		wantErr  bool
+	}{
+		{
+			name: "Full page",
+			path: "/sale/",
+			expected: models.PageMeta{
+				Title:       "Spring sale",
+				Description: "Everything half price",
+				ImageUrl:    server.URL + "/img/cover.png",
+				FaviconUrl:  server.URL + "/sale/static/icon.png",
+			},
+		},
+		{
+			name: "Resolved against final url",
+			path: "/moved",
+			expected: models.PageMeta{
+				Title:       "Spring sale",
+				Description: "Everything half price",
+				ImageUrl:    server.URL + "/img/cover.png",
+				FaviconUrl:  server.URL + "/sale/static/icon.png",
+			},
+		},
+		{
+			name:     "Default favicon",
+			path:     "/bare",
+			expected: models.PageMeta{Title: "Bare", FaviconUrl: server.URL + "/favicon.ico"},
+		},
+		{
+			name:     "Size limit",
+			path:     "/big",
+			expected: models.PageMeta{FaviconUrl: server.URL + "/favicon.ico"},
+		},
+		{name: "Not html", path: "/file.pdf", wantErr: true},
+		{name: "Not found", path: "/missing", wantErr: true},
+		{name: "Timeout", path: "/slow", wantErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			meta, err := fetcher.Fetch(context.Background(), server.URL+testCase.path)
+			if testCase.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, meta)
+		})
+	}
+}
+
+func TestParseOpenGraphTitle(t *testing.T) {
+	meta := enrich.Parse(strings.NewReader(`<head><meta property="og:title" content="From OG"></head>`))
+	require.Equal(t, "From OG", meta.Title)
+}
@@ -0,0 +1,139 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+)
+
+const (
+	TypeLinkCreated = "LinkCreated"
+	TypeLinkUpdated = "LinkUpdated"
+	TypeLinkDeleted = "LinkDeleted"
+)
+
+// What a LinkUpdated event reports as changed, besides the versioned actions.
+const (
+	ChangeTags        = "tags"
+	ChangeGeoRules    = "geo_rules"
+	ChangeDeviceRules = "device_rules"
+	ChangeVariants    = "variants"
+	ChangeAliases     = "aliases"
+)
+
+// Event is a typed change of a link.
+type Event interface {
+	EventType() string
+	EventMeta() Meta
+}
+
+// Meta is what every event carries.
+type Meta struct {
+	LinkId     uint16    `json:"link_id"`
+	Domain     string    `json:"domain,omitempty"`
+	Actor      string    `json:"actor"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+func (m Meta) EventMeta() Meta {
+	return m
+}
+
+type LinkCreated struct {
+	Meta
+	Link *models.Snapshot `json:"link"`
+}
+
+func (LinkCreated) EventType() string {
+	return TypeLinkCreated
+}
+
+// LinkUpdated reports a change of a live link. Change is the action of a versioned change, with the
+// settings before and after it, or one of the Change constants for settings that are not versioned.
+type LinkUpdated struct {
+	Meta
+	Change   string           `json:"change"`
+	Previous *models.Snapshot `json:"previous,omitempty"`
+	Link     *models.Snapshot `json:"link,omitempty"`
+}
+
+func (LinkUpdated) EventType() string {
+	return TypeLinkUpdated
+}
+
+// LinkDeleted reports a link moved to the trash, with its last settings. Purged is set when the link
+// is removed from the trash for good.
+type LinkDeleted struct {
+	Meta
+	Previous *models.Snapshot `json:"previous"`
+	Purged   bool             `json:"purged,omitempty"`
+}
+
+func (LinkDeleted) EventType() string {
+	return TypeLinkDeleted
+}
+
+// Of returns the events of a change recorded with action. old has the urls before the change and is nil
+// for created links, updated has them after it and is nil for deleted links.
+func Of(action, actor string, at time.Time, old, updated []models.Url) []Event {
+	links := updated
+	if links == nil {
+		links = old
+	}
+
+	events := make([]Event, 0, len(links))
+	for i, url := range links {
+		meta := Meta{LinkId: url.Id, Domain: url.Domain, Actor: actor, OccurredAt: at}
+		switch {
+		case action == models.ActionCreate:
+			events = append(events, LinkCreated{Meta: meta, Link: models.SnapshotOf(updated[i])})
+		case action == models.ActionDelete:
+			events = append(events, LinkDeleted{Meta: meta, Previous: models.SnapshotOf(old[i])})
+		default:
+			event := LinkUpdated{Meta: meta, Change: action}
+			if old != nil {
+				event.Previous = models.SnapshotOf(old[i])
+			}
+			if updated != nil {
+				event.Link = models.SnapshotOf(updated[i])
+			}
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// Purged returns the events of links removed from the trash for good.
+func Purged(actor string, at time.Time, urls []models.Url) []Event {
+	events := make([]Event, 0, len(urls))
+	for _, url := range urls {
+		meta := Meta{LinkId: url.Id, Domain: url.Domain, Actor: actor, OccurredAt: at}
+		events = append(events, LinkDeleted{Meta: meta, Previous: models.SnapshotOf(url), Purged: true})
+	}
+	return events
+}
+
+// Stored turns an event into its outbox row.
+func Stored(event Event) (models.LinkEvent, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return models.LinkEvent{}, err
+	}
+
+	meta := event.EventMeta()
+	return models.LinkEvent{
+		Type:       event.EventType(),
+		LinkId:     meta.LinkId,
+		Payload:    payload,
+		OccurredAt: meta.OccurredAt,
+	}, nil
+}
+
+// Publisher sends stored events somewhere outside the database. Publish returns once the events are
+// durably handed over; a failed call may have sent some of them, they are sent again by the relay.
+type Publisher interface {
+	Publish(ctx context.Context, events []models.LinkEvent) error
+	Close() error
+}
@@ -0,0 +1,188 @@
+package events_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/events"
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+var at = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func TestOf(t *testing.T) {
+	before := models.Url{Id: 7, SmallUrl: "sale", OriginUrl: "http://google.com"}
+	after := models.Url{Id: 7, SmallUrl: "sale", OriginUrl: "http://google.com/sale"}
+	meta := events.Meta{LinkId: 7, Actor: "crm", OccurredAt: at}
+
+	require.Equal(t, []events.Event{events.LinkCreated{Meta: meta, Link: models.SnapshotOf(after)}},
+		events.Of(models.ActionCreate, "crm", at, nil, []models.Url{after}))
+	require.Equal(t, []events.Event{events.LinkUpdated{Meta: meta, Change: models.ActionUpdate, Previous: models.SnapshotOf(before), Link: models.SnapshotOf(after)}},
+		events.Of(models.ActionUpdate, "crm", at, []models.Url{before}, []models.Url{after}))
+	require.Equal(t, []events.Event{events.LinkUpdated{Meta: meta, Change: models.ActionRestore, Link: models.SnapshotOf(after)}},
+		events.Of(models.ActionRestore, "crm", at, nil, []models.Url{after}))
+	require.Equal(t, []events.Event{events.LinkDeleted{Meta: meta, Previous: models.SnapshotOf(before)}},
+		events.Of(models.ActionDelete, "crm", at, []models.Url{before}, nil))
+	require.Equal(t, []events.Event{events.LinkDeleted{Meta: meta, Previous: models.SnapshotOf(before), Purged: true}},
+		events.Purged("crm", at, []models.Url{before}))
+}
+
+func TestStored(t *testing.T) {
+	event, err := events.Stored(events.LinkDeleted{Meta: events.Meta{LinkId: 7, Actor: "crm", OccurredAt: at}, Previous: &models.Snapshot{SmallUrl: "sale"}})
+	require.NoError(t, err)
+	require.Equal(t, events.TypeLinkDeleted, event.Type)
+	require.Equal(t, uint16(7), event.LinkId)
+	require.Equal(t, at, event.OccurredAt)
+
+	payload := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(event.Payload, &payload))
+	require.Equal(t, float64(7), payload["link_id"])
+	require.Equal(t, "sale", payload["previous"].(map[string]interface{})["small_url"])
+}
+
+func linkEvents() []models.LinkEvent {
+	return []models.LinkEvent{
+		{Id: 1, TxId: 10, Type: events.TypeLinkCreated, LinkId: 7, Payload: json.RawMessage(`{"link_id":7}`), OccurredAt: at},
+		{Id: 2, TxId: 11, Type: events.TypeLinkDeleted, LinkId: 7, Payload: json.RawMessage(`{"link_id":7}`), OccurredAt: at},
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+
+	sink, err := events.Open("file://"+path, "", time.Second)
+	require.NoError(t, err)
+	require.NoError(t, sink.Publish(context.Background(), linkEvents()[:1]))
+	require.NoError(t, sink.Publish(context.Background(), linkEvents()[1:]))
+	require.NoError(t, sink.Close())
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t,
+		`{"id":1,"type":"LinkCreated","link_id":7,"payload":{"link_id":7},"occurred_at":"2026-10-19T12:00:00Z"}`+"\n"+
+			`{"id":2,"type":"LinkDeleted","link_id":7,"payload":{"link_id":7},"occurred_at":"2026-10-19T12:00:00Z"}`+"\n",
+		string(content))
+}
+
+type published struct {
+	subject string
+	payload string
+}
+
+// natsServer accepts one client at a time and answers it the way a NATS server does.
+// reject makes it refuse the first PUB it sees.
+func natsServer(t *testing.T, reject bool) (string, <-chan published, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan published, 10)
+	connects := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			serveNats(conn, messages, connects, reject)
+			reject = false
+		}
+	}()
+
+	return listener.Addr().String(), messages, connects
+}
+
+func serveNats(conn net.Conn, messages chan<- published, connects chan<- string, reject bool) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"max_payload\":1048576}\r\n")
+
+	reader := bufio.NewReader(conn)
+	pinged := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case strings.HasPrefix(line, "CONNECT "):
+			connects <- strings.TrimPrefix(line, "CONNECT ")
+		case strings.HasPrefix(line, "PUB "):
+			fields := strings.Fields(line)
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			if _, err = io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			if reject {
+				fmt.Fprintf(conn, "-ERR 'Permissions Violation for Publish to %s'\r\n", fields[1])
+				return
+			}
+			messages <- published{subject: fields[1], payload: string(payload[:size])}
+		case line == "PING":
+			// Clients must answer the server's pings while they wait for their own pong.
+			if !pinged {
+				pinged = true
+				fmt.Fprintf(conn, "PING\r\n")
+				if pong, _ := reader.ReadString('\n'); pong != "PONG\r\n" {
+					return
+				}
+			}
+			fmt.Fprintf(conn, "PONG\r\n")
+		}
+	}
+}
+
+func TestNatsSink(t *testing.T) {
+	addr, messages, connects := natsServer(t, false)
+
+	sink, err := events.Open("nats://crm:s3cret@"+addr, "bitlytest.links", time.Second)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Publish(context.Background(), linkEvents()))
+	require.JSONEq(t, `{"verbose":false,"pedantic":false,"name":"bitlytest","lang":"go","user":"crm","pass":"s3cret"}`, <-connects)
+
+	first := <-messages
+	require.Equal(t, "bitlytest.links.LinkCreated", first.subject)
+	require.JSONEq(t, `{"id":1,"type":"LinkCreated","link_id":7,"payload":{"link_id":7},"occurred_at":"2026-10-19T12:00:00Z"}`, first.payload)
+	require.Equal(t, "bitlytest.links.LinkDeleted", (<-messages).subject)
+
+	// The connection is kept between batches.
+	require.NoError(t, sink.Publish(context.Background(), linkEvents()[:1]))
+	require.Equal(t, "bitlytest.links.LinkCreated", (<-messages).subject)
+	require.Len(t, connects, 0)
+}
+
+func TestNatsSinkError(t *testing.T) {
+	addr, messages, connects := natsServer(t, true)
+
+	sink, err := events.NewNatsSink("nats://"+addr, "bitlytest.links", time.Second)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	err = sink.Publish(context.Background(), linkEvents()[:1])
+	require.EqualError(t, err, "nats sink: 'Permissions Violation for Publish to bitlytest.links.LinkCreated'")
+	<-connects
+
+	// A failed batch is sent again on a new connection.
+	require.NoError(t, sink.Publish(context.Background(), linkEvents()[:1]))
+	<-connects
+	require.Equal(t, "bitlytest.links.LinkCreated", (<-messages).subject)
+
+	_, err = events.NewNatsSink("http://"+addr, "bitlytest.links", time.Second)
+	require.Error(t, err)
+}
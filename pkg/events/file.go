@@ -0,0 +1,48 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+)
+
+// FileSink appends events to a file as newline delimited json, one event per line.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file}, nil
+}
+
+// Publish writes the events and syncs the file, so they survive a crash once it returns.
+func (f *FileSink) Publish(ctx context.Context, events []models.LinkEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := bufio.NewWriter(f.file)
+	encoder := json.NewEncoder(w)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+func (f *FileSink) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,184 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+)
+
+const natsDefaultPort = "4222"
+
+// NatsSink publishes events to a NATS server, on Subject followed by the event type, for example
+// "bitlytest.links.LinkCreated". It speaks the plain text client protocol and needs no client library.
+type NatsSink struct {
+	Addr     string
+	Subject  string
+	User     string
+	Password string
+	Timeout  time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewNatsSink takes the server as nats://[user:password@]host[:port].
+func NewNatsSink(rawurl, subject string, timeout time.Duration) (*NatsSink, error) {
+	parsed, err := neturl.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "nats" || parsed.Hostname() == "" {
+		return nil, fmt.Errorf("nats sink: want nats://host:port, got %s", rawurl)
+	}
+
+	port := parsed.Port()
+	if port == "" {
+		port = natsDefaultPort
+	}
+
+	sink := &NatsSink{Addr: net.JoinHostPort(parsed.Hostname(), port), Subject: subject, Timeout: timeout}
+	if parsed.User != nil {
+		sink.User = parsed.User.Username()
+		sink.Password, _ = parsed.User.Password()
+	}
+	return sink, nil
+}
+
+// Publish sends the events and waits for the server to answer a PING sent after them, so they were all
+// accepted once it returns. The connection is dropped on any error and opened again on the next call.
+func (n *NatsSink) Publish(ctx context.Context, events []models.LinkEvent) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	err := n.publish(ctx, events)
+	if err != nil {
+		n.close()
+	}
+	return err
+}
+
+func (n *NatsSink) publish(ctx context.Context, events []models.LinkEvent) error {
+	if n.conn == nil {
+		if err := n.connect(ctx); err != nil {
+			return err
+		}
+	}
+	n.conn.SetDeadline(n.deadline(ctx))
+
+	w := bufio.NewWriter(n.conn)
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "PUB %s.%s %d\r\n", n.Subject, event.Type, len(payload))
+		w.Write(payload)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("PING\r\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return n.waitPong()
+}
+
+func (n *NatsSink) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: n.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", n.Addr)
+	if err != nil {
+		return err
+	}
+	n.conn = conn
+	n.reader = bufio.NewReader(conn)
+	conn.SetDeadline(n.deadline(ctx))
+
+	line, err := n.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("nats sink: unexpected greeting %q", line)
+	}
+
+	options, err := json.Marshal(struct {
+		Verbose  bool   `json:"verbose"`
+		Pedantic bool   `json:"pedantic"`
+		Name     string `json:"name"`
+		Lang     string `json:"lang"`
+		User     string `json:"user,omitempty"`
+		Password string `json:"pass,omitempty"`
+	}{Name: "bitlytest", Lang: "go", User: n.User, Password: n.Password})
+	if err != nil {
+		return err
+	}
+
+	// The PING makes a rejected CONNECT show up here rather than on the first publish.
+	if _, err = fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", options); err != nil {
+		return err
+	}
+	return n.waitPong()
+}
+
+// waitPong reads until the answer to our PING, answering the server's own PINGs meanwhile.
+func (n *NatsSink) waitPong() error {
+	for {
+		line, err := n.readLine()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err = n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("nats sink: " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (n *NatsSink) readLine() (string, error) {
+	line, err := n.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (n *NatsSink) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(n.Timeout)
+	if until, ok := ctx.Deadline(); ok && until.Before(deadline) {
+		return until
+	}
+	return deadline
+}
+
+func (n *NatsSink) close() error {
+	if n.conn == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	n.conn = nil
+	n.reader = nil
+	return err
+}
+
+func (n *NatsSink) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.close()
+}
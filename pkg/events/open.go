@@ -0,0 +1,24 @@
+package events
+
+import (
+	"strings"
+	"time"
+)
+
+// Open returns the publisher of a sink: nats://host:port publishes under subject, anything else is
+// the path of a file, optionally prefixed with file://.
+func Open(sink, subject string, timeout time.Duration) (Publisher, error) {
+	if strings.HasPrefix(sink, "nats://") {
+		nats, err := NewNatsSink(sink, subject, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return nats, nil
+	}
+
+	file, err := NewFileSink(strings.TrimPrefix(sink, "file://"))
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
@@ -2,22 +2,61 @@ package generator
 
 import (
 	"math/rand"
+	"strings"
 	"sync"
 	"time"
 )
 
 var once sync.Once
 
+const (
+	letters = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	// unambiguousLetters leave out 0/o and 1/l/i, which are mixed up when a code is typed from
+	// print, and upper case, which does not matter when codes are matched case-insensitively.
+	unambiguousLetters = "23456789abcdefghjkmnpqrstuvwxyz"
+)
+
+// RandomString generates a short code, codes spelling an offensive word are thrown away.
 func RandomString() string {
+	return randomString(letters)
+}
+
+// UnambiguousString generates a short code that is easy to retype.
+func UnambiguousString() string {
+	return randomString(unambiguousLetters)
+}
+
+func randomString(letters string) string {
 	once.Do(func() {
 		rand.Seed(time.Now().UnixNano())
 	})
 
-	var letters = []rune("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	for {
+		newUrl := make([]byte, 16)
+		for i := range newUrl {
+			newUrl[i] = letters[rand.Intn(len(letters))]
+		}
+		if !Offensive(string(newUrl)) {
+			return string(newUrl)
+		}
+	}
+}
+
+var offensiveWords = []string{
+	"anal", "anus", "arse", "bitch", "boob", "cock", "cunt", "dick", "fag", "fuck", "nazi", "nigg",
+	"penis", "piss", "porn", "rape", "shit", "slut", "tits", "twat", "wank", "whore",
+}
+
+// lookalikes reads digits the way they are used to spell words.
+var lookalikes = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t")
 
-	newUrl := make([]rune, 16)
-	for i := range newUrl {
-		newUrl[i] = letters[rand.Intn(len(letters))]
+// Offensive tells whether the code contains an offensive word, also when spelled with digits.
+func Offensive(code string) bool {
+	code = lookalikes.Replace(strings.ToLower(code))
+	for _, word := range offensiveWords {
+		if strings.Contains(code, word) {
+			return true
+		}
 	}
-	return string(newUrl)
+	return false
 }
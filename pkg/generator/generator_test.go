@@ -0,0 +1,34 @@
+package generator_test
+
+import (
+	"testing"
+
+	"github.com/kristina71/bitlytest/pkg/generator"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffensive(t *testing.T) {
+	require.True(t, generator.Offensive("xyFuCkab"))
+	require.True(t, generator.Offensive("a5h1tz"))
+	require.False(t, generator.Offensive("aB3dE9xQ"))
+}
+
+func TestRandomString(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		code := generator.RandomString()
+		require.Len(t, code, 16)
+		require.False(t, generator.Offensive(code))
+	}
+}
+
+func TestUnambiguousString(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		code := generator.UnambiguousString()
+		require.Len(t, code, 16)
+		require.NotContains(t, code, "0")
+		require.NotContains(t, code, "1")
+		require.Regexp(t, "^[a-z2-9]+$", code)
+		require.NotRegexp(t, "[oli]", code)
+	}
+}
@@ -0,0 +1,53 @@
+package geoip
+
+import (
+	"net"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Reader looks up countries in a local MaxMind format database, such as GeoLite2-Country.mmdb.
+type Reader struct {
+	db *maxminddb.Reader
+}
+
+type record struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+func Open(path string) (*Reader, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{db: db}, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code for ip or an empty string when it is unknown.
+func (r *Reader) Country(ip string) (string, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", nil
+	}
+
+	rec := record{}
+	if err := r.db.Lookup(parsed, &rec); err != nil {
+		return "", err
+	}
+
+	code := rec.Country.IsoCode
+	if code == "" {
+		code = rec.RegisteredCountry.IsoCode
+	}
+	return strings.ToUpper(code), nil
+}
+
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
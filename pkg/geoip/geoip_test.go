@@ -0,0 +1,128 @@
+package geoip_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kristina71/bitlytest/pkg/geoip"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountry(t *testing.T) {
+	path := writeDatabase(t, map[string][]byte{
+		"8.8.8.0/24":   mapOf(str("country"), mapOf(str("iso_code"), str("us"))),
+		"81.2.69.0/24": mapOf(str("registered_country"), mapOf(str("iso_code"), str("GB"))),
+		"2.2.0.0/16":   mapOf(str("country"), mapOf(str("iso_code"), str("FR")), str("registered_country"), mapOf(str("iso_code"), str("DE"))),
+	})
+
+	reader, err := geoip.Open(path)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	testCases := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{name: "Country", ip: "8.8.8.8", want: "US"},
+		{name: "Registered country when the country is unknown", ip: "81.2.69.160", want: "GB"},
+		{name: "Country before the registered one", ip: "2.2.10.1", want: "FR"},
+		{name: "Address missing from the database", ip: "1.1.1.1", want: ""},
+		{name: "Not an address", ip: "localhost", want: ""},
+		{name: "Empty", ip: "", want: ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			country, err := reader.Country(testCase.ip)
+			require.NoError(t, err)
+			require.Equal(t, testCase.want, country)
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	_, err := geoip.Open(filepath.Join(t.TempDir(), "missing.mmdb"))
+	require.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "broken.mmdb")
+	require.NoError(t, os.WriteFile(path, []byte("not a database"), 0o600))
+	_, err = geoip.Open(path)
+	require.Error(t, err)
+}
+
+// writeDatabase writes an IPv4 MaxMind database with 24 bit records mapping each network to its record.
+func writeDatabase(t *testing.T, networks map[string][]byte) string {
+	// A child is a node index, -1 when empty or -2-i for the record at data offset i.
+	nodes := [][2]int{{-1, -1}}
+	data := []byte{}
+	for cidr, record := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		ones, _ := network.Mask.Size()
+
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := int(network.IP.To4()[i/8]>>(7-i%8)) & 1
+			if i == ones-1 {
+				nodes[node][bit] = -2 - len(data)
+				break
+			}
+			if nodes[node][bit] == -1 {
+				nodes = append(nodes, [2]int{-1, -1})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+		data = append(data, record...)
+	}
+
+	db := []byte{}
+	for _, node := range nodes {
+		for _, child := range node {
+			value := child
+			switch {
+			case child == -1:
+				value = len(nodes)
+			case child < -1:
+				value = len(nodes) + 16 + (-2 - child)
+			}
+			db = append(db, byte(value>>16), byte(value>>8), byte(value))
+		}
+	}
+	db = append(db, make([]byte, 16)...)
+	db = append(db, data...)
+	db = append(db, "\xAB\xCD\xEFMaxMind.com"...)
+	db = append(db, mapOf(
+		str("node_count"), uint32Of(len(nodes)),
+		str("record_size"), uint32Of(24),
+		str("ip_version"), uint32Of(4),
+		str("binary_format_major_version"), uint32Of(2),
+	)...)
+
+	path := filepath.Join(t.TempDir(), "countries.mmdb")
+	require.NoError(t, os.WriteFile(path, db, 0o600))
+	return path
+}
+
+// str encodes a short utf-8 string in the MaxMind DB data format.
+func str(s string) []byte {
+	return append([]byte{2<<5 | byte(len(s))}, s...)
+}
+
+// uint32Of encodes n as an unsigned 32 bit integer.
+func uint32Of(n int) []byte {
+	return []byte{6<<5 | 4, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+}
+
+// mapOf encodes a map of the given keys and values, one after the other.
+func mapOf(pairs ...[]byte) []byte {
+	encoded := []byte{7<<5 | byte(len(pairs)/2)}
+	for _, pair := range pairs {
+		encoded = append(encoded, pair...)
+	}
+	return encoded
+}
@@ -0,0 +1,127 @@
+package grpcserver
+
+import (
+	"math"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/linkpb"
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func toLink(url models.Url) *linkpb.Link {
+	return &linkpb.Link{
+		Id:                uint32(url.Id),
+		Domain:            url.Domain,
+		SmallUrl:          url.SmallUrl,
+		OriginUrl:         url.OriginUrl,
+		Owner:             url.Owner,
+		CreatedAt:         timestamp(&url.CreatedAt),
+		UpdatedAt:         timestamp(&url.UpdateAt),
+		AlwaysPreview:     url.AlwaysPreview,
+		RedirectType:      url.RedirectType,
+		ActiveFrom:        timestamp(url.ActiveFrom),
+		ActiveUntil:       timestamp(url.ActiveUntil),
+		QueryPolicy:       url.QueryPolicy,
+		UtmSource:         url.UtmSource,
+		UtmMedium:         url.UtmMedium,
+		UtmCampaign:       url.UtmCampaign,
+		Title:             url.Title,
+		Notes:             url.Notes,
+		Tags:              url.Tags,
+		Description:       url.Description,
+		ImageUrl:          url.ImageUrl,
+		FaviconUrl:        url.FaviconUrl,
+		DeletedAt:         timestamp(url.DeletedAt),
+		PasswordProtected: url.PasswordHash != "",
+	}
+}
+
+// fromLink reads the settings a client may send, output only fields are ignored.
+func fromLink(link *linkpb.Link) (models.Url, error) {
+	id, err := idOf(link.GetId(), "id")
+	if err != nil {
+		return models.Url{}, err
+	}
+
+	return models.Url{
+		Id:            id,
+		Domain:        link.GetDomain(),
+		SmallUrl:      link.GetSmallUrl(),
+		OriginUrl:     link.GetOriginUrl(),
+		AlwaysPreview: link.GetAlwaysPreview(),
+		RedirectType:  link.GetRedirectType(),
+		ActiveFrom:    timeOf(link.GetActiveFrom()),
+		ActiveUntil:   timeOf(link.GetActiveUntil()),
+		QueryPolicy:   link.GetQueryPolicy(),
+		UtmSource:     link.GetUtmSource(),
+		UtmMedium:     link.GetUtmMedium(),
+		UtmCampaign:   link.GetUtmCampaign(),
+		Title:         link.GetTitle(),
+		Notes:         link.GetNotes(),
+		Tags:          link.GetTags(),
+	}, nil
+}
+
+// idOf narrows an id of the api to the ids links have. Larger ids are rejected rather than
+// wrapped around to another link.
+func idOf(id uint32, field string) (uint16, error) {
+	if id > math.MaxUint16 {
+		return 0, status.Errorf(codes.InvalidArgument, "%s %d is out of range", field, id)
+	}
+	return uint16(id), nil
+}
+
+// omitted lists the optional settings an update leaves as they are: those outside of the mask, or
+// without a mask, those the link has no value for.
+func omitted(link *linkpb.Link, mask *fieldmaskpb.FieldMask) ([]string, error) {
+	keep := map[string]bool{
+		models.SettingAlwaysPreview: !link.GetAlwaysPreview(),
+		models.SettingActiveFrom:    link.GetActiveFrom() == nil,
+		models.SettingActiveUntil:   link.GetActiveUntil() == nil,
+		models.SettingUtmSource:     link.GetUtmSource() == "",
+		models.SettingUtmMedium:     link.GetUtmMedium() == "",
+		models.SettingUtmCampaign:   link.GetUtmCampaign() == "",
+		models.SettingTitle:         link.GetTitle() == "",
+		models.SettingNotes:         link.GetNotes() == "",
+	}
+
+	if len(mask.GetPaths()) > 0 {
+		for setting := range keep {
+			keep[setting] = true
+		}
+		for _, path := range mask.GetPaths() {
+			if _, ok := keep[path]; !ok {
+				return nil, status.Errorf(codes.InvalidArgument, "update_mask: %s is not an optional setting", path)
+			}
+			keep[path] = false
+		}
+	}
+
+	settings := []string{}
+	for _, setting := range models.OptionalSettings {
+		if keep[setting] {
+			settings = append(settings, setting)
+		}
+	}
+	return settings, nil
+}
+
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func timeOf(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
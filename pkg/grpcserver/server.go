@@ -0,0 +1,229 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"log"
+	neturl "net/url"
+	"strings"
+
+	"github.com/kristina71/bitlytest/pkg/actor"
+	"github.com/kristina71/bitlytest/pkg/linkpb"
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/kristina71/bitlytest/pkg/service"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// New returns a gRPC server exposing LinkService over the service, with reflection for tools like grpcurl.
+func New(service *service.Service) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(unaryActor),
+		grpc.StreamInterceptor(streamActor),
+	)
+	linkpb.RegisterLinkServiceServer(srv, &server{service: service})
+	reflection.Register(srv)
+	return srv
+}
+
+type server struct {
+	linkpb.UnimplementedLinkServiceServer
+	service *service.Service
+}
+
+func (s *server) Create(ctx context.Context, req *linkpb.CreateRequest) (*linkpb.Link, error) {
+	url, err := fromLink(req.GetLink())
+	if err != nil {
+		return nil, err
+	}
+	url.Password = req.GetPassword()
+	url.ForceNew = req.GetForceNew()
+
+	url, err = s.service.CreateUrl(ctx, url)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return toLink(url), nil
+}
+
+func (s *server) Get(ctx context.Context, req *linkpb.GetRequest) (*linkpb.Link, error) {
+	id, err := idOf(req.GetId(), "id")
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := s.service.GetLink(ctx, models.Url{Id: id, Domain: host(req.GetDomain()), SmallUrl: strings.Trim(req.GetSmallUrl(), "/")})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return toLink(url), nil
+}
+
+func (s *server) List(req *linkpb.ListRequest, stream linkpb.LinkService_ListServer) error {
+	filter := models.UrlFilter{Status: req.GetStatus(), Tag: req.GetTag(), Deleted: req.GetDeleted()}
+
+	var (
+		urls []models.Url
+		err  error
+	)
+	if filter.Deleted {
+		urls, err = s.service.GetTrash(stream.Context())
+	} else {
+		urls, err = s.service.GetAllUrl(stream.Context(), filter)
+	}
+	if err != nil {
+		return statusError(err)
+	}
+
+	for _, url := range urls {
+		if err := stream.Send(toLink(url)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *server) Update(ctx context.Context, req *linkpb.UpdateRequest) (*linkpb.Link, error) {
+	url, err := fromLink(req.GetLink())
+	if err != nil {
+		return nil, err
+	}
+	url.Password = req.GetPassword()
+	url.ClearPassword = req.GetClearPassword()
+	url.Omitted, err = omitted(req.GetLink(), req.GetUpdateMask())
+	if err != nil {
+		return nil, err
+	}
+
+	url, err = s.service.UpdateUrl(ctx, url)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return toLink(url), nil
+}
+
+func (s *server) Delete(ctx context.Context, req *linkpb.DeleteRequest) (*emptypb.Empty, error) {
+	id, err := idOf(req.GetId(), "id")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.service.DeleteUrl(ctx, models.Url{Id: id}); err != nil {
+		return nil, statusError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// Resolve does what a visit of the short link does, up to the redirect: unknown and inactive links
+// answer with their fallback page, protected links need the password and the click is counted.
+func (s *server) Resolve(ctx context.Context, req *linkpb.ResolveRequest) (*linkpb.ResolveResponse, error) {
+	url, err := s.service.GetUrl(ctx, models.Url{Domain: host(req.GetDomain()), SmallUrl: strings.Trim(req.GetSmallUrl(), "/")})
+	notFound := models.NotFound{}
+	inactive := models.Inactive{}
+	switch {
+	case errors.As(err, &notFound) && notFound.FallbackUrl != "":
+		return &linkpb.ResolveResponse{DestinationUrl: notFound.FallbackUrl, Fallback: true}, nil
+	case errors.As(err, &inactive) && inactive.FallbackUrl != "":
+		return &linkpb.ResolveResponse{DestinationUrl: inactive.FallbackUrl, Fallback: true, Link: toLink(inactive.Url)}, nil
+	case err != nil:
+		return nil, statusError(err)
+	}
+
+	if url.PasswordHash != "" {
+		if req.GetPassword() == "" {
+			return nil, status.Error(codes.Unauthenticated, "link is password protected")
+		}
+		if _, err = s.service.UnlockUrl(ctx, url, req.GetPassword(), req.GetIp()); err != nil {
+			return nil, statusError(err)
+		}
+	}
+
+	query, _ := neturl.ParseQuery(req.GetQuery())
+	destination, err := s.service.Destination(ctx, url, models.Visitor{
+		IP:        req.GetIp(),
+		UserAgent: req.GetUserAgent(),
+		VariantId: int64(req.GetVariantId()),
+		Query:     query,
+	})
+	if err != nil {
+		// Targeting is best effort, the origin url is still a valid answer.
+		log.Println(err)
+	}
+
+	if !req.GetPreview() && !url.AlwaysPreview {
+		if err = s.service.RecordClick(ctx, url, destination); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return &linkpb.ResolveResponse{
+		DestinationUrl: destination.Url,
+		RedirectType:   url.RedirectType,
+		VariantId:      uint32(destination.VariantId),
+		Link:           toLink(url),
+	}, nil
+}
+
+// statusError maps service errors to the gRPC codes of the statuses the HTTP api answers with. gRPC has
+// no code for gone, a link in the trash answers FailedPrecondition like an inactive one: both exist but
+// cannot be used until restored or activated.
+func statusError(err error) error {
+	log.Println(err)
+	switch {
+	case errors.As(err, &models.NotFound{}):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.As(err, &models.Gone{}):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.As(err, &models.BadRequest{}):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.As(err, &models.Unauthorized{}):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.As(err, &models.TooManyRequests{}):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.As(err, &models.Inactive{}):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// host normalizes a requested domain the way the HTTP api reads the Host header.
+func host(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+}
+
+// unaryActor and streamActor take the user making the call from the x-user metadata, like actor.Middleware does from the header.
+func unaryActor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(withActor(ctx), req)
+}
+
+func streamActor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, actorStream{ServerStream: stream, ctx: withActor(stream.Context())})
+}
+
+type actorStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s actorStream) Context() context.Context {
+	return s.ctx
+}
+
+func withActor(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	for _, name := range md.Get(actor.Header) {
+		if name = strings.TrimSpace(name); name != "" {
+			return actor.With(ctx, name)
+		}
+	}
+	return ctx
+}
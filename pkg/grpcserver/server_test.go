@@ -0,0 +1,186 @@
+package grpcserver_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kristina71/bitlytest/mocks"
+	"github.com/kristina71/bitlytest/pkg/config"
+	"github.com/kristina71/bitlytest/pkg/grpcserver"
+	"github.com/kristina71/bitlytest/pkg/linkpb"
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/kristina71/bitlytest/pkg/service"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// client serves the service on an in-memory listener and returns a client connected to it.
+func client(t *testing.T, repo *mocks.Repository) linkpb.LinkServiceClient {
+	listener := bufconn.Listen(1 << 20)
+	srv := grpcserver.New(service.New(repo, config.New()))
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithInsecure(),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return linkpb.NewLinkServiceClient(conn)
+}
+
+func TestCreate(t *testing.T) {
+	repo := &mocks.Repository{}
+	links := client(t, repo)
+
+	repo.On("ValidateUrl", mock.Anything, "http://google.com").Return(true)
+	repo.On("Insert", mock.Anything, mock.Anything).Return(uint16(3), nil)
+
+	link, err := links.Create(context.Background(), &linkpb.CreateRequest{Link: &linkpb.Link{SmallUrl: "abc", OriginUrl: "http://google.com"}})
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), link.Id)
+	require.Equal(t, "abc", link.SmallUrl)
+	require.Equal(t, models.RedirectFound, link.RedirectType)
+
+	_, err = links.Create(context.Background(), &linkpb.CreateRequest{Link: &linkpb.Link{SmallUrl: "abc", OriginUrl: "http://google.com", RedirectType: "303"}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGet(t *testing.T) {
+	repo := &mocks.Repository{}
+	links := client(t, repo)
+
+	repo.On("GetById", mock.Anything, models.Url{Id: 1}).Return(models.Url{Id: 1, SmallUrl: "abc", OriginUrl: "http://google.com", PasswordHash: "hash"}, nil)
+	repo.On("GetById", mock.Anything, models.Url{Id: 2}).Return(models.Url{}, models.NotFoundError())
+
+	link, err := links.Get(context.Background(), &linkpb.GetRequest{Id: 1})
+	require.NoError(t, err)
+	require.Equal(t, "http://google.com", link.OriginUrl)
+	require.True(t, link.PasswordProtected)
+
+	_, err = links.Get(context.Background(), &linkpb.GetRequest{Id: 2})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestUpdate(t *testing.T) {
+	repo := &mocks.Repository{}
+	links := client(t, repo)
+
+	repo.On("ValidateUrl", mock.Anything, "http://google.com").Return(true)
+	repo.On("Update", mock.Anything, mock.MatchedBy(func(url models.Url) bool { return url.Title == "Sale" })).Return(nil)
+	repo.On("Update", mock.Anything, mock.MatchedBy(func(url models.Url) bool { return url.Title == "" })).Return(nil)
+
+	// Without a mask only the settings sent with a value change.
+	_, err := links.Update(context.Background(), &linkpb.UpdateRequest{Link: &linkpb.Link{Id: 1, SmallUrl: "abc", OriginUrl: "http://google.com", Title: "Sale"}})
+	require.NoError(t, err)
+	sent := repo.Calls[len(repo.Calls)-1].Arguments.Get(1).(models.Url)
+	require.Equal(t, []string{models.SettingAlwaysPreview, models.SettingActiveFrom, models.SettingActiveUntil, models.SettingUtmSource, models.SettingUtmMedium, models.SettingUtmCampaign, models.SettingNotes}, sent.Omitted)
+
+	// The mask clears the settings it names.
+	_, err = links.Update(context.Background(), &linkpb.UpdateRequest{
+		Link:       &linkpb.Link{Id: 1, SmallUrl: "abc", OriginUrl: "http://google.com"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"title", "always_preview"}},
+	})
+	require.NoError(t, err)
+	sent = repo.Calls[len(repo.Calls)-1].Arguments.Get(1).(models.Url)
+	require.Equal(t, []string{models.SettingActiveFrom, models.SettingActiveUntil, models.SettingUtmSource, models.SettingUtmMedium, models.SettingUtmCampaign, models.SettingNotes}, sent.Omitted)
+
+	_, err = links.Update(context.Background(), &linkpb.UpdateRequest{
+		Link:       &linkpb.Link{Id: 1, SmallUrl: "abc", OriginUrl: "http://google.com"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"origin_url"}},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestIdOutOfRange(t *testing.T) {
+	repo := &mocks.Repository{}
+	links := client(t, repo)
+
+	// 70001 would wrap around to link 4465.
+	_, err := links.Get(context.Background(), &linkpb.GetRequest{Id: 70001})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = links.Delete(context.Background(), &linkpb.DeleteRequest{Id: 70001})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = links.Update(context.Background(), &linkpb.UpdateRequest{Link: &linkpb.Link{Id: 70001, SmallUrl: "abc", OriginUrl: "http://google.com"}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	repo.AssertExpectations(t)
+	require.Empty(t, repo.Calls)
+}
+
+func TestList(t *testing.T) {
+	repo := &mocks.Repository{}
+	links := client(t, repo)
+
+	repo.On("Get", mock.Anything, models.UrlFilter{Tag: "sale"}).Return([]models.Url{{Id: 1, SmallUrl: "a"}, {Id: 2, SmallUrl: "b"}}, nil)
+
+	stream, err := links.List(context.Background(), &linkpb.ListRequest{Tag: "Sale"})
+	require.NoError(t, err)
+
+	smallUrls := []string{}
+	for {
+		link, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		smallUrls = append(smallUrls, link.SmallUrl)
+	}
+	require.Equal(t, []string{"a", "b"}, smallUrls)
+
+	stream, err = links.List(context.Background(), &linkpb.ListRequest{Status: "expired"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestResolve(t *testing.T) {
+	repo := &mocks.Repository{}
+	links := client(t, repo)
+
+	url := models.Url{Id: 1, SmallUrl: "abc", OriginUrl: "http://google.com", RedirectType: models.RedirectFound, QueryPolicy: models.QueryDrop}
+	secret := models.Url{Id: 2, SmallUrl: "secret", OriginUrl: "http://google.com/secret", PasswordHash: "hash"}
+	deletedAt := time.Now()
+	repo.On("GetBySmallUrl", mock.Anything, models.Url{SmallUrl: "abc"}).Return(url, nil)
+	repo.On("GetBySmallUrl", mock.Anything, models.Url{SmallUrl: "secret"}).Return(secret, nil)
+	repo.On("GetBySmallUrl", mock.Anything, models.Url{SmallUrl: "missing"}).Return(models.Url{}, models.NotFoundError())
+	repo.On("GetBySmallUrl", mock.Anything, models.Url{SmallUrl: "trashed"}).Return(models.Url{Id: 3, SmallUrl: "trashed", DeletedAt: &deletedAt}, nil)
+	repo.On("GetDeviceRules", mock.Anything, url).Return([]models.DeviceRule{}, nil)
+	repo.On("GetGeoRules", mock.Anything, url).Return([]models.GeoRule{}, nil)
+	repo.On("GetVariants", mock.Anything, url).Return([]models.Variant{}, nil)
+	repo.On("QueueClick", mock.Anything, url, "http://google.com").Return(nil).Once()
+
+	resolved, err := links.Resolve(context.Background(), &linkpb.ResolveRequest{SmallUrl: "/abc", Query: "utm_source=mail"})
+	require.NoError(t, err)
+	require.Equal(t, "http://google.com", resolved.DestinationUrl)
+	require.Equal(t, models.RedirectFound, resolved.RedirectType)
+	require.False(t, resolved.Fallback)
+
+	// A preview does not count as a click.
+	_, err = links.Resolve(context.Background(), &linkpb.ResolveRequest{SmallUrl: "abc", Preview: true})
+	require.NoError(t, err)
+	repo.AssertNumberOfCalls(t, "QueueClick", 1)
+
+	_, err = links.Resolve(context.Background(), &linkpb.ResolveRequest{SmallUrl: "secret"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = links.Resolve(context.Background(), &linkpb.ResolveRequest{SmallUrl: "missing"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	// A link in the trash is told apart from a missing one.
+	_, err = links.Resolve(context.Background(), &linkpb.ResolveRequest{SmallUrl: "trashed"})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Alias is a short code resolving to a link. Every link has one primary alias, its small url.
+type Alias struct {
+	Id        uint16    `json:"id" db:"id"`
+	UrlId     uint16    `json:"url_id" db:"url_id"`
+	Domain    string    `json:"domain,omitempty" db:"domain"`
+	Code      string    `json:"code" db:"code"`
+	Primary   bool      `json:"primary" db:"is_primary"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,7 @@
+package models
+
+type BulkResult struct {
+	Index int    `json:"index"`
+	Url   *Url   `json:"url,omitempty"`
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// Collision is a group of codes on a domain that only differ in case.
+type Collision struct {
+	Domain string   `json:"domain"`
+	Folded string   `json:"folded"`
+	Codes  []string `json:"codes"`
+}
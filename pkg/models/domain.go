@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Domain is a custom host serving its own short links. It is used once the owner proves control of
+// the host with a TXT record named TxtName holding TxtValue.
+type Domain struct {
+	Id          uint16     `json:"id" db:"id"`
+	Host        string     `json:"host" db:"host"`
+	FallbackUrl string     `json:"fallback_url,omitempty" db:"fallback_url"`
+	VerifyToken string     `json:"-" db:"verify_token"`
+	VerifiedAt  *time.Time `json:"verified_at,omitempty" db:"verified_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	TxtName     string     `json:"txt_name,omitempty" db:"-"`
+	TxtValue    string     `json:"txt_value,omitempty" db:"-"`
+}
+
+func (d Domain) Verified() bool {
+	return d.VerifiedAt != nil
+}
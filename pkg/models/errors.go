@@ -1,16 +1,36 @@
 package models
 
+import "time"
+
+// NotFound may carry the url of a domain to send visitors to instead of an error page.
 type NotFound struct {
+	FallbackUrl string
 }
 
 func NotFoundError() error {
 	return NotFound{}
 }
 
+func NotFoundFallbackError(fallbackUrl string) error {
+	return NotFound{FallbackUrl: fallbackUrl}
+}
+
 func (m NotFound) Error() string {
 	return "not found"
 }
 
+// Gone is returned for links that were deleted but not purged yet.
+type Gone struct {
+}
+
+func GoneError() error {
+	return Gone{}
+}
+
+func (m Gone) Error() string {
+	return "link was deleted"
+}
+
 type BadRequest struct {
 	message string
 }
@@ -22,3 +42,45 @@ func BadRequestError(message string) error {
 func (m BadRequest) Error() string {
 	return "bad request: " + m.message
 }
+
+type Unauthorized struct {
+	message string
+}
+
+func UnauthorizedError(message string) error {
+	return Unauthorized{message: message}
+}
+
+func (m Unauthorized) Error() string {
+	return "unauthorized: " + m.message
+}
+
+type TooManyRequests struct {
+	RetryAfter time.Duration
+}
+
+func TooManyRequestsError(retryAfter time.Duration) error {
+	return TooManyRequests{RetryAfter: retryAfter}
+}
+
+func (m TooManyRequests) Error() string {
+	return "too many requests, retry in " + m.RetryAfter.Round(time.Second).String()
+}
+
+// Inactive is returned for links requested outside of their activation window.
+type Inactive struct {
+	Url         Url
+	Status      string
+	FallbackUrl string
+}
+
+func InactiveError(url Url, status, fallbackUrl string) error {
+	return Inactive{Url: url, Status: status, FallbackUrl: fallbackUrl}
+}
+
+func (m Inactive) Error() string {
+	if m.Status == StatusScheduled {
+		return "link is not active yet"
+	}
+	return "link is no longer active"
+}
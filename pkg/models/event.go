@@ -0,0 +1,24 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// LinkEvent is a change of a link as it is stored in the outbox and published.
+// Events are ordered by TxId, then Id.
+type LinkEvent struct {
+	Id         int64           `json:"id" db:"id"`
+	TxId       int64           `json:"-" db:"txid"`
+	Type       string          `json:"type" db:"type"`
+	LinkId     uint16          `json:"link_id" db:"link_id"`
+	Payload    json.RawMessage `json:"payload" db:"payload"`
+	OccurredAt time.Time       `json:"occurred_at" db:"occurred_at"`
+}
+
+// Checkpoint is the position of the last event a relay has published.
+type Checkpoint struct {
+	Name    string `db:"name"`
+	TxId    int64  `db:"txid"`
+	EventId int64  `db:"event_id"`
+}
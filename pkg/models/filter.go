@@ -0,0 +1,14 @@
+package models
+
+const (
+	StatusScheduled = "scheduled"
+	StatusActive    = "active"
+	StatusEnded     = "ended"
+)
+
+type UrlFilter struct {
+	Status string `json:"status"`
+	Tag    string `json:"tag"`
+	// Deleted lists the trash instead of live links.
+	Deleted bool `json:"deleted"`
+}
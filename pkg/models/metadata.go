@@ -0,0 +1,9 @@
+package models
+
+// PageMeta is what the enrichment job extracts from the html of a destination.
+type PageMeta struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	ImageUrl    string `json:"image_url"`
+	FaviconUrl  string `json:"favicon_url"`
+}
@@ -5,9 +5,50 @@ import (
 )
 
 type Url struct {
-	Id        uint16    `json:"id" db:"id"`
-	SmallUrl  string    `json:"small_url" db:"small_url"`
-	OriginUrl string    `json:"origin_url" db:"origin_url"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdateAt  time.Time `json:"updated_at" db:"updated_at"`
+	Id            uint16       `json:"id" db:"id"`
+	Domain        string       `json:"domain,omitempty" db:"domain"`
+	SmallUrl      string       `json:"small_url" db:"small_url"`
+	OriginUrl     string       `json:"origin_url" db:"origin_url"`
+	Owner         string       `json:"owner,omitempty" db:"owner"`
+	ForceNew      bool         `json:"force_new,omitempty" db:"-"`
+	CreatedAt     time.Time    `json:"created_at" db:"created_at"`
+	UpdateAt      time.Time    `json:"updated_at" db:"updated_at"`
+	AlwaysPreview bool         `json:"always_preview" db:"always_preview"`
+	RedirectType  string       `json:"redirect_type" db:"redirect_type"`
+	PasswordHash  string       `json:"-" db:"password_hash"`
+	Password      string       `json:"password,omitempty" db:"-"`
+	ClearPassword bool         `json:"clear_password,omitempty" db:"-"`
+	ActiveFrom    *time.Time   `json:"active_from,omitempty" db:"active_from"`
+	ActiveUntil   *time.Time   `json:"active_until,omitempty" db:"active_until"`
+	QueryPolicy   string       `json:"query_policy" db:"query_policy"`
+	UtmSource     string       `json:"utm_source,omitempty" db:"utm_source"`
+	UtmMedium     string       `json:"utm_medium,omitempty" db:"utm_medium"`
+	UtmCampaign   string       `json:"utm_campaign,omitempty" db:"utm_campaign"`
+	Title         string       `json:"title,omitempty" db:"title"`
+	Notes         string       `json:"notes,omitempty" db:"notes"`
+	Tags          []string     `json:"tags,omitempty" db:"-"`
+	Description   string       `json:"description,omitempty" db:"description"`
+	ImageUrl      string       `json:"image_url,omitempty" db:"image_url"`
+	FaviconUrl    string       `json:"favicon_url,omitempty" db:"favicon_url"`
+	EnrichedAt    *time.Time   `json:"enriched_at,omitempty" db:"enriched_at"`
+	DeletedAt     *time.Time   `json:"deleted_at,omitempty" db:"deleted_at"`
+	DeviceRules   []DeviceRule `json:"device_rules,omitempty" db:"-"`
+	Variants      []Variant    `json:"variants,omitempty" db:"-"`
+	// Omitted lists the optional settings an update left out, they keep their stored values.
+	Omitted []string `json:"-" db:"-"`
 }
+
+// Settings an update may leave out. Named like their json fields, an empty redirect type, query policy
+// or password also keeps the stored one.
+const (
+	SettingAlwaysPreview = "always_preview"
+	SettingActiveFrom    = "active_from"
+	SettingActiveUntil   = "active_until"
+	SettingUtmSource     = "utm_source"
+	SettingUtmMedium     = "utm_medium"
+	SettingUtmCampaign   = "utm_campaign"
+	SettingTitle         = "title"
+	SettingNotes         = "notes"
+)
+
+var OptionalSettings = []string{SettingAlwaysPreview, SettingActiveFrom, SettingActiveUntil, SettingUtmSource, SettingUtmMedium, SettingUtmCampaign, SettingTitle, SettingNotes}
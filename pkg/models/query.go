@@ -0,0 +1,21 @@
+package models
+
+// Query policies decide what happens to the query string of a visit to a short link.
+const (
+	// QueryDrop ignores the incoming query string.
+	QueryDrop = "drop"
+	// QueryMerge adds incoming parameters the destination does not have yet.
+	QueryMerge = "merge"
+	// QueryOverride adds incoming parameters, replacing the destination's values for the same keys.
+	QueryOverride = "override"
+)
+
+var queryPolicies = map[string]bool{
+	QueryDrop:     true,
+	QueryMerge:    true,
+	QueryOverride: true,
+}
+
+func IsQueryPolicy(value string) bool {
+	return queryPolicies[value]
+}
@@ -0,0 +1,23 @@
+package models
+
+const (
+	RedirectMovedPermanently = "301"
+	RedirectFound            = "302"
+	RedirectTemporary        = "307"
+	RedirectPermanent        = "308"
+	RedirectMetaRefresh      = "meta"
+	RedirectJavaScript       = "js"
+)
+
+var redirectTypes = map[string]bool{
+	RedirectMovedPermanently: true,
+	RedirectFound:            true,
+	RedirectTemporary:        true,
+	RedirectPermanent:        true,
+	RedirectMetaRefresh:      true,
+	RedirectJavaScript:       true,
+}
+
+func IsRedirectType(value string) bool {
+	return redirectTypes[value]
+}
@@ -0,0 +1,12 @@
+package models
+
+type Search struct {
+	Query string `json:"q"`
+	Limit int    `json:"limit"`
+}
+
+// SearchResult is a link matching a search, better matches have a higher rank.
+type SearchResult struct {
+	Url
+	Rank float64 `json:"rank" db:"rank"`
+}
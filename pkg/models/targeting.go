@@ -0,0 +1,65 @@
+package models
+
+import "net/url"
+
+type GeoRule struct {
+	Id        int64  `json:"id" db:"id"`
+	UrlId     int64  `json:"url_id" db:"url_id"`
+	Country   string `json:"country" db:"country"`
+	TargetUrl string `json:"target_url" db:"target_url"`
+}
+
+// GeoRules is the body of the geo rule endpoints: the link is found by id and its rules are replaced at once.
+type GeoRules struct {
+	Id    uint16    `json:"id"`
+	Rules []GeoRule `json:"rules"`
+}
+
+// Variant is one of the weighted destinations of a link split between several landing pages.
+type Variant struct {
+	Id        int64  `json:"id" db:"id"`
+	UrlId     int64  `json:"url_id" db:"url_id"`
+	TargetUrl string `json:"target_url" db:"target_url"`
+	Weight    int    `json:"weight" db:"weight"`
+	Clicks    int64  `json:"clicks" db:"clicks"`
+}
+
+type Variants struct {
+	Id       uint16    `json:"id"`
+	Variants []Variant `json:"variants"`
+}
+
+// Visitor describes the client following a short link.
+type Visitor struct {
+	IP        string
+	UserAgent string
+	// VariantId is the variant the visitor was sent to before, if any.
+	VariantId int64
+	// Query is the query string of the visited short link.
+	Query url.Values
+}
+
+// Destination is where a visitor is redirected. VariantId is set when a split variant was chosen.
+type Destination struct {
+	Url       string
+	VariantId int64
+}
+
+type Stats struct {
+	Url         Url          `json:"url"`
+	GeoRules    []GeoRule    `json:"geo_rules"`
+	DeviceRules []DeviceRule `json:"device_rules"`
+	Variants    []Variant    `json:"variants"`
+}
+
+// DeviceRule sends visitors to TargetUrl when their User-Agent matches all of the set criteria.
+// Rules are evaluated in Position order.
+type DeviceRule struct {
+	Id        int64  `json:"id" db:"id"`
+	UrlId     int64  `json:"url_id" db:"url_id"`
+	Position  int    `json:"position" db:"position"`
+	OS        string `json:"os,omitempty" db:"os"`
+	Device    string `json:"device,omitempty" db:"device"`
+	Browser   string `json:"browser,omitempty" db:"browser"`
+	TargetUrl string `json:"target_url" db:"target_url"`
+}
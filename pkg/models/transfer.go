@@ -0,0 +1,29 @@
+package models
+
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictRename    = "rename"
+)
+
+type ImportOptions struct {
+	DryRun   bool
+	Conflict string
+}
+
+type ImportError struct {
+	Index    int    `json:"index"`
+	SmallUrl string `json:"small_url"`
+	Error    string `json:"error"`
+}
+
+type ImportReport struct {
+	DryRun  bool          `json:"dry_run"`
+	Total   int           `json:"total"`
+	Created int           `json:"created"`
+	Updated int           `json:"updated"`
+	Renamed int           `json:"renamed"`
+	Skipped int           `json:"skipped"`
+	Failed  int           `json:"failed"`
+	Errors  []ImportError `json:"errors"`
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionRollback = "rollback"
+	ActionDelete   = "delete"
+	ActionRestore  = "restore"
+)
+
+// LinkVersion records one change of a link. Old is empty for a created link and New for a deleted one.
+type LinkVersion struct {
+	Id        int64     `json:"id" db:"id"`
+	UrlId     uint16    `json:"url_id" db:"url_id"`
+	Actor     string    `json:"actor" db:"actor"`
+	Action    string    `json:"action" db:"action"`
+	ChangedAt time.Time `json:"changed_at" db:"changed_at"`
+	Old       *Snapshot `json:"old" db:"old_value"`
+	New       *Snapshot `json:"new" db:"new_value"`
+}
+
+// Rollback restores the link Id to the state recorded by the version VersionId.
+type Rollback struct {
+	Id        uint16 `json:"id"`
+	VersionId int64  `json:"version_id"`
+}
+
+// Snapshot holds the editable settings of a link. Passwords, rules and tags are not versioned.
+type Snapshot struct {
+	SmallUrl      string     `json:"small_url"`
+	OriginUrl     string     `json:"origin_url"`
+	AlwaysPreview bool       `json:"always_preview"`
+	RedirectType  string     `json:"redirect_type"`
+	ActiveFrom    *time.Time `json:"active_from,omitempty"`
+	ActiveUntil   *time.Time `json:"active_until,omitempty"`
+	QueryPolicy   string     `json:"query_policy"`
+	UtmSource     string     `json:"utm_source,omitempty"`
+	UtmMedium     string     `json:"utm_medium,omitempty"`
+	UtmCampaign   string     `json:"utm_campaign,omitempty"`
+	Title         string     `json:"title,omitempty"`
+	Notes         string     `json:"notes,omitempty"`
+}
+
+func SnapshotOf(url Url) *Snapshot {
+	return &Snapshot{
+		SmallUrl:      url.SmallUrl,
+		OriginUrl:     url.OriginUrl,
+		AlwaysPreview: url.AlwaysPreview,
+		RedirectType:  url.RedirectType,
+		ActiveFrom:    url.ActiveFrom,
+		ActiveUntil:   url.ActiveUntil,
+		QueryPolicy:   url.QueryPolicy,
+		UtmSource:     url.UtmSource,
+		UtmMedium:     url.UtmMedium,
+		UtmCampaign:   url.UtmCampaign,
+		Title:         url.Title,
+		Notes:         url.Notes,
+	}
+}
+
+// Apply returns url with the settings of the snapshot.
+func (s Snapshot) Apply(url Url) Url {
+	url.SmallUrl = s.SmallUrl
+	url.OriginUrl = s.OriginUrl
+	url.AlwaysPreview = s.AlwaysPreview
+	url.RedirectType = s.RedirectType
+	url.ActiveFrom = s.ActiveFrom
+	url.ActiveUntil = s.ActiveUntil
+	url.QueryPolicy = s.QueryPolicy
+	url.UtmSource = s.UtmSource
+	url.UtmMedium = s.UtmMedium
+	url.UtmCampaign = s.UtmCampaign
+	url.Title = s.Title
+	url.Notes = s.Notes
+	return url
+}
+
+// Value stores the snapshot as json.
+func (s Snapshot) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+func (s *Snapshot) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	default:
+		return errors.New("unsupported snapshot value")
+	}
+}
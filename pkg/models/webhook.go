@@ -0,0 +1,85 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	EventLinkCreated  = "link.created"
+	EventLinkUpdated  = "link.updated"
+	EventLinkDeleted  = "link.deleted"
+	EventLinkRestored = "link.restored"
+	EventLinkClicked  = "link.clicked"
+)
+
+var WebhookEvents = []string{EventLinkCreated, EventLinkUpdated, EventLinkDeleted, EventLinkRestored, EventLinkClicked}
+
+// EventOf returns the webhook event announcing a change recorded with action.
+func EventOf(action string) string {
+	switch action {
+	case ActionCreate:
+		return EventLinkCreated
+	case ActionDelete:
+		return EventLinkDeleted
+	case ActionRestore:
+		return EventLinkRestored
+	default:
+		return EventLinkUpdated
+	}
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// DeliveryDead marks deliveries that ran out of attempts, they stay listed until retried by hand.
+	DeliveryDead = "dead"
+)
+
+// Webhook subscribes a url to link events. Payloads are signed with Secret, which is only shown
+// when the webhook is added.
+type Webhook struct {
+	Id        int64          `json:"id" db:"id"`
+	Url       string         `json:"url" db:"url"`
+	Events    pq.StringArray `json:"events" db:"events"`
+	Secret    string         `json:"secret,omitempty" db:"secret"`
+	Active    bool           `json:"active" db:"active"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+}
+
+// WebhookPayload is the body sent to webhooks. Link holds the state after the change,
+// Previous the state before it, so a deleted link only has Previous.
+type WebhookPayload struct {
+	Event       string    `json:"event"`
+	OccurredAt  time.Time `json:"occurred_at"`
+	Actor       string    `json:"actor"`
+	LinkId      uint16    `json:"link_id"`
+	Domain      string    `json:"domain,omitempty"`
+	Link        *Snapshot `json:"link,omitempty"`
+	Previous    *Snapshot `json:"previous,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+}
+
+// Delivery is one event waiting for, or done with, being sent to a webhook.
+type Delivery struct {
+	Id            int64           `json:"id" db:"id"`
+	WebhookId     int64           `json:"webhook_id" db:"webhook_id"`
+	Event         string          `json:"event" db:"event"`
+	Payload       json.RawMessage `json:"payload" db:"payload"`
+	Status        string          `json:"status" db:"status"`
+	Attempts      int             `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+	LastStatus    int             `json:"last_status,omitempty" db:"last_status"`
+	LastError     string          `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty" db:"delivered_at"`
+	Url           string          `json:"-" db:"-"`
+	Secret        string          `json:"-" db:"-"`
+}
+
+type DeliveryFilter struct {
+	WebhookId int64  `json:"webhook_id"`
+	Status    string `json:"status"`
+}
@@ -0,0 +1,67 @@
+package passthrough
+
+import (
+	"net/url"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+)
+
+// Apply builds the url a visitor is redirected to. Incoming parameters are forwarded according to
+// the policy, then the defaults fill in keys that are still missing, so a utm_source already in the
+// destination or sent by the visitor is never replaced by a stored default.
+// The destination is returned untouched when nothing is added.
+func Apply(destination string, incoming url.Values, policy string, defaults url.Values) (string, error) {
+	target, err := url.Parse(destination)
+	if err != nil {
+		return destination, err
+	}
+
+	query := target.Query()
+	changed := false
+
+	switch policy {
+	case models.QueryMerge:
+		changed = fill(query, incoming) || changed
+	case models.QueryOverride:
+		for key, values := range incoming {
+			query[key] = values
+			changed = true
+		}
+	}
+
+	changed = fill(query, defaults) || changed
+	if !changed {
+		return destination, nil
+	}
+
+	target.RawQuery = query.Encode()
+	return target.String(), nil
+}
+
+// fill copies the keys of from that query does not have yet.
+func fill(query, from url.Values) bool {
+	changed := false
+	for key, values := range from {
+		if _, ok := query[key]; ok || len(values) == 0 {
+			continue
+		}
+		query[key] = values
+		changed = true
+	}
+	return changed
+}
+
+// Utm returns the stored utm defaults of the link as query parameters.
+func Utm(link models.Url) url.Values {
+	defaults := url.Values{}
+	if link.UtmSource != "" {
+		defaults.Set("utm_source", link.UtmSource)
+	}
+	if link.UtmMedium != "" {
+		defaults.Set("utm_medium", link.UtmMedium)
+	}
+	if link.UtmCampaign != "" {
+		defaults.Set("utm_campaign", link.UtmCampaign)
+	}
+	return defaults
+}
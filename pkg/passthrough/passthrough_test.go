@@ -0,0 +1,104 @@
+package passthrough_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/kristina71/bitlytest/pkg/passthrough"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply(t *testing.T) {
+	testCases := []struct {
+		name        string
+		destination string
+		incoming    url.Values
+		policy      string
+		defaults    url.Values
+		expected    string
+	}{
+		{
+			name:        "Drop keeps destination",
+			destination: "http://example.com/page?b=2&a=1",
+			incoming:    url.Values{"ref": {"newsletter"}},
+			policy:      models.QueryDrop,
+			expected:    "http://example.com/page?b=2&a=1",
+		},
+		{
+			name:        "Empty policy drops",
+			destination: "http://example.com/page",
+			incoming:    url.Values{"ref": {"newsletter"}},
+			expected:    "http://example.com/page",
+		},
+		{
+			name:        "Merge adds new keys",
+			destination: "http://example.com/page",
+			incoming:    url.Values{"ref": {"newsletter"}},
+			policy:      models.QueryMerge,
+			expected:    "http://example.com/page?ref=newsletter",
+		},
+		{
+			name:        "Merge keeps destination value on conflict",
+			destination: "http://example.com/page?ref=site",
+			incoming:    url.Values{"ref": {"newsletter"}, "id": {"7"}},
+			policy:      models.QueryMerge,
+			expected:    "http://example.com/page?id=7&ref=site",
+		},
+		{
+			name:        "Override replaces destination value on conflict",
+			destination: "http://example.com/page?ref=site",
+			incoming:    url.Values{"ref": {"newsletter"}, "id": {"7"}},
+			policy:      models.QueryOverride,
+			expected:    "http://example.com/page?id=7&ref=newsletter",
+		},
+		{
+			name:        "Repeated keys are forwarded",
+			destination: "http://example.com/page",
+			incoming:    url.Values{"tag": {"a", "b"}},
+			policy:      models.QueryMerge,
+			expected:    "http://example.com/page?tag=a&tag=b",
+		},
+		{
+			name:        "Defaults appended",
+			destination: "http://example.com/page#top",
+			defaults:    url.Values{"utm_source": {"poster"}, "utm_campaign": {"spring sale"}},
+			expected:    "http://example.com/page?utm_campaign=spring+sale&utm_source=poster#top",
+		},
+		{
+			name:        "Destination wins over defaults",
+			destination: "http://example.com/page?utm_source=mail",
+			defaults:    url.Values{"utm_source": {"poster"}},
+			expected:    "http://example.com/page?utm_source=mail",
+		},
+		{
+			name:        "Visitor wins over defaults",
+			destination: "http://example.com/page",
+			incoming:    url.Values{"utm_source": {"twitter"}},
+			policy:      models.QueryMerge,
+			defaults:    url.Values{"utm_source": {"poster"}, "utm_medium": {"print"}},
+			expected:    "http://example.com/page?utm_medium=print&utm_source=twitter",
+		},
+		{
+			name:        "Special characters are encoded",
+			destination: "http://example.com/search",
+			incoming:    url.Values{"q": {"a&b=c d/é"}},
+			policy:      models.QueryOverride,
+			expected:    "http://example.com/search?q=a%26b%3Dc+d%2F%C3%A9",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			result, err := passthrough.Apply(testCase.destination, testCase.incoming, testCase.policy, testCase.defaults)
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, result)
+		})
+	}
+}
+
+func TestUtm(t *testing.T) {
+	require.Equal(t, url.Values{}, passthrough.Utm(models.Url{}))
+	require.Equal(t, url.Values{"utm_source": {"poster"}, "utm_medium": {"print"}}, passthrough.Utm(models.Url{UtmSource: "poster", UtmMedium: "print"}))
+}
@@ -0,0 +1,223 @@
+package qr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	PNG = "png"
+	SVG = "svg"
+
+	minSize   = 64
+	maxSize   = 2048
+	maxMargin = 16
+)
+
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+type Options struct {
+	Format     string
+	Size       int
+	Level      qrcode.RecoveryLevel
+	Margin     int
+	Foreground color.NRGBA
+	Background color.NRGBA
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Format:     PNG,
+		Size:       256,
+		Level:      qrcode.Medium,
+		Margin:     4,
+		Foreground: color.NRGBA{A: 0xff},
+		Background: color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	}
+}
+
+// ParseOptions reads format, size, level, margin, fg and bg query parameters on top of the defaults.
+func ParseOptions(values url.Values) (Options, error) {
+	opts := DefaultOptions()
+
+	if format := strings.ToLower(values.Get("format")); format != "" {
+		if format != PNG && format != SVG {
+			return opts, models.BadRequestError("format must be png or svg")
+		}
+		opts.Format = format
+	}
+
+	if size := values.Get("size"); size != "" {
+		value, err := strconv.Atoi(size)
+		if err != nil || value < minSize || value > maxSize {
+			return opts, models.BadRequestError(fmt.Sprintf("size must be between %d and %d", minSize, maxSize))
+		}
+		opts.Size = value
+	}
+
+	if level := values.Get("level"); level != "" {
+		value, ok := levels[strings.ToUpper(level)]
+		if !ok {
+			return opts, models.BadRequestError("level must be one of L, M, Q, H")
+		}
+		opts.Level = value
+	}
+
+	if margin := values.Get("margin"); margin != "" {
+		value, err := strconv.Atoi(margin)
+		if err != nil || value < 0 || value > maxMargin {
+			return opts, models.BadRequestError(fmt.Sprintf("margin must be between 0 and %d", maxMargin))
+		}
+		opts.Margin = value
+	}
+
+	var err error
+	if fg := values.Get("fg"); fg != "" {
+		if opts.Foreground, err = parseColor(fg); err != nil {
+			return opts, err
+		}
+	}
+	if bg := values.Get("bg"); bg != "" {
+		if opts.Background, err = parseColor(bg); err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, nil
+}
+
+func ContentType(format string) string {
+	if format == SVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+func Encode(content string, opts Options) ([]byte, error) {
+	modules, err := bitmap(content, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Format == SVG {
+		return renderSvg(modules, opts), nil
+	}
+	return renderPng(modules, opts)
+}
+
+// bitmap returns the code modules surrounded by a quiet zone of opts.Margin modules.
+func bitmap(content string, opts Options) ([][]bool, error) {
+	code, err := qrcode.New(content, opts.Level)
+	if err != nil {
+		return nil, models.BadRequestError(err.Error())
+	}
+	code.DisableBorder = true
+	symbol := code.Bitmap()
+
+	total := len(symbol) + 2*opts.Margin
+	modules := make([][]bool, total)
+	for y := range modules {
+		modules[y] = make([]bool, total)
+	}
+	for y, row := range symbol {
+		copy(modules[y+opts.Margin][opts.Margin:], row)
+	}
+	return modules, nil
+}
+
+func renderPng(modules [][]bool, opts Options) ([]byte, error) {
+	total := len(modules)
+	scale := opts.Size / total
+	if scale < 1 {
+		scale = 1
+	}
+	size := opts.Size
+	if size < total*scale {
+		size = total * scale
+	}
+	offset := (size - total*scale) / 2
+
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.SetNRGBA(x, y, opts.Background)
+		}
+	}
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetNRGBA(offset+x*scale+dx, offset+y*scale+dy, opts.Foreground)
+				}
+			}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func renderSvg(modules [][]bool, opts Options) []byte {
+	total := len(modules)
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, opts.Size, opts.Size, total, total)
+	fmt.Fprintf(buf, `<rect width="%d" height="%d" %s/>`, total, total, svgFill(opts.Background))
+	fmt.Fprintf(buf, `<path %s d="`, svgFill(opts.Foreground))
+	for y, row := range modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(buf, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
+
+func svgFill(c color.NRGBA) string {
+	fill := fmt.Sprintf(`fill="#%02x%02x%02x"`, c.R, c.G, c.B)
+	if c.A != 0xff {
+		fill += fmt.Sprintf(` fill-opacity="%.3f"`, float64(c.A)/0xff)
+	}
+	return fill
+}
+
+// parseColor accepts rgb, rrggbb and rrggbbaa hex values with an optional leading "#".
+func parseColor(value string) (color.NRGBA, error) {
+	value = strings.TrimPrefix(value, "#")
+	if len(value) == 3 {
+		value = string([]byte{value[0], value[0], value[1], value[1], value[2], value[2]})
+	}
+	if len(value) == 6 {
+		value += "ff"
+	}
+
+	b, err := hex.DecodeString(value)
+	if err != nil || len(b) != 4 {
+		return color.NRGBA{}, models.BadRequestError("colour must be a hex value like 000000 or #fff")
+	}
+	return color.NRGBA{R: b[0], G: b[1], B: b[2], A: b[3]}, nil
+}
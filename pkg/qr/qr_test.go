@@ -0,0 +1,84 @@
+package qr_test
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kristina71/bitlytest/pkg/qr"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOptions(t *testing.T) {
+	testCases := []struct {
+		name    string
+		query   string
+		check   func(t *testing.T, opts qr.Options)
+		wantErr bool
+	}{
+		{
+			name:  "Defaults",
+			query: "",
+			check: func(t *testing.T, opts qr.Options) {
+				require.Equal(t, qr.DefaultOptions(), opts)
+			},
+		},
+		{
+			name:  "All parameters",
+			query: "format=svg&size=512&level=h&margin=0&fg=%23f00&bg=00000000",
+			check: func(t *testing.T, opts qr.Options) {
+				require.Equal(t, qr.SVG, opts.Format)
+				require.Equal(t, 512, opts.Size)
+				require.Equal(t, 0, opts.Margin)
+				require.Equal(t, color.NRGBA{R: 0xff, A: 0xff}, opts.Foreground)
+				require.Equal(t, color.NRGBA{}, opts.Background)
+			},
+		},
+		{name: "Unknown format", query: "format=gif", wantErr: true},
+		{name: "Too small", query: "size=10", wantErr: true},
+		{name: "Unknown level", query: "level=X", wantErr: true},
+		{name: "Negative margin", query: "margin=-1", wantErr: true},
+		{name: "Broken colour", query: "fg=zzzzzz", wantErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			values, err := url.ParseQuery(testCase.query)
+			require.NoError(t, err)
+
+			opts, err := qr.ParseOptions(values)
+			if testCase.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			testCase.check(t, opts)
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	opts := qr.DefaultOptions()
+	opts.Foreground = color.NRGBA{B: 0xff, A: 0xff}
+
+	b, err := qr.Encode("http://localhost:8000/abc", opts)
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	require.Equal(t, opts.Size, img.Bounds().Dx())
+	require.Equal(t, opts.Size, img.Bounds().Dy())
+
+	r, g, b0, _ := img.At(0, 0).RGBA()
+	require.Equal(t, []uint32{0xffff, 0xffff, 0xffff}, []uint32{r, g, b0})
+
+	opts.Format = qr.SVG
+	b, err = qr.Encode("http://localhost:8000/abc", opts)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(b), "<svg"))
+	require.Contains(t, string(b), `fill="#0000ff"`)
+}
@@ -2,31 +2,104 @@ package repositories
 
 import (
 	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
 
 	"github.com/kristina71/bitlytest/pkg/adapters"
+	"github.com/kristina71/bitlytest/pkg/config"
+	"github.com/kristina71/bitlytest/pkg/enrich"
+	"github.com/kristina71/bitlytest/pkg/events"
 	"github.com/kristina71/bitlytest/pkg/generator"
+	"github.com/kristina71/bitlytest/pkg/geoip"
 	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/kristina71/bitlytest/pkg/password"
 	"github.com/kristina71/bitlytest/pkg/urlvalidator"
+	"github.com/kristina71/bitlytest/pkg/webhook"
 )
 
+// Resolver looks up DNS TXT records, *net.Resolver is one.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
 type Urls struct {
-	adapter *adapters.Storage
+	adapter   *adapters.Storage
+	geo       *geoip.Reader
+	fetcher   *enrich.Fetcher
+	resolver  Resolver
+	webhooks  *webhook.Sender
+	publisher events.Publisher
+	generate  func() string
+}
+
+func New(adapter *adapters.Storage, cfg config.Cfg) *Urls {
+	u := &Urls{
+		adapter:  adapter.CaseInsensitive(cfg.CaseInsensitiveCodes).Events(cfg.EventsSink != ""),
+		fetcher:  enrich.New(&http.Client{Timeout: cfg.EnrichTimeout}, int64(cfg.EnrichMaxBytes)),
+		resolver: net.DefaultResolver,
+		webhooks: webhook.New(&http.Client{Timeout: cfg.WebhookTimeout}),
+		generate: generator.RandomString,
+	}
+	if cfg.CaseInsensitiveCodes {
+		u.generate = generator.UnambiguousString
+	}
+
+	if cfg.EventsSink != "" {
+		publisher, err := events.Open(cfg.EventsSink, cfg.EventsSubject, cfg.EventsTimeout)
+		if err != nil {
+			log.Println(err)
+		}
+		u.publisher = publisher
+	}
+
+	if cfg.GeoIPDbPath != "" {
+		geo, err := geoip.Open(cfg.GeoIPDbPath)
+		if err != nil {
+			log.Println(err)
+		}
+		u.geo = geo
+	}
+
+	return u
 }
 
-func New(adapter *adapters.Storage) *Urls {
-	return &Urls{adapter: adapter}
+// WithResolver replaces the system resolver used for domain verification.
+func (u *Urls) WithResolver(resolver Resolver) *Urls {
+	u.resolver = resolver
+	return u
+}
+
+// WithPublisher replaces the sink link events are relayed to.
+func (u *Urls) WithPublisher(publisher events.Publisher) *Urls {
+	u.publisher = publisher
+	return u
 }
 
 func (u *Urls) Insert(ctx context.Context, url models.Url) (uint16, error) {
 	return u.adapter.Insert(ctx, url)
 }
 
+func (u *Urls) InsertBatch(ctx context.Context, urls []models.Url) ([]models.Url, error) {
+	return u.adapter.InsertBatch(ctx, urls)
+}
+
 func (u *Urls) GetBySmallUrl(ctx context.Context, url models.Url) (models.Url, error) {
 	return u.adapter.GetBySmallUrl(ctx, url)
 }
 
-func (u *Urls) Get(ctx context.Context) ([]models.Url, error) {
-	return u.adapter.Get(ctx)
+func (u *Urls) GetById(ctx context.Context, url models.Url) (models.Url, error) {
+	return u.adapter.GetById(ctx, url)
+}
+
+func (u *Urls) Get(ctx context.Context, filter models.UrlFilter) ([]models.Url, error) {
+	return u.adapter.Get(ctx, filter)
+}
+
+func (u *Urls) Export(ctx context.Context, fn func(url models.Url) error) error {
+	return u.adapter.Export(ctx, fn)
 }
 
 func (u *Urls) Update(ctx context.Context, url models.Url) error {
@@ -37,10 +110,217 @@ func (u *Urls) Delete(ctx context.Context, url models.Url) error {
 	return u.adapter.Delete(ctx, url)
 }
 
+func (u *Urls) DeleteBatch(ctx context.Context, ids []uint16) ([]uint16, error) {
+	return u.adapter.DeleteBatch(ctx, ids)
+}
+
+func (u *Urls) Restore(ctx context.Context, url models.Url) (models.Url, error) {
+	return u.adapter.Restore(ctx, url)
+}
+
+func (u *Urls) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return u.adapter.Purge(ctx, before)
+}
+
+func (u *Urls) FindByOrigin(ctx context.Context, url models.Url) (models.Url, error) {
+	return u.adapter.FindByOrigin(ctx, url)
+}
+
+func (u *Urls) GetAliases(ctx context.Context, url models.Url) ([]models.Alias, error) {
+	return u.adapter.GetAliases(ctx, url)
+}
+
+func (u *Urls) AddAlias(ctx context.Context, alias models.Alias) (models.Alias, error) {
+	return u.adapter.AddAlias(ctx, alias)
+}
+
+func (u *Urls) RemoveAlias(ctx context.Context, alias models.Alias) error {
+	return u.adapter.RemoveAlias(ctx, alias)
+}
+
+func (u *Urls) GetDomains(ctx context.Context) ([]models.Domain, error) {
+	return u.adapter.GetDomains(ctx)
+}
+
+func (u *Urls) GetDomain(ctx context.Context, domain models.Domain) (models.Domain, error) {
+	return u.adapter.GetDomain(ctx, domain)
+}
+
+func (u *Urls) AddDomain(ctx context.Context, domain models.Domain) (models.Domain, error) {
+	return u.adapter.AddDomain(ctx, domain)
+}
+
+func (u *Urls) UpdateDomain(ctx context.Context, domain models.Domain) (models.Domain, error) {
+	return u.adapter.UpdateDomain(ctx, domain)
+}
+
+func (u *Urls) VerifyDomain(ctx context.Context, domain models.Domain) (models.Domain, error) {
+	return u.adapter.VerifyDomain(ctx, domain)
+}
+
+func (u *Urls) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return u.resolver.LookupTXT(ctx, name)
+}
+
+func (u *Urls) QueueClick(ctx context.Context, url models.Url, destination string) error {
+	return u.adapter.QueueClick(ctx, url, destination)
+}
+
+func (u *Urls) GetWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	return u.adapter.GetWebhooks(ctx)
+}
+
+func (u *Urls) AddWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error) {
+	return u.adapter.AddWebhook(ctx, webhook)
+}
+
+func (u *Urls) UpdateWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error) {
+	return u.adapter.UpdateWebhook(ctx, webhook)
+}
+
+func (u *Urls) RemoveWebhook(ctx context.Context, webhook models.Webhook) error {
+	return u.adapter.RemoveWebhook(ctx, webhook)
+}
+
+func (u *Urls) GetDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]models.Delivery, error) {
+	return u.adapter.GetDeliveries(ctx, filter)
+}
+
+func (u *Urls) ClaimDeliveries(ctx context.Context, now time.Time, limit int, leaseUntil time.Time) ([]models.Delivery, error) {
+	return u.adapter.ClaimDeliveries(ctx, now, limit, leaseUntil)
+}
+
+func (u *Urls) SaveDelivery(ctx context.Context, delivery models.Delivery) error {
+	return u.adapter.SaveDelivery(ctx, delivery)
+}
+
+func (u *Urls) RetryDelivery(ctx context.Context, delivery models.Delivery) (models.Delivery, error) {
+	return u.adapter.RetryDelivery(ctx, delivery)
+}
+
+func (u *Urls) PruneDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	return u.adapter.PruneDeliveries(ctx, before)
+}
+
+// SendWebhook posts the signed payload of the delivery to its webhook.
+func (u *Urls) SendWebhook(ctx context.Context, delivery models.Delivery) (int, error) {
+	return u.webhooks.Send(ctx, webhook.Message{
+		Url:      delivery.Url,
+		Secret:   delivery.Secret,
+		Event:    delivery.Event,
+		Delivery: delivery.Id,
+		Body:     delivery.Payload,
+	})
+}
+
+func (u *Urls) GetEvents(ctx context.Context, after models.Checkpoint, limit int) ([]models.LinkEvent, error) {
+	return u.adapter.GetEvents(ctx, after, limit)
+}
+
+func (u *Urls) GetCheckpoint(ctx context.Context, name string) (models.Checkpoint, error) {
+	return u.adapter.GetCheckpoint(ctx, name)
+}
+
+func (u *Urls) SaveCheckpoint(ctx context.Context, checkpoint models.Checkpoint) error {
+	return u.adapter.SaveCheckpoint(ctx, checkpoint)
+}
+
+func (u *Urls) PruneEvents(ctx context.Context, before time.Time) (int64, error) {
+	return u.adapter.PruneEvents(ctx, before)
+}
+
+func (u *Urls) PublishEvents(ctx context.Context, linkEvents []models.LinkEvent) error {
+	if u.publisher == nil {
+		return errors.New("no event sink is configured")
+	}
+	return u.publisher.Publish(ctx, linkEvents)
+}
+
 func (u *Urls) GenerateUrl(_ context.Context) string {
-	return generator.RandomString()
+	return u.generate()
 }
 
 func (u *Urls) ValidateUrl(ctx context.Context, url string) bool {
 	return urlvalidator.ValidateUrl(ctx, url)
 }
+
+func (u *Urls) HashPassword(_ context.Context, plain string) (string, error) {
+	return password.Hash(plain)
+}
+
+func (u *Urls) ComparePassword(_ context.Context, hash, plain string) bool {
+	return password.Compare(hash, plain)
+}
+
+func (u *Urls) GetGeoRules(ctx context.Context, url models.Url) ([]models.GeoRule, error) {
+	return u.adapter.GetGeoRules(ctx, url)
+}
+
+func (u *Urls) SetGeoRules(ctx context.Context, url models.Url, rules []models.GeoRule) error {
+	return u.adapter.SetGeoRules(ctx, url, rules)
+}
+
+func (u *Urls) GetDeviceRules(ctx context.Context, url models.Url) ([]models.DeviceRule, error) {
+	return u.adapter.GetDeviceRules(ctx, url)
+}
+
+func (u *Urls) SetDeviceRules(ctx context.Context, url models.Url, rules []models.DeviceRule) error {
+	return u.adapter.SetDeviceRules(ctx, url, rules)
+}
+
+func (u *Urls) GetVariants(ctx context.Context, url models.Url) ([]models.Variant, error) {
+	return u.adapter.GetVariants(ctx, url)
+}
+
+func (u *Urls) SetVariants(ctx context.Context, url models.Url, variants []models.Variant) error {
+	return u.adapter.SetVariants(ctx, url, variants)
+}
+
+func (u *Urls) SetTags(ctx context.Context, url models.Url, tags []string) error {
+	return u.adapter.SetTags(ctx, url, tags)
+}
+
+func (u *Urls) IncrementVariantClicks(ctx context.Context, variant models.Variant) error {
+	return u.adapter.IncrementVariantClicks(ctx, variant)
+}
+
+// LookupCountry returns an empty string when no GeoIP database is configured or the ip is unknown.
+func (u *Urls) LookupCountry(_ context.Context, ip string) string {
+	if u.geo == nil {
+		return ""
+	}
+
+	country, err := u.geo.Country(ip)
+	if err != nil {
+		log.Println(err)
+	}
+	return country
+}
+
+func (u *Urls) GetHistory(ctx context.Context, url models.Url) ([]models.LinkVersion, error) {
+	return u.adapter.GetHistory(ctx, url)
+}
+
+func (u *Urls) GetVersion(ctx context.Context, version models.LinkVersion) (models.LinkVersion, error) {
+	return u.adapter.GetVersion(ctx, version)
+}
+
+func (u *Urls) Rollback(ctx context.Context, url models.Url) (models.Url, error) {
+	return u.adapter.Rollback(ctx, url)
+}
+
+func (u *Urls) Search(ctx context.Context, search models.Search) ([]models.SearchResult, error) {
+	return u.adapter.Search(ctx, search)
+}
+
+func (u *Urls) GetUnenriched(ctx context.Context, limit int) ([]models.Url, error) {
+	return u.adapter.GetUnenriched(ctx, limit)
+}
+
+func (u *Urls) SetPageMeta(ctx context.Context, url models.Url, meta models.PageMeta) error {
+	return u.adapter.SetPageMeta(ctx, url, meta)
+}
+
+func (u *Urls) FetchPageMeta(ctx context.Context, url string) (models.PageMeta, error) {
+	return u.fetcher.Fetch(ctx, url)
+}
@@ -1,9 +1,12 @@
 package requestparser
 
 import (
+	"bufio"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 
 	"github.com/kristina71/bitlytest/pkg/models"
 )
@@ -22,3 +25,111 @@ func Unmarshal(w http.ResponseWriter, r *http.Request) (models.Url, []byte, erro
 
 	return url, resp, nil
 }
+
+// UnmarshalUpdate reads the edit of a link. The optional settings missing from the body are listed in
+// Omitted, so they keep their stored values.
+func UnmarshalUpdate(w http.ResponseWriter, r *http.Request) (models.Url, error) {
+	url, body, err := Unmarshal(w, r)
+	if err != nil {
+		return url, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err = json.Unmarshal(body, &fields); err != nil {
+		return url, err
+	}
+	for _, setting := range models.OptionalSettings {
+		if _, ok := fields[setting]; !ok {
+			url.Omitted = append(url.Omitted, setting)
+		}
+	}
+
+	return url, nil
+}
+
+// UnmarshalBody decodes a json body into any request model.
+func UnmarshalBody(r *http.Request, v interface{}) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		return models.BadRequestError(err.Error())
+	}
+	return nil
+}
+
+// UnmarshalList reads either a JSON array of urls or a stream of newline delimited url objects.
+func UnmarshalList(w http.ResponseWriter, r *http.Request) ([]models.Url, error) {
+	reader := bufio.NewReader(r.Body)
+	urls := []models.Url{}
+
+	first, err := peekNonSpace(reader)
+	if err == io.EOF {
+		return urls, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(reader)
+	if first == '[' {
+		err = decoder.Decode(&urls)
+		if err != nil {
+			return nil, models.BadRequestError(err.Error())
+		}
+		return urls, nil
+	}
+
+	for {
+		url := models.Url{}
+		err = decoder.Decode(&url)
+		if err == io.EOF {
+			return urls, nil
+		}
+		if err != nil {
+			return nil, models.BadRequestError(err.Error())
+		}
+		urls = append(urls, url)
+	}
+}
+
+// ParseFilter reads listing filters from the query string.
+func ParseFilter(r *http.Request) models.UrlFilter {
+	query := r.URL.Query()
+	return models.UrlFilter{
+		Status: query.Get("status"),
+		Tag:    query.Get("tag"),
+	}
+}
+
+// ParseSearch reads a search from the query string, a missing or broken limit is left to the service.
+func ParseSearch(r *http.Request) models.Search {
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	return models.Search{
+		Query: query.Get("q"),
+		Limit: limit,
+	}
+}
+
+// ParseDeliveryFilter reads the webhook and status to list deliveries of from the query string.
+func ParseDeliveryFilter(r *http.Request) models.DeliveryFilter {
+	query := r.URL.Query()
+	webhookId, _ := strconv.ParseInt(query.Get("webhook_id"), 10, 64)
+	return models.DeliveryFilter{
+		WebhookId: webhookId,
+		Status:    query.Get("status"),
+	}
+}
+
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, reader.UnreadByte()
+	}
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/pkg/errors"
+)
+
+func (s Service) GetAliases(ctx context.Context, url models.Url) ([]models.Alias, error) {
+	url, err := s.repo.GetById(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetAliases(ctx, url)
+}
+
+// AddAlias gives the link one more short code. Clicks through any alias are counted for the link.
+// An empty code gets a generated one.
+func (s Service) AddAlias(ctx context.Context, alias models.Alias) (models.Alias, error) {
+	url, err := s.repo.GetById(ctx, models.Url{Id: alias.UrlId})
+	if err != nil {
+		return alias, err
+	}
+	if url.DeletedAt != nil {
+		return alias, models.GoneError()
+	}
+
+	alias.Code = strings.TrimSpace(alias.Code)
+	if err = s.checkSmallUrl(alias.Code); err != nil {
+		return alias, err
+	}
+	if alias.Code == "" {
+		alias.Code = s.repo.GenerateUrl(ctx)
+	}
+
+	alias.Domain = url.Domain
+	_, err = s.repo.GetBySmallUrl(ctx, models.Url{Domain: alias.Domain, SmallUrl: alias.Code})
+	switch {
+	case err == nil:
+		return alias, models.BadRequestError("small url " + alias.Code + " is already taken")
+	case !errors.As(err, &models.NotFound{}):
+		return alias, err
+	}
+
+	return s.repo.AddAlias(ctx, alias)
+}
+
+// RemoveAlias drops a secondary code of the link. The primary one is the small url and changes with edits.
+func (s Service) RemoveAlias(ctx context.Context, alias models.Alias) error {
+	url, err := s.repo.GetById(ctx, models.Url{Id: alias.UrlId})
+	if err != nil {
+		return err
+	}
+
+	alias.Code = strings.TrimSpace(alias.Code)
+	if alias.Code == url.SmallUrl {
+		return models.BadRequestError("primary alias " + alias.Code + " can't be removed")
+	}
+
+	return s.repo.RemoveAlias(ctx, alias)
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+)
+
+func (s Service) BulkCreateUrl(ctx context.Context, urls []models.Url) ([]models.BulkResult, error) {
+	if err := s.checkBatch(len(urls)); err != nil {
+		return nil, err
+	}
+
+	results := make([]models.BulkResult, len(urls))
+	for i := range urls {
+		urls[i] = trimUrl(urls[i])
+		results[i].Index = i
+		if err := s.checkSmallUrl(urls[i].SmallUrl); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if urls[i].SmallUrl == "" {
+			urls[i].SmallUrl = s.repo.GenerateUrl(ctx)
+		}
+
+		var err error
+		if urls[i], err = s.canonicalize(urls[i]); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if urls[i], err = s.withDefaults(urls[i]); err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+
+	s.validateBatch(ctx, urls, results)
+
+	var err error
+	seen := make(map[string]bool, len(urls))
+	valid := make([]int, 0, len(urls))
+	for i, url := range urls {
+		if results[i].Error != "" {
+			continue
+		}
+		if seen[s.codeKey(url)] {
+			results[i].Error = models.BadRequestError("duplicate small url in batch").Error()
+			continue
+		}
+		if urls[i], err = s.protect(ctx, url); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		seen[s.codeKey(url)] = true
+		valid = append(valid, i)
+	}
+
+	for _, chunk := range chunkIndexes(valid, s.cfg.BulkChunkSize) {
+		batch := make([]models.Url, 0, len(chunk))
+		for _, i := range chunk {
+			batch = append(batch, urls[i])
+		}
+
+		inserted, err := s.repo.InsertBatch(ctx, batch)
+		if err != nil {
+			for _, i := range chunk {
+				results[i].Error = err.Error()
+			}
+			continue
+		}
+
+		bySmallUrl := make(map[string]models.Url, len(inserted))
+		for _, url := range inserted {
+			bySmallUrl[s.codeKey(url)] = url
+		}
+		for _, i := range chunk {
+			url, ok := bySmallUrl[s.codeKey(urls[i])]
+			if !ok {
+				results[i].Error = models.BadRequestError("small url already exists").Error()
+				continue
+			}
+
+			url.DeviceRules = urls[i].DeviceRules
+			url.Variants = urls[i].Variants
+			url.Tags = urls[i].Tags
+			if url, err = s.saveRelated(ctx, url); err != nil {
+				results[i].Error = err.Error()
+				continue
+			}
+			results[i].Url = &url
+		}
+	}
+
+	return results, nil
+}
+
+func (s Service) BulkDeleteUrl(ctx context.Context, urls []models.Url) ([]models.BulkResult, error) {
+	if err := s.checkBatch(len(urls)); err != nil {
+		return nil, err
+	}
+
+	results := make([]models.BulkResult, len(urls))
+	seen := make(map[uint16]bool, len(urls))
+	indexes := make([]int, 0, len(urls))
+	for i := range urls {
+		results[i].Index = i
+		if seen[urls[i].Id] {
+			results[i].Error = models.BadRequestError("duplicate id in batch").Error()
+			continue
+		}
+		seen[urls[i].Id] = true
+		indexes = append(indexes, i)
+	}
+
+	for _, chunk := range chunkIndexes(indexes, s.cfg.BulkChunkSize) {
+		ids := make([]uint16, 0, len(chunk))
+		for _, i := range chunk {
+			ids = append(ids, urls[i].Id)
+		}
+
+		deleted, err := s.repo.DeleteBatch(ctx, ids)
+		if err != nil {
+			for _, i := range chunk {
+				results[i].Error = err.Error()
+			}
+			continue
+		}
+
+		found := make(map[uint16]bool, len(deleted))
+		for _, id := range deleted {
+			found[id] = true
+		}
+		for _, i := range chunk {
+			if !found[urls[i].Id] {
+				results[i].Error = models.NotFoundError().Error()
+				continue
+			}
+			url := models.Url{Id: urls[i].Id}
+			results[i].Url = &url
+		}
+	}
+
+	return results, nil
+}
+
+func (s Service) checkBatch(size int) error {
+	if size == 0 {
+		return models.BadRequestError("empty batch")
+	}
+	if s.cfg.BulkMaxItems > 0 && size > s.cfg.BulkMaxItems {
+		return models.BadRequestError(fmt.Sprintf("batch is limited to %d items", s.cfg.BulkMaxItems))
+	}
+	return nil
+}
+
+// validateBatch checks origin urls with at most cfg.BulkWorkers requests in flight.
+func (s Service) validateBatch(ctx context.Context, urls []models.Url, results []models.BulkResult) {
+	workers := s.cfg.BulkWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if results[i].Error != "" {
+					continue
+				}
+				if !s.repo.ValidateUrl(ctx, urls[i].OriginUrl) {
+					results[i].Error = models.BadRequestError("invalid origin url").Error()
+					continue
+				}
+				if err := s.checkDomain(ctx, urls[i].Domain); err != nil {
+					results[i].Error = err.Error()
+					continue
+				}
+
+				var err error
+				if urls[i], err = s.checkTargeting(ctx, urls[i]); err != nil {
+					results[i].Error = err.Error()
+				}
+			}
+		}()
+	}
+
+	for i := range urls {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func chunkIndexes(indexes []int, size int) [][]int {
+	if size <= 0 {
+		size = len(indexes)
+	}
+
+	chunks := [][]int{}
+	for len(indexes) > 0 {
+		n := size
+		if n > len(indexes) {
+			n = len(indexes)
+		}
+		chunks = append(chunks, indexes[:n])
+		indexes = indexes[n:]
+	}
+	return chunks
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+)
+
+// builtinReserved are kept for pages the server may serve in the future.
+var builtinReserved = []string{"admin", "api", "assets", "login", "logout", "static"}
+
+// Reserve keeps codes from being taken. Endpoints reserve the paths they route, so a link can never
+// shadow a page or be shadowed by one.
+func (s Service) Reserve(words ...string) {
+	for _, word := range words {
+		s.reserved[strings.ToLower(word)] = true
+	}
+}
+
+// checkSmallUrl validates a code chosen by the user. An empty code is generated later.
+func (s Service) checkSmallUrl(code string) error {
+	if code == "" {
+		return nil
+	}
+
+	if n := utf8.RuneCountInString(code); n < s.cfg.SmallUrlMinLength || n > s.cfg.SmallUrlMaxLength {
+		return models.BadRequestError(fmt.Sprintf("small url must be %d to %d characters long", s.cfg.SmallUrlMinLength, s.cfg.SmallUrlMaxLength))
+	}
+	for _, c := range code {
+		if !isCodeChar(c) {
+			return models.BadRequestError(fmt.Sprintf("small url %q may only contain latin letters, digits, \"-\" and \"_\"", code))
+		}
+	}
+	if s.reserved[strings.ToLower(code)] {
+		return models.BadRequestError(fmt.Sprintf("small url %q is reserved", code))
+	}
+	return nil
+}
+
+func isCodeChar(c rune) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_'
+}
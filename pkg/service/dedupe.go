@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kristina71/bitlytest/pkg/actor"
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/pkg/errors"
+)
+
+// findDuplicate looks up a live link of the same owner to the same destination. Links asking for
+// their own small url or any setting, or forced with force_new, are never deduplicated and get a
+// NotFound error. So does a request whose duplicate has settings of its own: FindByOrigin skips links
+// with tags, targeting rules or variants, the settings of the row are checked here.
+func (s Service) findDuplicate(ctx context.Context, link models.Url) (models.Url, error) {
+	if link.SmallUrl != "" || link.ForceNew || !s.plain(link) || !s.dedupes(actor.From(ctx)) {
+		return link, errors.WithStack(models.NotFoundError())
+	}
+
+	existing, err := s.repo.FindByOrigin(ctx, link)
+	if err != nil {
+		return existing, err
+	}
+	if !s.plain(existing) {
+		return link, errors.WithStack(models.NotFoundError())
+	}
+	return existing, nil
+}
+
+// plain reports whether a link has nothing but the default settings.
+func (s Service) plain(link models.Url) bool {
+	return link.RedirectType == s.cfg.DefaultRedirectType && link.QueryPolicy == models.QueryDrop && !link.AlwaysPreview &&
+		link.Password == "" && link.PasswordHash == "" && link.ActiveFrom == nil && link.ActiveUntil == nil &&
+		link.UtmSource == "" && link.UtmMedium == "" && link.UtmCampaign == "" &&
+		link.Title == "" && link.Notes == "" && len(link.Tags) == 0 &&
+		len(link.DeviceRules) == 0 && len(link.Variants) == 0
+}
+
+func (s Service) dedupes(owner string) bool {
+	for _, o := range s.cfg.DedupeOwners {
+		if o == "*" || o == owner {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	neturl "net/url"
+	"strings"
+
+	"github.com/kristina71/bitlytest/pkg/canonical"
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/pkg/errors"
+)
+
+const (
+	txtNamePrefix  = "_bitlytest."
+	txtValuePrefix = "bitlytest-verify="
+)
+
+func (s Service) GetDomains(ctx context.Context) ([]models.Domain, error) {
+	domains, err := s.repo.GetDomains(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range domains {
+		domains[i] = withVerification(domains[i])
+	}
+	return domains, nil
+}
+
+// AddDomain registers a custom host. Links can be bound to it once VerifyDomain finds its TXT record.
+func (s Service) AddDomain(ctx context.Context, domain models.Domain) (models.Domain, error) {
+	domain, err := s.checkDomainSettings(domain)
+	if err != nil {
+		return domain, err
+	}
+
+	_, err = s.repo.GetDomain(ctx, domain)
+	switch {
+	case err == nil:
+		return domain, models.BadRequestError("domain " + domain.Host + " is already registered")
+	case !errors.As(err, &models.NotFound{}):
+		return domain, err
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return domain, err
+	}
+	domain.VerifyToken = hex.EncodeToString(token)
+
+	added, err := s.repo.AddDomain(ctx, domain)
+	return withVerification(added), err
+}
+
+// UpdateDomain changes the url visitors of unknown codes on the domain are sent to.
+func (s Service) UpdateDomain(ctx context.Context, domain models.Domain) (models.Domain, error) {
+	domain, err := s.checkDomainSettings(domain)
+	if err != nil {
+		return domain, err
+	}
+
+	updated, err := s.repo.UpdateDomain(ctx, domain)
+	return withVerification(updated), err
+}
+
+// VerifyDomain looks for the TXT record proving control of the host.
+func (s Service) VerifyDomain(ctx context.Context, domain models.Domain) (models.Domain, error) {
+	host, err := domainHost(domain.Host)
+	if err != nil {
+		return domain, err
+	}
+
+	domain, err = s.repo.GetDomain(ctx, models.Domain{Host: host})
+	if err != nil {
+		return domain, err
+	}
+	domain = withVerification(domain)
+	if domain.Verified() {
+		return domain, nil
+	}
+
+	records, err := s.repo.LookupTXT(ctx, domain.TxtName)
+	dnsErr := &net.DNSError{}
+	if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		return domain, err
+	}
+
+	for _, record := range records {
+		if strings.TrimSpace(record) == domain.TxtValue {
+			verified, err := s.repo.VerifyDomain(ctx, domain)
+			return withVerification(verified), err
+		}
+	}
+	return domain, models.BadRequestError("TXT record " + domain.TxtName + " does not contain " + domain.TxtValue)
+}
+
+// checkDomain only lets links be bound to verified domains. An empty host is the default one.
+func (s Service) checkDomain(ctx context.Context, host string) error {
+	if host == "" {
+		return nil
+	}
+
+	domain, err := s.repo.GetDomain(ctx, models.Domain{Host: host})
+	switch {
+	case errors.As(err, &models.NotFound{}):
+		return models.BadRequestError("unknown domain " + host)
+	case err != nil:
+		return err
+	case !domain.Verified():
+		return models.BadRequestError("domain " + host + " is not verified")
+	}
+	return nil
+}
+
+// servingDomain finds the verified domain a request to host is for. Any other host serves the links
+// without a domain.
+func (s Service) servingDomain(ctx context.Context, host string) (models.Domain, error) {
+	if host == "" {
+		return models.Domain{}, nil
+	}
+
+	domain, err := s.repo.GetDomain(ctx, models.Domain{Host: host})
+	switch {
+	case errors.As(err, &models.NotFound{}):
+		return models.Domain{}, nil
+	case err != nil:
+		return domain, err
+	case !domain.Verified():
+		return models.Domain{}, nil
+	}
+	return domain, nil
+}
+
+// bySmallUrl resolves a code requested on the host in url.Domain. Unknown codes of a domain with a
+// fallback url give a NotFound error carrying it.
+func (s Service) bySmallUrl(ctx context.Context, url models.Url) (models.Url, error) {
+	domain, err := s.servingDomain(ctx, url.Domain)
+	if err != nil {
+		return url, err
+	}
+
+	url.Domain = domain.Host
+	url, err = s.repo.GetBySmallUrl(ctx, url)
+	if errors.As(err, &models.NotFound{}) && domain.FallbackUrl != "" {
+		return url, models.NotFoundFallbackError(domain.FallbackUrl)
+	}
+	return url, err
+}
+
+func (s Service) checkDomainSettings(domain models.Domain) (models.Domain, error) {
+	host, err := domainHost(domain.Host)
+	if err != nil {
+		return domain, err
+	}
+	domain.Host = host
+
+	domain.FallbackUrl = strings.TrimSpace(domain.FallbackUrl)
+	if domain.FallbackUrl == "" {
+		return domain, nil
+	}
+	domain.FallbackUrl, err = canonical.Url(domain.FallbackUrl, canonical.Options{StripTracking: s.cfg.StripTrackingParams})
+	if err != nil || !isAbsoluteUrl(domain.FallbackUrl) {
+		return domain, models.BadRequestError("invalid fallback url")
+	}
+	return domain, nil
+}
+
+// domainHost checks a bare host name and brings it to its punycode form.
+func domainHost(raw string) (string, error) {
+	host, err := canonical.Host(strings.TrimSuffix(strings.TrimSpace(raw), "."))
+	if err != nil || host == "" {
+		return "", models.BadRequestError("invalid domain " + raw)
+	}
+
+	parsed, err := neturl.Parse("http://" + host)
+	if err != nil || parsed.Host != host || parsed.Port() != "" || strings.ContainsAny(host, "[]@") {
+		return "", models.BadRequestError("invalid domain " + raw)
+	}
+	return host, nil
+}
+
+func withVerification(domain models.Domain) models.Domain {
+	if domain.Host == "" {
+		return domain
+	}
+	domain.TxtName = txtNamePrefix + domain.Host
+	domain.TxtValue = txtValuePrefix + domain.VerifyToken
+	return domain
+}
+
+// codeKey identifies a code among links of all domains.
+func (s Service) codeKey(url models.Url) string {
+	if s.cfg.CaseInsensitiveCodes {
+		return url.Domain + "/" + strings.ToLower(url.SmallUrl)
+	}
+	return url.Domain + "/" + url.SmallUrl
+}
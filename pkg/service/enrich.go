@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+)
+
+// Enrich fetches the destinations of links that were not enriched yet and stores their page metadata.
+// A failed fetch still marks the link, so a broken page is not retried on every pass.
+func (s Service) Enrich(ctx context.Context) (int, error) {
+	urls, err := s.repo.GetUnenriched(ctx, s.cfg.EnrichBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, url := range urls {
+		meta, err := s.repo.FetchPageMeta(ctx, url.OriginUrl)
+		if err != nil {
+			log.Println(err)
+			meta = models.PageMeta{}
+		}
+
+		if err = s.repo.SetPageMeta(ctx, url, meta); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(urls), nil
+}
+
+// RunEnrichment enriches new links every interval until ctx is done.
+func (s Service) RunEnrichment(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.EnrichInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep going without waiting while there is a backlog.
+		for {
+			n, err := s.Enrich(ctx)
+			if err != nil {
+				log.Println(err)
+			}
+			if err != nil || n < s.cfg.EnrichBatch {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RelayEvents publishes the next batch of link events and moves the checkpoint past them. The checkpoint
+// only moves once the sink accepted the events, so a failure or a crash sends them again: events are
+// delivered at least once and consumers should ignore ids they have already seen.
+func (s Service) RelayEvents(ctx context.Context) (int, error) {
+	checkpoint, err := s.repo.GetCheckpoint(ctx, s.cfg.EventsRelay)
+	if err != nil {
+		return 0, err
+	}
+
+	linkEvents, err := s.repo.GetEvents(ctx, checkpoint, s.cfg.EventsBatch)
+	if err != nil || len(linkEvents) == 0 {
+		return 0, err
+	}
+
+	if err = s.repo.PublishEvents(ctx, linkEvents); err != nil {
+		return 0, err
+	}
+
+	last := linkEvents[len(linkEvents)-1]
+	checkpoint.TxId = last.TxId
+	checkpoint.EventId = last.Id
+	return len(linkEvents), s.repo.SaveCheckpoint(ctx, checkpoint)
+}
+
+// PruneEvents removes relayed events that are older than the retention period.
+func (s Service) PruneEvents(ctx context.Context) (int64, error) {
+	return s.repo.PruneEvents(ctx, time.Now().UTC().Add(-s.cfg.EventsRetention))
+}
+
+// RunEventRelay relays link events every interval until ctx is done. A failed batch is retried after
+// a wait that doubles up to a minute, so a sink that is down is not hammered.
+func (s Service) RunEventRelay(ctx context.Context) {
+	wait := s.cfg.EventsInterval
+	for {
+		for {
+			n, err := s.RelayEvents(ctx)
+			if err != nil {
+				log.Println(err)
+				wait *= 2
+				if wait > time.Minute {
+					wait = time.Minute
+				}
+				break
+			}
+			wait = s.cfg.EventsInterval
+			if n < s.cfg.EventsBatch {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
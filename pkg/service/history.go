@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/pkg/errors"
+)
+
+func (s Service) GetHistory(ctx context.Context, url models.Url) ([]models.LinkVersion, error) {
+	url, err := s.repo.GetById(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetHistory(ctx, url)
+}
+
+// RollbackUrl restores the link to the state right after the given version. The rollback is itself
+// recorded, so it can be undone the same way.
+func (s Service) RollbackUrl(ctx context.Context, rollback models.Rollback) (models.Url, error) {
+	url, err := s.repo.GetById(ctx, models.Url{Id: rollback.Id})
+	if err != nil {
+		return url, err
+	}
+
+	version, err := s.repo.GetVersion(ctx, models.LinkVersion{Id: rollback.VersionId})
+	if err != nil {
+		return url, err
+	}
+	if version.UrlId != url.Id || version.New == nil {
+		return url, errors.WithStack(models.NotFoundError())
+	}
+
+	restored := version.New.Apply(url)
+	if restored.SmallUrl != url.SmallUrl {
+		taken, err := s.repo.GetBySmallUrl(ctx, restored)
+		switch {
+		case err == nil && taken.Id != url.Id:
+			return url, models.BadRequestError("small url " + restored.SmallUrl + " is used by another link")
+		case err != nil && !errors.As(err, &models.NotFound{}):
+			return url, err
+		}
+	}
+
+	return s.repo.Rollback(ctx, restored)
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+)
+
+func (s Service) Search(ctx context.Context, search models.Search) ([]models.SearchResult, error) {
+	search.Query = strings.TrimSpace(search.Query)
+	if search.Query == "" {
+		return nil, models.BadRequestError("search query is empty")
+	}
+
+	switch {
+	case search.Limit == 0:
+		search.Limit = defaultSearchLimit
+	case search.Limit < 0 || search.Limit > maxSearchLimit:
+		return nil, models.BadRequestError(fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit))
+	}
+
+	return s.repo.Search(ctx, search)
+}
@@ -3,45 +3,153 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/kristina71/bitlytest/pkg/canonical"
+	"github.com/kristina71/bitlytest/pkg/config"
 	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/kristina71/bitlytest/pkg/throttle"
 
 	_ "github.com/lib/pq"
 )
 
 type Repository interface {
 	Insert(ctx context.Context, url models.Url) (uint16, error)
+	InsertBatch(ctx context.Context, urls []models.Url) ([]models.Url, error)
 	Update(ctx context.Context, url models.Url) error
 	Delete(ctx context.Context, url models.Url) error
-	Get(ctx context.Context) ([]models.Url, error)
+	DeleteBatch(ctx context.Context, ids []uint16) ([]uint16, error)
+	Restore(ctx context.Context, url models.Url) (models.Url, error)
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	Get(ctx context.Context, filter models.UrlFilter) ([]models.Url, error)
+	Export(ctx context.Context, fn func(url models.Url) error) error
 	GetBySmallUrl(ctx context.Context, url models.Url) (models.Url, error)
+	GetById(ctx context.Context, url models.Url) (models.Url, error)
+	FindByOrigin(ctx context.Context, url models.Url) (models.Url, error)
+	GetAliases(ctx context.Context, url models.Url) ([]models.Alias, error)
+	AddAlias(ctx context.Context, alias models.Alias) (models.Alias, error)
+	RemoveAlias(ctx context.Context, alias models.Alias) error
+	GetDomains(ctx context.Context) ([]models.Domain, error)
+	GetDomain(ctx context.Context, domain models.Domain) (models.Domain, error)
+	AddDomain(ctx context.Context, domain models.Domain) (models.Domain, error)
+	UpdateDomain(ctx context.Context, domain models.Domain) (models.Domain, error)
+	VerifyDomain(ctx context.Context, domain models.Domain) (models.Domain, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	GetGeoRules(ctx context.Context, url models.Url) ([]models.GeoRule, error)
+	SetGeoRules(ctx context.Context, url models.Url, rules []models.GeoRule) error
+	GetDeviceRules(ctx context.Context, url models.Url) ([]models.DeviceRule, error)
+	SetDeviceRules(ctx context.Context, url models.Url, rules []models.DeviceRule) error
+	GetVariants(ctx context.Context, url models.Url) ([]models.Variant, error)
+	SetVariants(ctx context.Context, url models.Url, variants []models.Variant) error
+	SetTags(ctx context.Context, url models.Url, tags []string) error
+	Search(ctx context.Context, search models.Search) ([]models.SearchResult, error)
+	GetHistory(ctx context.Context, url models.Url) ([]models.LinkVersion, error)
+	GetVersion(ctx context.Context, version models.LinkVersion) (models.LinkVersion, error)
+	Rollback(ctx context.Context, url models.Url) (models.Url, error)
+	GetUnenriched(ctx context.Context, limit int) ([]models.Url, error)
+	SetPageMeta(ctx context.Context, url models.Url, meta models.PageMeta) error
+	FetchPageMeta(ctx context.Context, url string) (models.PageMeta, error)
+	IncrementVariantClicks(ctx context.Context, variant models.Variant) error
+	QueueClick(ctx context.Context, url models.Url, destination string) error
+	GetWebhooks(ctx context.Context) ([]models.Webhook, error)
+	AddWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error)
+	RemoveWebhook(ctx context.Context, webhook models.Webhook) error
+	GetDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]models.Delivery, error)
+	ClaimDeliveries(ctx context.Context, now time.Time, limit int, leaseUntil time.Time) ([]models.Delivery, error)
+	SaveDelivery(ctx context.Context, delivery models.Delivery) error
+	RetryDelivery(ctx context.Context, delivery models.Delivery) (models.Delivery, error)
+	SendWebhook(ctx context.Context, delivery models.Delivery) (int, error)
+	PruneDeliveries(ctx context.Context, before time.Time) (int64, error)
+	GetEvents(ctx context.Context, after models.Checkpoint, limit int) ([]models.LinkEvent, error)
+	GetCheckpoint(ctx context.Context, name string) (models.Checkpoint, error)
+	SaveCheckpoint(ctx context.Context, checkpoint models.Checkpoint) error
+	PruneEvents(ctx context.Context, before time.Time) (int64, error)
+	PublishEvents(ctx context.Context, linkEvents []models.LinkEvent) error
+	LookupCountry(ctx context.Context, ip string) string
 	GenerateUrl(ctx context.Context) string
 	ValidateUrl(ctx context.Context, url string) bool
+	HashPassword(ctx context.Context, password string) (string, error)
+	ComparePassword(ctx context.Context, hash, password string) bool
 }
 
 type Service struct {
-	repo Repository
+	repo     Repository
+	cfg      config.Cfg
+	unlocks  *throttle.Limiter
+	secret   []byte
+	reserved map[string]bool
 }
 
-func New(repo Repository) *Service {
-	return &Service{repo: repo}
+func New(repo Repository, cfg config.Cfg) *Service {
+	s := &Service{
+		repo:     repo,
+		cfg:      cfg,
+		unlocks:  throttle.New(cfg.UnlockMaxAttempts, cfg.UnlockWindow),
+		secret:   cookieSecret(cfg),
+		reserved: map[string]bool{},
+	}
+	s.Reserve(builtinReserved...)
+	s.Reserve(cfg.ReservedWords...)
+	return s
 }
 
 func (s Service) CreateUrl(ctx context.Context, url models.Url) (models.Url, error) {
 	url = trimUrl(url)
 
+	url, err := s.canonicalize(url)
+	if err != nil {
+		return url, err
+	}
+
+	if err = s.checkSmallUrl(url.SmallUrl); err != nil {
+		return url, err
+	}
+
+	url, err = s.withDefaults(url)
+	if err != nil {
+		return url, err
+	}
+
 	if !s.repo.ValidateUrl(ctx, url.OriginUrl) {
 		return url, models.BadRequestError("invalid origin url")
 	}
 
+	if err = s.checkDomain(ctx, url.Domain); err != nil {
+		return url, err
+	}
+
+	existing, err := s.findDuplicate(ctx, url)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.As(err, &models.NotFound{}) {
+		return url, err
+	}
+
+	url, err = s.protect(ctx, url)
+	if err != nil {
+		return url, err
+	}
+
+	url, err = s.checkTargeting(ctx, url)
+	if err != nil {
+		return url, err
+	}
+
 	if url.SmallUrl == "" {
 		url.SmallUrl = s.repo.GenerateUrl(ctx)
 	}
 
-	var err error
 	url.Id, err = s.repo.Insert(ctx, url)
-	return url, err
+	if err != nil {
+		return url, err
+	}
+
+	return s.saveRelated(ctx, url)
 }
 
 func (s Service) DeleteUrl(ctx context.Context, url models.Url) error {
@@ -51,6 +159,19 @@ func (s Service) DeleteUrl(ctx context.Context, url models.Url) error {
 func (s Service) UpdateUrl(ctx context.Context, url models.Url) (models.Url, error) {
 	url = trimUrl(url)
 
+	url, err := s.canonicalize(url)
+	if err != nil {
+		return url, err
+	}
+
+	if err = s.checkSmallUrl(url.SmallUrl); err != nil {
+		return url, err
+	}
+
+	if err := checkSettings(url); err != nil {
+		return url, err
+	}
+
 	if !s.repo.ValidateUrl(ctx, url.OriginUrl) {
 		return url, errors.New("invalid origin url")
 	}
@@ -59,17 +180,171 @@ func (s Service) UpdateUrl(ctx context.Context, url models.Url) (models.Url, err
 		url.SmallUrl = s.repo.GenerateUrl(ctx)
 	}
 
-	err := s.repo.Update(ctx, url)
-	return url, err
+	url, err = s.protect(ctx, url)
+	if err != nil {
+		return url, err
+	}
+
+	url, err = s.checkTargeting(ctx, url)
+	if err != nil {
+		return url, err
+	}
 
+	err = s.repo.Update(ctx, url)
+	if err != nil {
+		return url, err
+	}
+
+	return s.saveRelated(ctx, url)
 }
 
+// GetUrl finds a link for redirecting, url.Domain holds the host the link was requested on.
+// Links outside of their activation window give an Inactive error.
 func (s Service) GetUrl(ctx context.Context, url models.Url) (models.Url, error) {
-	return s.repo.GetBySmallUrl(ctx, url)
+	url, err := s.bySmallUrl(ctx, url)
+	if err != nil {
+		return url, err
+	}
+
+	if url.DeletedAt != nil {
+		return url, models.GoneError()
+	}
+
+	if status := activeStatus(url, time.Now()); status != models.StatusActive {
+		return url, models.InactiveError(url, status, s.cfg.InactiveFallbackUrl)
+	}
+	return url, nil
+}
+
+// GetLink finds a link for managing it, by id or else by its small url on url.Domain. Unlike GetUrl
+// it also returns deleted links and links outside of their activation window.
+func (s Service) GetLink(ctx context.Context, url models.Url) (models.Url, error) {
+	if url.Id != 0 {
+		return s.repo.GetById(ctx, url)
+	}
+	return s.bySmallUrl(ctx, url)
 }
 
-func (s Service) GetAllUrl(ctx context.Context) ([]models.Url, error) {
-	return s.repo.Get(ctx)
+func (s Service) GetAllUrl(ctx context.Context, filter models.UrlFilter) ([]models.Url, error) {
+	switch filter.Status {
+	case "", models.StatusScheduled, models.StatusActive, models.StatusEnded:
+	default:
+		return nil, models.BadRequestError("unknown status " + filter.Status)
+	}
+	filter.Tag = strings.ToLower(strings.TrimSpace(filter.Tag))
+
+	return s.repo.Get(ctx, filter)
+}
+
+func activeStatus(url models.Url, now time.Time) string {
+	switch {
+	case url.ActiveFrom != nil && now.Before(*url.ActiveFrom):
+		return models.StatusScheduled
+	case url.ActiveUntil != nil && !now.Before(*url.ActiveUntil):
+		return models.StatusEnded
+	default:
+		return models.StatusActive
+	}
+}
+
+// withDefaults fills settings a new link did not specify from the config.
+func (s Service) withDefaults(url models.Url) (models.Url, error) {
+	if url.RedirectType == "" {
+		url.RedirectType = s.cfg.DefaultRedirectType
+	}
+	if url.QueryPolicy == "" {
+		url.QueryPolicy = models.QueryDrop
+	}
+	return url, checkSettings(url)
+}
+
+const (
+	maxTitleLength = 200
+	maxTags        = 20
+	maxTagLength   = 50
+)
+
+func checkSettings(url models.Url) error {
+	if url.RedirectType != "" && !models.IsRedirectType(url.RedirectType) {
+		return models.BadRequestError("unknown redirect type " + url.RedirectType)
+	}
+	if url.QueryPolicy != "" && !models.IsQueryPolicy(url.QueryPolicy) {
+		return models.BadRequestError("unknown query policy " + url.QueryPolicy)
+	}
+	if url.ActiveFrom != nil && url.ActiveUntil != nil && !url.ActiveUntil.After(*url.ActiveFrom) {
+		return models.BadRequestError("active_until must be after active_from")
+	}
+	if utf8.RuneCountInString(url.Title) > maxTitleLength {
+		return models.BadRequestError(fmt.Sprintf("title is longer than %d characters", maxTitleLength))
+	}
+	if len(url.Tags) > maxTags {
+		return models.BadRequestError(fmt.Sprintf("a link can have at most %d tags", maxTags))
+	}
+	for _, tag := range url.Tags {
+		if utf8.RuneCountInString(tag) > maxTagLength || strings.Contains(tag, ",") {
+			return models.BadRequestError(fmt.Sprintf("tag %q must be at most %d characters without commas", tag, maxTagLength))
+		}
+	}
+	return nil
+}
+
+// protect replaces a plain text password with its hash so it is never stored or sent back.
+func (s Service) protect(ctx context.Context, url models.Url) (models.Url, error) {
+	if url.Password == "" {
+		return url, nil
+	}
+
+	hash, err := s.repo.HashPassword(ctx, url.Password)
+	if err != nil {
+		return url, err
+	}
+
+	url.PasswordHash = hash
+	url.Password = ""
+	url.ClearPassword = false
+	return url, nil
+}
+
+// saveRelated stores the device rules, variants and tags of a saved link. They are only replaced when
+// the request has them, an empty list removes all of them.
+func (s Service) saveRelated(ctx context.Context, url models.Url) (models.Url, error) {
+	if url.DeviceRules != nil {
+		if err := s.repo.SetDeviceRules(ctx, url, url.DeviceRules); err != nil {
+			return url, err
+		}
+	}
+
+	if url.Variants != nil {
+		if err := s.repo.SetVariants(ctx, url, url.Variants); err != nil {
+			return url, err
+		}
+	}
+
+	if url.Tags != nil {
+		if err := s.repo.SetTags(ctx, url, url.Tags); err != nil {
+			return url, err
+		}
+	}
+
+	return url, nil
+}
+
+// canonicalize rewrites the origin url to its canonical form, which is what gets validated, stored and
+// compared for deduplication. The domain is brought to the form hosts are registered in.
+func (s Service) canonicalize(url models.Url) (models.Url, error) {
+	origin, err := canonical.Url(url.OriginUrl, canonical.Options{StripTracking: s.cfg.StripTrackingParams})
+	if err != nil {
+		return url, models.BadRequestError("invalid origin url")
+	}
+
+	url.OriginUrl = origin
+
+	domain, err := canonical.Host(strings.TrimSpace(url.Domain))
+	if err != nil {
+		return url, models.BadRequestError("invalid domain " + url.Domain)
+	}
+	url.Domain = domain
+	return url, nil
 }
 
 func trimUrl(url models.Url) models.Url {
@@ -77,5 +352,40 @@ func trimUrl(url models.Url) models.Url {
 	url.SmallUrl = strings.Trim(url.SmallUrl, "/")
 
 	url.OriginUrl = strings.Trim(url.OriginUrl, " ")
+
+	url.Title = strings.TrimSpace(url.Title)
+	url.Notes = strings.TrimSpace(url.Notes)
+	url.Tags = normalizeTags(url.Tags)
+
+	// The activation window columns have no time zone, a client offset would be dropped on the way in.
+	url.ActiveFrom = inUTC(url.ActiveFrom)
+	url.ActiveUntil = inUTC(url.ActiveUntil)
 	return url
 }
+
+func inUTC(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// normalizeTags lowercases tags and drops empty and repeated ones, keeping nil apart from an empty list.
+func normalizeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
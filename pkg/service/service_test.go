@@ -2,12 +2,20 @@ package service_test
 
 import (
 	"context"
+	"errors"
+	"net"
+	neturl "net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/kristina71/bitlytest/mocks"
+	"github.com/kristina71/bitlytest/pkg/actor"
+	"github.com/kristina71/bitlytest/pkg/config"
 	"github.com/kristina71/bitlytest/pkg/models"
 	"github.com/kristina71/bitlytest/pkg/service"
 
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -58,7 +66,7 @@ func TestGetBySmallUrl(t *testing.T) {
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
 			repo := &mocks.Repository{}
-			service := service.New(repo)
+			service := service.New(repo, config.New())
 
 			url := models.Url{
 				SmallUrl: testCase.expectedUrl.SmallUrl,
@@ -130,11 +138,11 @@ func TestGetUrl(t *testing.T) {
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
 			repo := &mocks.Repository{}
-			service := service.New(repo)
+			service := service.New(repo, config.New())
 
-			repo.On("Get", context.Background()).Return(testCase.expectedUrls, nil)
+			repo.On("Get", context.Background(), models.UrlFilter{}).Return(testCase.expectedUrls, nil)
 
-			resUrls, err := service.GetAllUrl(context.Background())
+			resUrls, err := service.GetAllUrl(context.Background(), models.UrlFilter{})
 			require.NoError(t, err)
 
 			require.Equal(t, testCase.expectedUrls, resUrls)
@@ -189,7 +197,7 @@ func TestUpdateUrl(t *testing.T) {
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
 			repo := &mocks.Repository{}
-			service := service.New(repo)
+			service := service.New(repo, config.New())
 			expected := testCase.expectedUrl
 
 			repo.On("ValidateUrl", context.Background(), testCase.expectedUrl.OriginUrl).Return(true)
@@ -254,9 +262,11 @@ func TestInsertUrl(t *testing.T) {
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
 			repo := &mocks.Repository{}
-			service := service.New(repo)
+			service := service.New(repo, config.New())
 
 			expected := testCase.expectedUrl
+			expected.RedirectType = models.RedirectFound
+			expected.QueryPolicy = models.QueryDrop
 
 			repo.On("ValidateUrl", context.Background(), testCase.expectedUrl.OriginUrl).Return(true)
 			if testCase.expectedUrl.SmallUrl == "" || testCase.expectedUrl.SmallUrl == "/" {
@@ -285,7 +295,7 @@ func TestDeleteUrl(t *testing.T) {
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
 			repo := &mocks.Repository{}
-			service := service.New(repo)
+			service := service.New(repo, config.New())
 
 			repo.On("Delete", context.Background(), models.Url{Id: testCase.expectedUrl.Id}).Return(nil)
 
@@ -294,3 +304,1248 @@ func TestDeleteUrl(t *testing.T) {
 		})
 	}
 }
+
+func TestBulkCreateUrl(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	urls := []models.Url{
+		{SmallUrl: "first", OriginUrl: "http://google.com"},
+		{SmallUrl: "second", OriginUrl: "http://invalid.example"},
+		{SmallUrl: "first", OriginUrl: "http://yandex.ru"},
+		{SmallUrl: "taken", OriginUrl: "http://yandex.ru"},
+		{SmallUrl: "", OriginUrl: "http://yandex.ru"},
+	}
+
+	repo.On("GenerateUrl", context.Background()).Return("fdfdfdh")
+	repo.On("ValidateUrl", context.Background(), "http://google.com").Return(true)
+	repo.On("ValidateUrl", context.Background(), "http://yandex.ru").Return(true)
+	repo.On("ValidateUrl", context.Background(), "http://invalid.example").Return(false)
+	repo.On("InsertBatch", context.Background(), []models.Url{
+		{SmallUrl: "first", OriginUrl: "http://google.com", RedirectType: models.RedirectFound, QueryPolicy: models.QueryDrop},
+		{SmallUrl: "taken", OriginUrl: "http://yandex.ru", RedirectType: models.RedirectFound, QueryPolicy: models.QueryDrop},
+		{SmallUrl: "fdfdfdh", OriginUrl: "http://yandex.ru", RedirectType: models.RedirectFound, QueryPolicy: models.QueryDrop},
+	}).Return([]models.Url{
+		{Id: 1, SmallUrl: "first", OriginUrl: "http://google.com"},
+		{Id: 2, SmallUrl: "fdfdfdh", OriginUrl: "http://yandex.ru"},
+	}, nil)
+
+	results, err := service.BulkCreateUrl(context.Background(), urls)
+	require.NoError(t, err)
+	require.Len(t, results, len(urls))
+
+	require.Equal(t, &models.Url{Id: 1, SmallUrl: "first", OriginUrl: "http://google.com"}, results[0].Url)
+	require.Equal(t, "bad request: invalid origin url", results[1].Error)
+	require.Equal(t, "bad request: duplicate small url in batch", results[2].Error)
+	require.Equal(t, "bad request: small url already exists", results[3].Error)
+	require.Equal(t, &models.Url{Id: 2, SmallUrl: "fdfdfdh", OriginUrl: "http://yandex.ru"}, results[4].Url)
+	for i, result := range results {
+		require.Equal(t, i, result.Index)
+	}
+}
+
+func TestBulkCreateUrlKeepsTags(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	inserted := models.Url{Id: 1, SmallUrl: "sale", OriginUrl: "http://google.com"}
+	repo.On("ValidateUrl", context.Background(), "http://google.com").Return(true)
+	repo.On("InsertBatch", context.Background(), mock.Anything).Return([]models.Url{inserted}, nil)
+	repo.On("SetTags", context.Background(), mock.Anything, []string{"promo", "spring"}).Return(nil)
+
+	results, err := service.BulkCreateUrl(context.Background(), []models.Url{
+		{SmallUrl: "sale", OriginUrl: "http://google.com", Tags: []string{" Promo", "spring", "promo"}},
+	})
+	require.NoError(t, err)
+	require.Empty(t, results[0].Error)
+	require.Equal(t, []string{"promo", "spring"}, results[0].Url.Tags)
+	repo.AssertCalled(t, "SetTags", context.Background(), mock.Anything, []string{"promo", "spring"})
+}
+
+func TestBulkDeleteUrl(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	repo.On("DeleteBatch", context.Background(), []uint16{1, 2}).Return([]uint16{2}, nil)
+
+	results, err := service.BulkDeleteUrl(context.Background(), []models.Url{{Id: 1}, {Id: 2}})
+	require.NoError(t, err)
+
+	require.Equal(t, "not found", results[0].Error)
+	require.Equal(t, &models.Url{Id: 2}, results[1].Url)
+
+	// A repeated id is deleted once and the copy is reported.
+	repo.On("DeleteBatch", context.Background(), []uint16{3}).Return([]uint16{3}, nil)
+
+	results, err = service.BulkDeleteUrl(context.Background(), []models.Url{{Id: 3}, {Id: 3}})
+	require.NoError(t, err)
+	require.Equal(t, &models.Url{Id: 3}, results[0].Url)
+	require.Nil(t, results[1].Url)
+	require.Equal(t, "bad request: duplicate id in batch", results[1].Error)
+
+	_, err = service.BulkDeleteUrl(context.Background(), []models.Url{})
+	require.Error(t, err)
+}
+
+func TestImportUrls(t *testing.T) {
+	urls := []models.Url{
+		{SmallUrl: "new", OriginUrl: "http://google.com"},
+		{SmallUrl: "taken", OriginUrl: "http://yandex.ru"},
+		{SmallUrl: "broken", OriginUrl: "yandex"},
+	}
+	taken := models.Url{Id: 7, SmallUrl: "taken", OriginUrl: "http://old.ru"}
+
+	testCases := []struct {
+		name     string
+		opts     models.ImportOptions
+		prepare  func(repo *mocks.Repository)
+		expected models.ImportReport
+	}{
+		{
+			name: "Skip existing",
+			opts: models.ImportOptions{Conflict: models.ConflictSkip},
+			prepare: func(repo *mocks.Repository) {
+				repo.On("Insert", context.Background(), withDefaults(urls[0])).Return(uint16(1), nil)
+			},
+			expected: models.ImportReport{Total: 3, Created: 1, Skipped: 1, Failed: 1},
+		},
+		{
+			name: "Overwrite existing",
+			opts: models.ImportOptions{Conflict: models.ConflictOverwrite},
+			prepare: func(repo *mocks.Repository) {
+				repo.On("Insert", context.Background(), withDefaults(urls[0])).Return(uint16(1), nil)
+				repo.On("Update", context.Background(), models.Url{Id: 7, SmallUrl: "taken", OriginUrl: "http://yandex.ru", RedirectType: models.RedirectFound, QueryPolicy: models.QueryDrop}).Return(nil)
+			},
+			expected: models.ImportReport{Total: 3, Created: 1, Updated: 1, Failed: 1},
+		},
+		{
+			name: "Rename existing",
+			opts: models.ImportOptions{Conflict: models.ConflictRename},
+			prepare: func(repo *mocks.Repository) {
+				repo.On("GenerateUrl", context.Background()).Return("fdfdfdh")
+				repo.On("Insert", context.Background(), withDefaults(urls[0])).Return(uint16(1), nil)
+				repo.On("Insert", context.Background(), models.Url{SmallUrl: "fdfdfdh", OriginUrl: "http://yandex.ru", RedirectType: models.RedirectFound, QueryPolicy: models.QueryDrop}).Return(uint16(2), nil)
+			},
+			expected: models.ImportReport{Total: 3, Created: 2, Renamed: 1, Failed: 1},
+		},
+		{
+			name:     "Dry run does not write",
+			opts:     models.ImportOptions{Conflict: models.ConflictOverwrite, DryRun: true},
+			prepare:  func(repo *mocks.Repository) {},
+			expected: models.ImportReport{DryRun: true, Total: 3, Created: 1, Updated: 1, Failed: 1},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &mocks.Repository{}
+			service := service.New(repo, config.New())
+
+			repo.On("GetBySmallUrl", context.Background(), models.Url{SmallUrl: "new"}).Return(models.Url{}, models.NotFoundError())
+			repo.On("GetBySmallUrl", context.Background(), models.Url{SmallUrl: "taken"}).Return(taken, nil)
+			testCase.prepare(repo)
+
+			report, err := service.ImportUrls(context.Background(), urls, testCase.opts)
+			require.NoError(t, err)
+
+			require.Len(t, report.Errors, 1)
+			require.Equal(t, 2, report.Errors[0].Index)
+			report.Errors = nil
+			require.Equal(t, testCase.expected, report)
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestImportUrlsKeepsSettings(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	url := models.Url{SmallUrl: "sale", OriginUrl: "http://google.com", RedirectType: models.RedirectFound, QueryPolicy: models.QueryDrop, PasswordHash: "hash", Tags: []string{"promo"}}
+	repo.On("GetBySmallUrl", context.Background(), models.Url{SmallUrl: "sale"}).Return(models.Url{}, models.NotFoundError())
+	repo.On("Insert", context.Background(), url).Return(uint16(5), nil)
+	url.Id = 5
+	repo.On("SetTags", context.Background(), url, []string{"promo"}).Return(nil)
+
+	report, err := service.ImportUrls(context.Background(), []models.Url{{SmallUrl: "sale", OriginUrl: "http://google.com", PasswordHash: "hash", Tags: []string{"Promo"}}}, models.ImportOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Created)
+	repo.AssertExpectations(t)
+}
+
+func TestExportUrlsPasswordHashes(t *testing.T) {
+	protected := models.Url{Id: 1, SmallUrl: "secret", OriginUrl: "http://google.com", PasswordHash: "hash"}
+	export := func(cfg config.Cfg) models.Url {
+		repo := &mocks.Repository{}
+		repo.On("Export", context.Background(), mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(1).(func(models.Url) error)(protected)
+		}).Return(nil)
+
+		exported := models.Url{}
+		err := service.New(repo, cfg).ExportUrls(context.Background(), func(url models.Url) error {
+			exported = url
+			return nil
+		})
+		require.NoError(t, err)
+		return exported
+	}
+
+	require.Empty(t, export(config.New()).PasswordHash)
+
+	cfg := config.New()
+	cfg.ExportPasswordHashes = true
+	require.Equal(t, "hash", export(cfg).PasswordHash)
+}
+
+func withDefaults(url models.Url) models.Url {
+	url.RedirectType = models.RedirectFound
+	url.QueryPolicy = models.QueryDrop
+	return url
+}
+
+func TestCreateUrlRedirectType(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	_, err := service.CreateUrl(context.Background(), models.Url{SmallUrl: "abc", OriginUrl: "http://google.com", RedirectType: "303"})
+	require.Error(t, err)
+
+	url := models.Url{SmallUrl: "abc", OriginUrl: "http://google.com", RedirectType: models.RedirectMetaRefresh, QueryPolicy: models.QueryDrop}
+	repo.On("ValidateUrl", context.Background(), url.OriginUrl).Return(true)
+	repo.On("Insert", context.Background(), url).Return(uint16(3), nil)
+
+	resUrl, err := service.CreateUrl(context.Background(), url)
+	require.NoError(t, err)
+	require.Equal(t, models.RedirectMetaRefresh, resUrl.RedirectType)
+}
+
+func TestCreateUrlQueryPolicy(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	_, err := service.CreateUrl(context.Background(), models.Url{SmallUrl: "abc", OriginUrl: "http://google.com", QueryPolicy: "append"})
+	require.ErrorAs(t, err, &models.BadRequest{})
+
+	url := models.Url{SmallUrl: "abc", OriginUrl: "http://google.com", QueryPolicy: models.QueryMerge, UtmSource: "poster"}
+	repo.On("ValidateUrl", context.Background(), url.OriginUrl).Return(true)
+	repo.On("Insert", context.Background(), models.Url{SmallUrl: "abc", OriginUrl: "http://google.com", RedirectType: models.RedirectFound, QueryPolicy: models.QueryMerge, UtmSource: "poster"}).Return(uint16(3), nil)
+
+	resUrl, err := service.CreateUrl(context.Background(), url)
+	require.NoError(t, err)
+	require.Equal(t, models.QueryMerge, resUrl.QueryPolicy)
+}
+
+func TestCreateUrlWithPassword(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	url := models.Url{SmallUrl: "secret", OriginUrl: "http://google.com", Password: "qwerty"}
+	expected := models.Url{SmallUrl: "secret", OriginUrl: "http://google.com", PasswordHash: "hash", RedirectType: models.RedirectFound, QueryPolicy: models.QueryDrop}
+
+	repo.On("ValidateUrl", context.Background(), url.OriginUrl).Return(true)
+	repo.On("HashPassword", context.Background(), "qwerty").Return("hash", nil)
+	repo.On("Insert", context.Background(), expected).Return(uint16(4), nil)
+
+	resUrl, err := service.CreateUrl(context.Background(), url)
+	require.NoError(t, err)
+	require.Empty(t, resUrl.Password)
+	require.Equal(t, "hash", resUrl.PasswordHash)
+}
+
+func TestUnlockUrl(t *testing.T) {
+	repo := &mocks.Repository{}
+	cfg := config.New()
+	service := service.New(repo, cfg)
+
+	url := models.Url{Id: 4, SmallUrl: "secret", OriginUrl: "http://google.com", PasswordHash: "hash"}
+	repo.On("GetBySmallUrl", context.Background(), models.Url{SmallUrl: "secret"}).Return(url, nil)
+	repo.On("ComparePassword", context.Background(), "hash", "qwerty").Return(true)
+	repo.On("ComparePassword", context.Background(), "hash", "wrong").Return(false)
+
+	_, err := service.UnlockUrl(context.Background(), models.Url{SmallUrl: "secret"}, "qwerty", "127.0.0.1")
+	require.NoError(t, err)
+
+	for i := 0; i < cfg.UnlockMaxAttempts; i++ {
+		_, err = service.UnlockUrl(context.Background(), models.Url{SmallUrl: "secret"}, "wrong", "127.0.0.1")
+		require.ErrorAs(t, err, &models.Unauthorized{})
+	}
+
+	_, err = service.UnlockUrl(context.Background(), models.Url{SmallUrl: "secret"}, "qwerty", "127.0.0.1")
+	require.ErrorAs(t, err, &models.TooManyRequests{})
+
+	_, err = service.UnlockUrl(context.Background(), models.Url{SmallUrl: "secret"}, "qwerty", "127.0.0.2")
+	require.NoError(t, err)
+
+	token, _ := service.UnlockToken(url)
+	require.True(t, service.IsUnlocked(url, token))
+	require.False(t, service.IsUnlocked(url, "1."+token))
+
+	url.PasswordHash = "changed"
+	require.False(t, service.IsUnlocked(url, token))
+}
+
+func TestGetUrlActivationWindow(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	testCases := []struct {
+		name   string
+		url    models.Url
+		status string
+	}{
+		{name: "Without window", url: models.Url{SmallUrl: "abc"}, status: models.StatusActive},
+		{name: "Inside window", url: models.Url{SmallUrl: "abc", ActiveFrom: &past, ActiveUntil: &future}, status: models.StatusActive},
+		{name: "Before launch", url: models.Url{SmallUrl: "abc", ActiveFrom: &future}, status: models.StatusScheduled},
+		{name: "After end", url: models.Url{SmallUrl: "abc", ActiveUntil: &past}, status: models.StatusEnded},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &mocks.Repository{}
+			cfg := config.New()
+			cfg.InactiveFallbackUrl = "http://fallback.com"
+			service := service.New(repo, cfg)
+
+			repo.On("GetBySmallUrl", context.Background(), models.Url{SmallUrl: "abc"}).Return(testCase.url, nil)
+
+			resUrl, err := service.GetUrl(context.Background(), models.Url{SmallUrl: "abc"})
+			require.Equal(t, testCase.url, resUrl)
+			if testCase.status == models.StatusActive {
+				require.NoError(t, err)
+				return
+			}
+
+			inactive := models.Inactive{}
+			require.ErrorAs(t, err, &inactive)
+			require.Equal(t, testCase.status, inactive.Status)
+			require.Equal(t, "http://fallback.com", inactive.FallbackUrl)
+		})
+	}
+}
+
+func TestCreateUrlActivationWindowInUTC(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	berlin := time.FixedZone("+02:00", 2*60*60)
+	from := time.Date(2026, 6, 1, 10, 0, 0, 0, berlin)
+	until := time.Date(2026, 6, 30, 10, 0, 0, 0, berlin)
+
+	stored := models.Url{}
+	repo.On("ValidateUrl", context.Background(), "http://google.com").Return(true)
+	repo.On("Insert", context.Background(), mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(models.Url)
+	}).Return(uint16(3), nil)
+
+	_, err := service.CreateUrl(context.Background(), models.Url{SmallUrl: "sale", OriginUrl: "http://google.com", ActiveFrom: &from, ActiveUntil: &until})
+	require.NoError(t, err)
+
+	require.Equal(t, "2026-06-01T08:00:00Z", stored.ActiveFrom.Format(time.RFC3339))
+	require.Equal(t, "2026-06-30T08:00:00Z", stored.ActiveUntil.Format(time.RFC3339))
+}
+
+func TestGetAllUrlUnknownStatus(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	_, err := service.GetAllUrl(context.Background(), models.UrlFilter{Status: "paused"})
+	require.ErrorAs(t, err, &models.BadRequest{})
+}
+
+func TestDestinationGeoRules(t *testing.T) {
+	url := models.Url{Id: 5, SmallUrl: "geo", OriginUrl: "http://google.com"}
+	rules := []models.GeoRule{
+		{UrlId: 5, Country: "DE", TargetUrl: "http://google.de"},
+		{UrlId: 5, Country: "RU", TargetUrl: "http://yandex.ru"},
+	}
+
+	testCases := []struct {
+		name     string
+		ip       string
+		country  string
+		expected string
+	}{
+		{name: "Matching country", ip: "1.1.1.1", country: "RU", expected: "http://yandex.ru"},
+		{name: "Other country", ip: "2.2.2.2", country: "FR", expected: "http://google.com"},
+		{name: "Unknown country", ip: "127.0.0.1", country: "", expected: "http://google.com"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &mocks.Repository{}
+			service := service.New(repo, config.New())
+
+			repo.On("GetDeviceRules", context.Background(), url).Return([]models.DeviceRule{}, nil)
+			repo.On("GetGeoRules", context.Background(), url).Return(rules, nil)
+			repo.On("LookupCountry", context.Background(), testCase.ip).Return(testCase.country)
+			repo.On("GetVariants", context.Background(), url).Return([]models.Variant{}, nil)
+
+			destination, err := service.Destination(context.Background(), url, models.Visitor{IP: testCase.ip})
+			require.NoError(t, err)
+			require.Equal(t, models.Destination{Url: testCase.expected}, destination)
+		})
+	}
+}
+
+func TestSetGeoRules(t *testing.T) {
+	url := models.Url{Id: 5, SmallUrl: "geo", OriginUrl: "http://google.com"}
+
+	testCases := []struct {
+		name    string
+		rules   []models.GeoRule
+		wantErr bool
+	}{
+		{name: "Valid rules", rules: []models.GeoRule{{Country: "de ", TargetUrl: "http://google.de"}}},
+		{name: "Remove rules", rules: []models.GeoRule{}},
+		{name: "Long country code", rules: []models.GeoRule{{Country: "DEU", TargetUrl: "http://google.de"}}, wantErr: true},
+		{name: "Duplicate country", rules: []models.GeoRule{{Country: "DE", TargetUrl: "http://google.de"}, {Country: "de", TargetUrl: "http://google.de"}}, wantErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &mocks.Repository{}
+			service := service.New(repo, config.New())
+
+			expected := []models.GeoRule{}
+			for _, rule := range testCase.rules {
+				expected = append(expected, models.GeoRule{UrlId: 5, Country: "DE", TargetUrl: rule.TargetUrl})
+			}
+
+			repo.On("GetById", context.Background(), models.Url{Id: 5}).Return(url, nil)
+			repo.On("ValidateUrl", context.Background(), "http://google.de").Return(true)
+			repo.On("SetGeoRules", context.Background(), url, expected).Return(nil)
+			repo.On("GetGeoRules", context.Background(), url).Return(expected, nil)
+
+			rules, err := service.SetGeoRules(context.Background(), models.GeoRules{Id: 5, Rules: testCase.rules})
+			if testCase.wantErr {
+				require.ErrorAs(t, err, &models.BadRequest{})
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, expected, rules)
+		})
+	}
+}
+
+func TestDestinationDeviceRules(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	url := models.Url{Id: 6, SmallUrl: "app", OriginUrl: "http://google.com"}
+	repo.On("GetDeviceRules", context.Background(), url).Return([]models.DeviceRule{
+		{UrlId: 6, OS: "ios", TargetUrl: "https://apps.apple.com/app/id1"},
+	}, nil)
+	repo.On("GetGeoRules", context.Background(), url).Return([]models.GeoRule{}, nil)
+	repo.On("GetVariants", context.Background(), url).Return([]models.Variant{}, nil)
+
+	destination, err := service.Destination(context.Background(), url, models.Visitor{
+		UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 14_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.1.1 Mobile/15E148 Safari/604.1",
+	})
+	require.NoError(t, err)
+	require.Equal(t, models.Destination{Url: "https://apps.apple.com/app/id1"}, destination)
+
+	destination, err = service.Destination(context.Background(), url, models.Visitor{
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:89.0) Gecko/20100101 Firefox/89.0",
+	})
+	require.NoError(t, err)
+	require.Equal(t, models.Destination{Url: "http://google.com"}, destination)
+}
+
+func TestCreateUrlWithDeviceRules(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	url := models.Url{SmallUrl: "app", OriginUrl: "http://google.com", DeviceRules: []models.DeviceRule{
+		{OS: " iOS", TargetUrl: "https://apps.apple.com/app/id1"},
+		{OS: "android", Device: "mobile", TargetUrl: "https://play.google.com/store/apps/details?id=app"},
+	}}
+	expected := models.Url{Id: 6, SmallUrl: "app", OriginUrl: "http://google.com", RedirectType: models.RedirectFound, QueryPolicy: models.QueryDrop, DeviceRules: []models.DeviceRule{
+		{Position: 0, OS: "ios", TargetUrl: "https://apps.apple.com/app/id1"},
+		{Position: 1, OS: "android", Device: "mobile", TargetUrl: "https://play.google.com/store/apps/details?id=app"},
+	}}
+
+	repo.On("ValidateUrl", context.Background(), mock.Anything).Return(true)
+	repo.On("Insert", context.Background(), mock.Anything).Return(uint16(6), nil)
+	repo.On("SetDeviceRules", context.Background(), expected, expected.DeviceRules).Return(nil)
+
+	resUrl, err := service.CreateUrl(context.Background(), url)
+	require.NoError(t, err)
+	require.Equal(t, expected, resUrl)
+
+	url.DeviceRules = []models.DeviceRule{{Browser: "netscape", TargetUrl: "http://google.com"}}
+	_, err = service.CreateUrl(context.Background(), url)
+	require.ErrorAs(t, err, &models.BadRequest{})
+}
+
+func TestDestinationVariants(t *testing.T) {
+	url := models.Url{Id: 7, SmallUrl: "ab", OriginUrl: "http://google.com"}
+	a := models.Variant{Id: 1, UrlId: 7, TargetUrl: "http://example.com/a", Weight: 1}
+	b := models.Variant{Id: 2, UrlId: 7, TargetUrl: "http://example.com/b", Weight: 0}
+
+	testCases := []struct {
+		name     string
+		variants []models.Variant
+		visitor  models.Visitor
+		expected models.Destination
+	}{
+		{name: "No variants", variants: []models.Variant{}, expected: models.Destination{Url: "http://google.com"}},
+		{name: "Weighted pick", variants: []models.Variant{a, b}, expected: models.Destination{Url: a.TargetUrl, VariantId: 1}},
+		{name: "Sticky variant", variants: []models.Variant{a, {Id: 2, TargetUrl: b.TargetUrl, Weight: 1}}, visitor: models.Visitor{VariantId: 2}, expected: models.Destination{Url: b.TargetUrl, VariantId: 2}},
+		{name: "Sticky variant switched off", variants: []models.Variant{a, b}, visitor: models.Visitor{VariantId: 2}, expected: models.Destination{Url: a.TargetUrl, VariantId: 1}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &mocks.Repository{}
+			service := service.New(repo, config.New())
+
+			repo.On("GetDeviceRules", context.Background(), url).Return([]models.DeviceRule{}, nil)
+			repo.On("GetGeoRules", context.Background(), url).Return([]models.GeoRule{}, nil)
+			repo.On("GetVariants", context.Background(), url).Return(testCase.variants, nil)
+
+			destination, err := service.Destination(context.Background(), url, testCase.visitor)
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, destination)
+		})
+	}
+}
+
+func TestRecordClick(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	url := models.Url{Id: 7, SmallUrl: "ab", OriginUrl: "http://google.com"}
+	repo.On("IncrementVariantClicks", context.Background(), models.Variant{Id: 2, UrlId: 7}).Return(nil)
+	repo.On("QueueClick", context.Background(), url, "http://example.com/b").Return(nil)
+	repo.On("QueueClick", context.Background(), url, "http://google.com").Return(nil)
+
+	require.NoError(t, service.RecordClick(context.Background(), url, models.Destination{Url: "http://example.com/b", VariantId: 2}))
+	require.NoError(t, service.RecordClick(context.Background(), url, models.Destination{Url: "http://google.com"}))
+	repo.AssertNumberOfCalls(t, "IncrementVariantClicks", 1)
+	repo.AssertNumberOfCalls(t, "QueueClick", 2)
+}
+
+func TestSetVariants(t *testing.T) {
+	url := models.Url{Id: 7, SmallUrl: "ab", OriginUrl: "http://google.com"}
+
+	testCases := []struct {
+		name     string
+		variants []models.Variant
+		wantErr  bool
+	}{
+		{name: "Change weights", variants: []models.Variant{{Id: 1, TargetUrl: "http://example.com/a ", Weight: 80}, {Id: 2, TargetUrl: "http://example.com/b", Weight: 20}}},
+		{name: "Remove variants", variants: []models.Variant{}},
+		{name: "Negative weight", variants: []models.Variant{{TargetUrl: "http://example.com/a", Weight: -1}}, wantErr: true},
+		{name: "No traffic", variants: []models.Variant{{TargetUrl: "http://example.com/a", Weight: 0}}, wantErr: true},
+		{name: "Invalid target", variants: []models.Variant{{TargetUrl: "not a url", Weight: 1}}, wantErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &mocks.Repository{}
+			service := service.New(repo, config.New())
+
+			expected := []models.Variant{}
+			for _, variant := range testCase.variants {
+				variant.TargetUrl = strings.TrimSpace(variant.TargetUrl)
+				expected = append(expected, variant)
+			}
+
+			repo.On("GetById", context.Background(), models.Url{Id: 7}).Return(url, nil)
+			repo.On("ValidateUrl", context.Background(), "not a url").Return(false)
+			repo.On("ValidateUrl", context.Background(), mock.Anything).Return(true)
+			repo.On("SetVariants", context.Background(), url, expected).Return(nil)
+			repo.On("GetVariants", context.Background(), url).Return(expected, nil)
+
+			variants, err := service.SetVariants(context.Background(), models.Variants{Id: 7, Variants: testCase.variants})
+			if testCase.wantErr {
+				require.ErrorAs(t, err, &models.BadRequest{})
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, expected, variants)
+		})
+	}
+}
+
+func TestDestinationQuery(t *testing.T) {
+	url := models.Url{Id: 8, SmallUrl: "news", OriginUrl: "http://google.com/?ref=site", QueryPolicy: models.QueryOverride, UtmSource: "newsletter", UtmMedium: "email"}
+	geo := "http://google.de/"
+
+	testCases := []struct {
+		name     string
+		visitor  models.Visitor
+		expected string
+	}{
+		{name: "No query", visitor: models.Visitor{}, expected: "http://google.com/?ref=site&utm_medium=email&utm_source=newsletter"},
+		{name: "Query forwarded", visitor: models.Visitor{Query: neturl.Values{"ref": {"mail"}, "utm_medium": {"push"}}}, expected: "http://google.com/?ref=mail&utm_medium=push&utm_source=newsletter"},
+		{name: "Applied to targeted url", visitor: models.Visitor{IP: "1.1.1.1", Query: neturl.Values{"id": {"1"}}}, expected: "http://google.de/?id=1&utm_medium=email&utm_source=newsletter"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &mocks.Repository{}
+			service := service.New(repo, config.New())
+
+			repo.On("GetDeviceRules", context.Background(), url).Return([]models.DeviceRule{}, nil)
+			repo.On("GetGeoRules", context.Background(), url).Return([]models.GeoRule{{UrlId: 8, Country: "DE", TargetUrl: geo}}, nil)
+			repo.On("LookupCountry", context.Background(), "1.1.1.1").Return("DE")
+			repo.On("LookupCountry", context.Background(), "").Return("")
+			repo.On("GetVariants", context.Background(), url).Return([]models.Variant{}, nil)
+
+			destination, err := service.Destination(context.Background(), url, testCase.visitor)
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, destination.Url)
+		})
+	}
+}
+
+func TestCreateUrlWithMetadata(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	url := models.Url{SmallUrl: "sale", OriginUrl: "http://google.com", Title: " Spring sale ", Notes: "printed on posters\n", Tags: []string{"Print", " spring", "print", ""}}
+	expected := withDefaults(models.Url{Id: 9, SmallUrl: "sale", OriginUrl: "http://google.com", Title: "Spring sale", Notes: "printed on posters", Tags: []string{"print", "spring"}})
+
+	repo.On("ValidateUrl", context.Background(), "http://google.com").Return(true)
+	repo.On("Insert", context.Background(), mock.Anything).Return(uint16(9), nil)
+	repo.On("SetTags", context.Background(), expected, expected.Tags).Return(nil)
+
+	resUrl, err := service.CreateUrl(context.Background(), url)
+	require.NoError(t, err)
+	require.Equal(t, expected, resUrl)
+
+	url.Tags = []string{"a,b"}
+	_, err = service.CreateUrl(context.Background(), url)
+	require.ErrorAs(t, err, &models.BadRequest{})
+}
+
+func TestUpdateUrlKeepsTags(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	url := models.Url{Id: 9, SmallUrl: "sale", OriginUrl: "http://google.com", Title: "Sale"}
+	repo.On("ValidateUrl", context.Background(), "http://google.com").Return(true)
+	repo.On("Update", context.Background(), url).Return(nil)
+
+	_, err := service.UpdateUrl(context.Background(), url)
+	require.NoError(t, err)
+	repo.AssertNotCalled(t, "SetTags", mock.Anything, mock.Anything, mock.Anything)
+
+	url.Tags = []string{}
+	repo.On("Update", context.Background(), url).Return(nil)
+	repo.On("SetTags", context.Background(), url, []string{}).Return(nil)
+
+	_, err = service.UpdateUrl(context.Background(), url)
+	require.NoError(t, err)
+	repo.AssertCalled(t, "SetTags", context.Background(), url, []string{})
+}
+
+func TestGetAllUrlByTag(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	urls := []models.Url{{Id: 9, SmallUrl: "sale", OriginUrl: "http://google.com", Tags: []string{"spring"}}}
+	repo.On("Get", context.Background(), models.UrlFilter{Tag: "spring"}).Return(urls, nil)
+
+	resUrls, err := service.GetAllUrl(context.Background(), models.UrlFilter{Tag: " Spring"})
+	require.NoError(t, err)
+	require.Equal(t, urls, resUrls)
+}
+
+func TestEnrich(t *testing.T) {
+	repo := &mocks.Repository{}
+	cfg := config.New()
+	cfg.EnrichBatch = 10
+	service := service.New(repo, cfg)
+
+	urls := []models.Url{
+		{Id: 1, SmallUrl: "ok", OriginUrl: "http://google.com"},
+		{Id: 2, SmallUrl: "broken", OriginUrl: "http://broken.example"},
+	}
+	meta := models.PageMeta{Title: "Google", FaviconUrl: "http://google.com/favicon.ico"}
+
+	repo.On("GetUnenriched", context.Background(), 10).Return(urls, nil)
+	repo.On("FetchPageMeta", context.Background(), "http://google.com").Return(meta, nil)
+	repo.On("FetchPageMeta", context.Background(), "http://broken.example").Return(models.PageMeta{}, errors.New("timeout"))
+	repo.On("SetPageMeta", context.Background(), urls[0], meta).Return(nil)
+	repo.On("SetPageMeta", context.Background(), urls[1], models.PageMeta{}).Return(nil)
+
+	n, err := service.Enrich(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	repo.AssertExpectations(t)
+}
+
+func TestSearch(t *testing.T) {
+	testCases := []struct {
+		name     string
+		search   models.Search
+		expected models.Search
+		wantErr  bool
+	}{
+		{name: "Default limit", search: models.Search{Query: " spring "}, expected: models.Search{Query: "spring", Limit: 50}},
+		{name: "Custom limit", search: models.Search{Query: "spring", Limit: 10}, expected: models.Search{Query: "spring", Limit: 10}},
+		{name: "Empty query", search: models.Search{Query: "  "}, wantErr: true},
+		{name: "Limit too big", search: models.Search{Query: "spring", Limit: 1000}, wantErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &mocks.Repository{}
+			service := service.New(repo, config.New())
+
+			results := []models.SearchResult{{Url: models.Url{Id: 1, SmallUrl: "spring"}, Rank: 0.5}}
+			repo.On("Search", context.Background(), testCase.expected).Return(results, nil)
+
+			resResults, err := service.Search(context.Background(), testCase.search)
+			if testCase.wantErr {
+				require.ErrorAs(t, err, &models.BadRequest{})
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, results, resResults)
+		})
+	}
+}
+
+func TestRollbackUrl(t *testing.T) {
+	current := models.Url{Id: 1, SmallUrl: "new", OriginUrl: "http://yandex.ru", RedirectType: models.RedirectFound, PasswordHash: "hash"}
+	restored := models.Url{Id: 1, SmallUrl: "old", OriginUrl: "http://google.com", RedirectType: models.RedirectPermanent, PasswordHash: "hash"}
+	version := models.LinkVersion{Id: 5, UrlId: 1, Action: models.ActionUpdate, New: &models.Snapshot{SmallUrl: "old", OriginUrl: "http://google.com", RedirectType: models.RedirectPermanent}}
+
+	testCases := []struct {
+		name    string
+		version models.LinkVersion
+		taken   models.Url
+		takenBy error
+		wantErr interface{}
+	}{
+		{name: "Restored", version: version, takenBy: models.NotFoundError()},
+		{name: "Code reused by the same link", version: version, taken: models.Url{Id: 1}},
+		{name: "Code taken by another link", version: version, taken: models.Url{Id: 2}, wantErr: &models.BadRequest{}},
+		{name: "Version of another link", version: models.LinkVersion{Id: 5, UrlId: 2, New: version.New}, wantErr: &models.NotFound{}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &mocks.Repository{}
+			service := service.New(repo, config.New())
+
+			repo.On("GetById", context.Background(), models.Url{Id: 1}).Return(current, nil)
+			repo.On("GetVersion", context.Background(), models.LinkVersion{Id: 5}).Return(testCase.version, nil)
+			repo.On("GetBySmallUrl", context.Background(), restored).Return(testCase.taken, testCase.takenBy)
+			repo.On("Rollback", context.Background(), restored).Return(restored, nil)
+
+			url, err := service.RollbackUrl(context.Background(), models.Rollback{Id: 1, VersionId: 5})
+			if testCase.wantErr != nil {
+				require.ErrorAs(t, err, testCase.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, restored, url)
+		})
+	}
+}
+
+func TestGetDeletedUrl(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	deletedAt := time.Now().Add(-time.Hour)
+	url := models.Url{Id: 1, SmallUrl: "gone", OriginUrl: "http://google.com", DeletedAt: &deletedAt}
+	repo.On("GetBySmallUrl", context.Background(), models.Url{SmallUrl: "gone"}).Return(url, nil)
+
+	_, err := service.GetUrl(context.Background(), models.Url{SmallUrl: "gone"})
+	require.ErrorAs(t, err, &models.Gone{})
+}
+
+func TestPurge(t *testing.T) {
+	repo := &mocks.Repository{}
+	cfg := config.New()
+	cfg.TrashRetention = 24 * time.Hour
+	service := service.New(repo, cfg)
+
+	repo.On("Purge", context.Background(), mock.MatchedBy(func(before time.Time) bool {
+		return time.Since(before) > 24*time.Hour && time.Since(before) < 25*time.Hour
+	})).Return(int64(2), nil)
+
+	n, err := service.Purge(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+}
+
+func TestPruneEvents(t *testing.T) {
+	repo := &mocks.Repository{}
+	cfg := config.New()
+	cfg.EventsRetention = 24 * time.Hour
+	service := service.New(repo, cfg)
+
+	repo.On("PruneEvents", context.Background(), mock.MatchedBy(func(before time.Time) bool {
+		return time.Since(before) > 24*time.Hour && time.Since(before) < 25*time.Hour
+	})).Return(int64(3), nil)
+
+	n, err := service.PruneEvents(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(3), n)
+}
+
+func TestGetTrash(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	urls := []models.Url{{Id: 1, SmallUrl: "gone"}}
+	repo.On("Get", context.Background(), models.UrlFilter{Deleted: true}).Return(urls, nil)
+
+	resUrls, err := service.GetTrash(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, urls, resUrls)
+}
+
+func TestAddAlias(t *testing.T) {
+	url := models.Url{Id: 1, SmallUrl: "xyz", OriginUrl: "http://google.com"}
+
+	testCases := []struct {
+		name    string
+		code    string
+		want    string
+		takenBy error
+		wantErr interface{}
+	}{
+		{name: "Vanity code", code: " spring ", want: "spring", takenBy: models.NotFoundError()},
+		{name: "Generated code", code: "", want: "generated", takenBy: models.NotFoundError()},
+		{name: "Code taken", code: "spring", want: "spring", wantErr: &models.BadRequest{}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &mocks.Repository{}
+			service := service.New(repo, config.New())
+
+			alias := models.Alias{UrlId: 1, Code: testCase.want}
+			repo.On("GetById", context.Background(), models.Url{Id: 1}).Return(url, nil)
+			repo.On("GenerateUrl", context.Background()).Return("generated")
+			repo.On("GetBySmallUrl", context.Background(), models.Url{SmallUrl: testCase.want}).Return(models.Url{Id: 2}, testCase.takenBy)
+			repo.On("AddAlias", context.Background(), alias).Return(models.Alias{Id: 3, UrlId: 1, Code: testCase.want}, nil)
+
+			added, err := service.AddAlias(context.Background(), models.Alias{UrlId: 1, Code: testCase.code})
+			if testCase.wantErr != nil {
+				require.ErrorAs(t, err, testCase.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, models.Alias{Id: 3, UrlId: 1, Code: testCase.want}, added)
+		})
+	}
+}
+
+func TestRemovePrimaryAlias(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	repo.On("GetById", context.Background(), models.Url{Id: 1}).Return(models.Url{Id: 1, SmallUrl: "xyz"}, nil)
+
+	err := service.RemoveAlias(context.Background(), models.Alias{UrlId: 1, Code: "xyz"})
+	require.ErrorAs(t, err, &models.BadRequest{})
+	repo.AssertNotCalled(t, "RemoveAlias", mock.Anything, mock.Anything)
+}
+
+func TestCreateUrlDedupe(t *testing.T) {
+	existing := models.Url{Id: 7, SmallUrl: "old", OriginUrl: "http://google.com/a", Owner: "alice", RedirectType: models.RedirectFound, QueryPolicy: models.QueryDrop}
+	protected := existing
+	protected.PasswordHash = "hash"
+
+	testCases := []struct {
+		name     string
+		owners   []string
+		url      models.Url
+		existing *models.Url
+		found    error
+		wantNew  bool
+		wantSame bool
+	}{
+		{name: "Owner deduplicates", owners: []string{"alice"}, url: models.Url{OriginUrl: "HTTP://Google.COM/a"}, wantSame: true},
+		{name: "Everyone deduplicates", owners: []string{"*"}, url: models.Url{OriginUrl: "http://google.com/a"}, wantSame: true},
+		{name: "Nothing to reuse", owners: []string{"alice"}, url: models.Url{OriginUrl: "http://google.com/a"}, found: models.NotFoundError(), wantNew: true},
+		{name: "Forced new link", owners: []string{"alice"}, url: models.Url{OriginUrl: "http://google.com/a", ForceNew: true}, wantNew: true},
+		{name: "Custom small url", owners: []string{"alice"}, url: models.Url{SmallUrl: "mine", OriginUrl: "http://google.com/a"}, wantNew: true},
+		{name: "Other owner", owners: []string{"bob"}, url: models.Url{OriginUrl: "http://google.com/a"}, wantNew: true},
+		{name: "Request with a password", owners: []string{"*"}, url: models.Url{OriginUrl: "http://google.com/a", Password: "qwerty"}, wantNew: true},
+		{name: "Request with tags", owners: []string{"*"}, url: models.Url{OriginUrl: "http://google.com/a", Tags: []string{"promo"}}, wantNew: true},
+		{name: "Request with a redirect type", owners: []string{"*"}, url: models.Url{OriginUrl: "http://google.com/a", RedirectType: models.RedirectPermanent}, wantNew: true},
+		{name: "Duplicate with a password", owners: []string{"*"}, url: models.Url{OriginUrl: "http://google.com/a"}, existing: &protected, wantNew: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &mocks.Repository{}
+			cfg := config.New()
+			cfg.DedupeOwners = testCase.owners
+			service := service.New(repo, cfg)
+			ctx := actor.With(context.Background(), "alice")
+
+			found := existing
+			if testCase.existing != nil {
+				found = *testCase.existing
+			}
+			repo.On("ValidateUrl", ctx, "http://google.com/a").Return(true)
+			repo.On("FindByOrigin", ctx, mock.MatchedBy(func(url models.Url) bool {
+				return url.OriginUrl == "http://google.com/a"
+			})).Return(found, testCase.found)
+			repo.On("GenerateUrl", ctx).Return("new")
+			repo.On("HashPassword", ctx, "qwerty").Return("hash", nil)
+			repo.On("SetTags", ctx, mock.Anything, []string{"promo"}).Return(nil)
+			repo.On("Insert", ctx, mock.Anything).Return(uint16(8), nil)
+
+			url, err := service.CreateUrl(ctx, testCase.url)
+			require.NoError(t, err)
+			if testCase.wantSame {
+				require.Equal(t, existing, url)
+				repo.AssertNotCalled(t, "Insert", mock.Anything, mock.Anything)
+			}
+			if testCase.wantNew {
+				require.Equal(t, uint16(8), url.Id)
+			}
+			if testCase.url.Password != "" {
+				require.Equal(t, "hash", url.PasswordHash)
+			}
+		})
+	}
+}
+
+func TestCreateUrlCanonical(t *testing.T) {
+	repo := &mocks.Repository{}
+	cfg := config.New()
+	cfg.StripTrackingParams = true
+	service := service.New(repo, cfg)
+
+	canonical := "https://xn--e1afmkfd.xn--p1ai/b?a=1&z=2"
+	repo.On("ValidateUrl", context.Background(), canonical).Return(true)
+	repo.On("Insert", context.Background(), mock.MatchedBy(func(url models.Url) bool {
+		return url.OriginUrl == canonical
+	})).Return(uint16(1), nil)
+
+	url, err := service.CreateUrl(context.Background(), models.Url{SmallUrl: "xyz", OriginUrl: " HTTPS://Пример.рф:443/a/../b?z=2&utm_source=mail&a=1 "})
+	require.NoError(t, err)
+	require.Equal(t, canonical, url.OriginUrl)
+}
+
+func TestAddDomain(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	repo.On("GetDomain", context.Background(), models.Domain{Host: "go.example.com", FallbackUrl: "https://example.com"}).Return(models.Domain{}, models.NotFoundError())
+	repo.On("GetDomain", context.Background(), models.Domain{Host: "xn--e1afmkfd.xn--p1ai"}).Return(models.Domain{Id: 1}, nil)
+	repo.On("AddDomain", context.Background(), mock.MatchedBy(func(domain models.Domain) bool {
+		return domain.Host == "go.example.com" && len(domain.VerifyToken) == 32
+	})).Return(models.Domain{Id: 2, Host: "go.example.com", FallbackUrl: "https://example.com", VerifyToken: "token"}, nil)
+
+	domain, err := service.AddDomain(context.Background(), models.Domain{Host: " Go.Example.COM. ", FallbackUrl: "HTTPS://Example.com"})
+	require.NoError(t, err)
+	require.Equal(t, "_bitlytest.go.example.com", domain.TxtName)
+	require.Equal(t, "bitlytest-verify=token", domain.TxtValue)
+
+	_, err = service.AddDomain(context.Background(), models.Domain{Host: "Пример.рф"})
+	require.ErrorAs(t, err, &models.BadRequest{})
+
+	for _, host := range []string{"", "example.com:8080", "example.com/path", "user@example.com"} {
+		_, err = service.AddDomain(context.Background(), models.Domain{Host: host})
+		require.ErrorAs(t, err, &models.BadRequest{}, host)
+	}
+
+	_, err = service.AddDomain(context.Background(), models.Domain{Host: "ok.example.com", FallbackUrl: "/relative"})
+	require.ErrorAs(t, err, &models.BadRequest{})
+}
+
+func TestVerifyDomain(t *testing.T) {
+	verifiedAt := time.Now()
+	domain := models.Domain{Id: 1, Host: "go.example.com", VerifyToken: "token"}
+
+	testCases := []struct {
+		name      string
+		records   []string
+		lookupErr error
+		wantErr   interface{}
+	}{
+		{name: "Record found", records: []string{"v=spf1 -all", " bitlytest-verify=token "}},
+		{name: "Wrong token", records: []string{"bitlytest-verify=other"}, wantErr: &models.BadRequest{}},
+		{name: "No record", lookupErr: &net.DNSError{Err: "no such host", IsNotFound: true}, wantErr: &models.BadRequest{}},
+		{name: "Resolver failure", lookupErr: &net.DNSError{Err: "timeout", IsTimeout: true}, wantErr: new(*net.DNSError)},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &mocks.Repository{}
+			service := service.New(repo, config.New())
+
+			repo.On("GetDomain", context.Background(), models.Domain{Host: "go.example.com"}).Return(domain, nil)
+			repo.On("LookupTXT", context.Background(), "_bitlytest.go.example.com").Return(testCase.records, testCase.lookupErr)
+			repo.On("VerifyDomain", context.Background(), mock.Anything).Return(models.Domain{Id: 1, Host: "go.example.com", VerifyToken: "token", VerifiedAt: &verifiedAt}, nil)
+
+			verified, err := service.VerifyDomain(context.Background(), models.Domain{Host: "GO.example.com"})
+			if testCase.wantErr != nil {
+				require.ErrorAs(t, err, testCase.wantErr)
+				repo.AssertNotCalled(t, "VerifyDomain", mock.Anything, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, verified.Verified())
+		})
+	}
+}
+
+func TestGetUrlOnDomain(t *testing.T) {
+	verifiedAt := time.Now()
+	domain := models.Domain{Id: 1, Host: "go.example.com", FallbackUrl: "https://example.com/404", VerifiedAt: &verifiedAt}
+
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	repo.On("GetDomain", context.Background(), models.Domain{Host: "go.example.com"}).Return(domain, nil)
+	repo.On("GetDomain", context.Background(), models.Domain{Host: "pending.example.com"}).Return(models.Domain{Host: "pending.example.com"}, nil)
+	repo.On("GetDomain", context.Background(), models.Domain{Host: "localhost"}).Return(models.Domain{}, models.NotFoundError())
+	repo.On("GetBySmallUrl", context.Background(), models.Url{Domain: "go.example.com", SmallUrl: "sale"}).Return(models.Url{Id: 1, Domain: "go.example.com", SmallUrl: "sale"}, nil)
+	repo.On("GetBySmallUrl", context.Background(), models.Url{Domain: "go.example.com", SmallUrl: "nope"}).Return(models.Url{}, models.NotFoundError())
+	repo.On("GetBySmallUrl", context.Background(), models.Url{SmallUrl: "sale"}).Return(models.Url{Id: 2, SmallUrl: "sale"}, nil)
+
+	url, err := service.GetUrl(context.Background(), models.Url{Domain: "go.example.com", SmallUrl: "sale"})
+	require.NoError(t, err)
+	require.Equal(t, uint16(1), url.Id)
+
+	_, err = service.GetUrl(context.Background(), models.Url{Domain: "go.example.com", SmallUrl: "nope"})
+	notFound := models.NotFound{}
+	require.ErrorAs(t, err, &notFound)
+	require.Equal(t, "https://example.com/404", notFound.FallbackUrl)
+
+	for _, host := range []string{"localhost", "pending.example.com"} {
+		url, err = service.GetUrl(context.Background(), models.Url{Domain: host, SmallUrl: "sale"})
+		require.NoError(t, err)
+		require.Equal(t, uint16(2), url.Id, host)
+	}
+}
+
+func TestCreateUrlOnUnverifiedDomain(t *testing.T) {
+	repo := &mocks.Repository{}
+	service := service.New(repo, config.New())
+
+	repo.On("ValidateUrl", context.Background(), "http://google.com").Return(true)
+	repo.On("GetDomain", context.Background(), models.Domain{Host: "pending.example.com"}).Return(models.Domain{Host: "pending.example.com"}, nil)
+	repo.On("GetDomain", context.Background(), models.Domain{Host: "unknown.example.com"}).Return(models.Domain{}, models.NotFoundError())
+
+	for _, host := range []string{"Pending.example.com", "unknown.example.com"} {
+		_, err := service.CreateUrl(context.Background(), models.Url{Domain: host, SmallUrl: "xyz", OriginUrl: "http://google.com"})
+		require.ErrorAs(t, err, &models.BadRequest{}, host)
+	}
+	repo.AssertNotCalled(t, "Insert", mock.Anything, mock.Anything)
+}
+
+func TestCreateUrlSmallUrlRules(t *testing.T) {
+	repo := &mocks.Repository{}
+	cfg := config.New()
+	cfg.ReservedWords = []string{"Promo"}
+	service := service.New(repo, cfg)
+	service.Reserve("create", "all")
+
+	repo.On("ValidateUrl", context.Background(), "http://google.com").Return(true)
+	repo.On("Insert", context.Background(), mock.Anything).Return(uint16(1), nil)
+
+	testCases := []struct {
+		smallUrl string
+		wantErr  bool
+	}{
+		{smallUrl: "spring-sale_2026"},
+		{smallUrl: "ab", wantErr: true},
+		{smallUrl: strings.Repeat("a", 65), wantErr: true},
+		{smallUrl: "a/b/c", wantErr: true},
+		{smallUrl: "sale!", wantErr: true},
+		{smallUrl: "распродажа", wantErr: true},
+		{smallUrl: "create", wantErr: true},
+		{smallUrl: "ALL", wantErr: true},
+		{smallUrl: "promo", wantErr: true},
+		{smallUrl: "admin", wantErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.smallUrl, func(t *testing.T) {
+			_, err := service.CreateUrl(context.Background(), models.Url{SmallUrl: testCase.smallUrl, OriginUrl: "http://google.com"})
+			if testCase.wantErr {
+				require.ErrorAs(t, err, &models.BadRequest{})
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestBulkCreateUrlCaseInsensitive(t *testing.T) {
+	repo := &mocks.Repository{}
+	cfg := config.New()
+	cfg.CaseInsensitiveCodes = true
+	service := service.New(repo, cfg)
+
+	repo.On("ValidateUrl", context.Background(), "http://google.com").Return(true)
+	repo.On("InsertBatch", context.Background(), []models.Url{
+		{SmallUrl: "Sale", OriginUrl: "http://google.com", RedirectType: models.RedirectFound, QueryPolicy: models.QueryDrop},
+	}).Return([]models.Url{{Id: 1, SmallUrl: "Sale", OriginUrl: "http://google.com"}}, nil)
+
+	results, err := service.BulkCreateUrl(context.Background(), []models.Url{
+		{SmallUrl: "Sale", OriginUrl: "http://google.com"},
+		{SmallUrl: "sALE", OriginUrl: "http://google.com"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &models.Url{Id: 1, SmallUrl: "Sale", OriginUrl: "http://google.com"}, results[0].Url)
+	require.Equal(t, "bad request: duplicate small url in batch", results[1].Error)
+}
+
+func TestAddWebhook(t *testing.T) {
+	testCases := []struct {
+		name    string
+		webhook models.Webhook
+		events  []string
+		wantErr bool
+	}{
+		{name: "Valid", webhook: models.Webhook{Url: " https://crm.example.com/hooks ", Events: []string{"link.created", "link.clicked", "link.created"}}, events: []string{"link.created", "link.clicked"}},
+		{name: "Relative url", webhook: models.Webhook{Url: "/hooks", Events: []string{"link.created"}}, wantErr: true},
+		{name: "Other scheme", webhook: models.Webhook{Url: "ftp://crm.example.com", Events: []string{"link.created"}}, wantErr: true},
+		{name: "No events", webhook: models.Webhook{Url: "https://crm.example.com/hooks"}, wantErr: true},
+		{name: "Unknown event", webhook: models.Webhook{Url: "https://crm.example.com/hooks", Events: []string{"link.renamed"}}, wantErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &mocks.Repository{}
+			service := service.New(repo, config.New())
+
+			repo.On("AddWebhook", context.Background(), mock.Anything).Return(func(_ context.Context, webhook models.Webhook) models.Webhook {
+				webhook.Id = 1
+				return webhook
+			}, nil)
+
+			added, err := service.AddWebhook(context.Background(), testCase.webhook)
+			if testCase.wantErr {
+				require.ErrorAs(t, err, &models.BadRequest{})
+				repo.AssertNotCalled(t, "AddWebhook", mock.Anything, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "https://crm.example.com/hooks", added.Url)
+			require.Equal(t, testCase.events, []string(added.Events))
+			require.True(t, added.Active)
+			require.Len(t, added.Secret, 64)
+		})
+	}
+}
+
+func TestPruneDeliveries(t *testing.T) {
+	repo := &mocks.Repository{}
+	cfg := config.New()
+	cfg.WebhookRetention = 24 * time.Hour
+	service := service.New(repo, cfg)
+
+	repo.On("PruneDeliveries", context.Background(), mock.MatchedBy(func(before time.Time) bool {
+		return time.Since(before) > 24*time.Hour && time.Since(before) < 25*time.Hour
+	})).Return(int64(5), nil)
+
+	n, err := service.PruneDeliveries(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(5), n)
+}
+
+func TestDeliverWebhooks(t *testing.T) {
+	testCases := []struct {
+		name       string
+		attempts   int
+		status     int
+		sendErr    error
+		wantStatus string
+		wantError  string
+		wantWait   time.Duration
+	}{
+		{name: "Delivered", status: 204, wantStatus: models.DeliveryDelivered},
+		{name: "First failure", status: 503, sendErr: errors.New("status 503"), wantStatus: models.DeliveryPending, wantError: "status 503", wantWait: time.Minute},
+		{name: "Backoff doubles", attempts: 3, sendErr: errors.New("connection refused"), wantStatus: models.DeliveryPending, wantError: "connection refused", wantWait: 8 * time.Minute},
+		{name: "Backoff is capped", attempts: 6, sendErr: errors.New("connection refused"), wantStatus: models.DeliveryPending, wantError: "connection refused", wantWait: 30 * time.Minute},
+		{name: "Out of attempts", attempts: 9, status: 500, sendErr: errors.New("status 500"), wantStatus: models.DeliveryDead, wantError: "status 500"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &mocks.Repository{}
+			cfg := config.New()
+			cfg.WebhookBackoff = time.Minute
+			cfg.WebhookMaxBackoff = 30 * time.Minute
+			cfg.WebhookMaxAttempts = 10
+			service := service.New(repo, cfg)
+
+			delivery := models.Delivery{Id: 3, WebhookId: 1, Event: models.EventLinkCreated, Status: models.DeliveryPending, Attempts: testCase.attempts, Url: "https://crm.example.com/hooks", Secret: "secret"}
+			repo.On("ClaimDeliveries", context.Background(), mock.Anything, cfg.WebhookBatch, mock.Anything).Return([]models.Delivery{delivery}, nil)
+			repo.On("SendWebhook", context.Background(), delivery).Return(testCase.status, testCase.sendErr)
+			repo.On("SaveDelivery", context.Background(), mock.Anything).Return(nil)
+
+			start := time.Now().UTC()
+			n, err := service.DeliverWebhooks(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, 1, n)
+
+			saved := repo.Calls[len(repo.Calls)-1].Arguments.Get(1).(models.Delivery)
+			require.Equal(t, testCase.wantStatus, saved.Status)
+			require.Equal(t, testCase.attempts+1, saved.Attempts)
+			require.Equal(t, testCase.status, saved.LastStatus)
+			require.Equal(t, testCase.wantError, saved.LastError)
+			if testCase.wantStatus == models.DeliveryDelivered {
+				require.NotNil(t, saved.DeliveredAt)
+			}
+			if testCase.wantWait != 0 {
+				require.WithinDuration(t, start.Add(testCase.wantWait), saved.NextAttemptAt, time.Second)
+			}
+		})
+	}
+}
+
+func TestRelayEvents(t *testing.T) {
+	checkpoint := models.Checkpoint{Name: "warehouse", TxId: 10, EventId: 4}
+	linkEvents := []models.LinkEvent{
+		{Id: 5, TxId: 10, Type: "LinkCreated", LinkId: 7},
+		{Id: 3, TxId: 12, Type: "LinkDeleted", LinkId: 6},
+	}
+
+	testCases := []struct {
+		name       string
+		events     []models.LinkEvent
+		publishErr error
+		wantN      int
+		wantErr    bool
+	}{
+		{name: "Published", events: linkEvents, wantN: 2},
+		{name: "Nothing new", events: []models.LinkEvent{}},
+		{name: "Sink failure", events: linkEvents, publishErr: errors.New("connection refused"), wantErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := &mocks.Repository{}
+			cfg := config.New()
+			service := service.New(repo, cfg)
+
+			repo.On("GetCheckpoint", context.Background(), "warehouse").Return(checkpoint, nil)
+			repo.On("GetEvents", context.Background(), checkpoint, cfg.EventsBatch).Return(testCase.events, nil)
+			repo.On("PublishEvents", context.Background(), testCase.events).Return(testCase.publishErr)
+			repo.On("SaveCheckpoint", context.Background(), models.Checkpoint{Name: "warehouse", TxId: 12, EventId: 3}).Return(nil)
+
+			n, err := service.RelayEvents(context.Background())
+			require.Equal(t, testCase.wantN, n)
+			if testCase.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			// The checkpoint only moves past events the sink accepted.
+			if testCase.wantN > 0 {
+				repo.AssertCalled(t, "SaveCheckpoint", context.Background(), models.Checkpoint{Name: "warehouse", TxId: 12, EventId: 3})
+			} else {
+				repo.AssertNotCalled(t, "SaveCheckpoint", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
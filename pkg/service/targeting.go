@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/kristina71/bitlytest/pkg/passthrough"
+	"github.com/kristina71/bitlytest/pkg/targeting"
+	"github.com/kristina71/bitlytest/pkg/useragent"
+)
+
+// Destination picks the url the visitor is sent to and forwards the query string according to the
+// link's policy. Device rules win over geo rules, geo rules over split variants and all of them over
+// the origin url.
+func (s Service) Destination(ctx context.Context, url models.Url, visitor models.Visitor) (models.Destination, error) {
+	destination, err := s.target(ctx, url, visitor)
+
+	target, queryErr := passthrough.Apply(destination.Url, visitor.Query, url.QueryPolicy, passthrough.Utm(url))
+	if queryErr != nil {
+		return destination, queryErr
+	}
+	destination.Url = target
+	return destination, err
+}
+
+func (s Service) target(ctx context.Context, url models.Url, visitor models.Visitor) (models.Destination, error) {
+	origin := models.Destination{Url: url.OriginUrl}
+
+	deviceRules, err := s.repo.GetDeviceRules(ctx, url)
+	if err != nil {
+		return origin, err
+	}
+
+	if rule, ok := targeting.MatchDevice(deviceRules, useragent.Parse(visitor.UserAgent)); ok {
+		return models.Destination{Url: rule.TargetUrl}, nil
+	}
+
+	rules, err := s.repo.GetGeoRules(ctx, url)
+	if err != nil {
+		return origin, err
+	}
+
+	if len(rules) > 0 {
+		country := s.repo.LookupCountry(ctx, visitor.IP)
+		for _, rule := range rules {
+			if rule.Country == country {
+				return models.Destination{Url: rule.TargetUrl}, nil
+			}
+		}
+	}
+
+	variants, err := s.repo.GetVariants(ctx, url)
+	if err != nil {
+		return origin, err
+	}
+
+	// A returning visitor stays on the variant from the cookie while it still takes traffic,
+	// everyone else is spread by a hash of their address and agent.
+	variant, ok := targeting.FindVariant(variants, visitor.VariantId)
+	if !ok {
+		variant, ok = targeting.PickVariant(variants, visitor.IP+"|"+visitor.UserAgent)
+	}
+	if ok {
+		return models.Destination{Url: variant.TargetUrl, VariantId: variant.Id}, nil
+	}
+
+	return origin, nil
+}
+
+// RecordClick counts a visit of the destination returned by Destination and announces it to webhooks.
+func (s Service) RecordClick(ctx context.Context, url models.Url, destination models.Destination) error {
+	if destination.VariantId != 0 {
+		if err := s.repo.IncrementVariantClicks(ctx, models.Variant{Id: destination.VariantId, UrlId: int64(url.Id)}); err != nil {
+			return err
+		}
+	}
+	return s.repo.QueueClick(ctx, url, destination.Url)
+}
+
+func (s Service) GetGeoRules(ctx context.Context, url models.Url) ([]models.GeoRule, error) {
+	url, err := s.repo.GetById(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetGeoRules(ctx, url)
+}
+
+// SetGeoRules replaces the geo rules of a link. An empty list removes all of them.
+func (s Service) SetGeoRules(ctx context.Context, geoRules models.GeoRules) ([]models.GeoRule, error) {
+	url, err := s.repo.GetById(ctx, models.Url{Id: geoRules.Id})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	rules := make([]models.GeoRule, 0, len(geoRules.Rules))
+	for _, rule := range geoRules.Rules {
+		rule.Country = strings.ToUpper(strings.TrimSpace(rule.Country))
+		rule.TargetUrl = strings.TrimSpace(rule.TargetUrl)
+
+		if len(rule.Country) != 2 || strings.Trim(rule.Country, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			return nil, models.BadRequestError("country must be a two letter ISO code, got " + rule.Country)
+		}
+		if seen[rule.Country] {
+			return nil, models.BadRequestError("duplicate rule for country " + rule.Country)
+		}
+		if !s.repo.ValidateUrl(ctx, rule.TargetUrl) {
+			return nil, models.BadRequestError("invalid target url for country " + rule.Country)
+		}
+
+		seen[rule.Country] = true
+		rule.UrlId = int64(url.Id)
+		rules = append(rules, rule)
+	}
+
+	err = s.repo.SetGeoRules(ctx, url, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetGeoRules(ctx, url)
+}
+
+func (s Service) GetStats(ctx context.Context, url models.Url) (models.Stats, error) {
+	url, err := s.repo.GetBySmallUrl(ctx, url)
+	if err != nil {
+		return models.Stats{}, err
+	}
+
+	stats := models.Stats{Url: url}
+	stats.GeoRules, err = s.repo.GetGeoRules(ctx, url)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.DeviceRules, err = s.repo.GetDeviceRules(ctx, url)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.Variants, err = s.repo.GetVariants(ctx, url)
+	return stats, err
+}
+
+func (s Service) GetVariants(ctx context.Context, url models.Url) ([]models.Variant, error) {
+	url, err := s.repo.GetById(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetVariants(ctx, url)
+}
+
+// SetVariants replaces the split destinations of a link without touching its small url.
+// Variants keep their click counts as long as they are sent back with their id.
+func (s Service) SetVariants(ctx context.Context, variants models.Variants) ([]models.Variant, error) {
+	url, err := s.repo.GetById(ctx, models.Url{Id: variants.Id})
+	if err != nil {
+		return nil, err
+	}
+
+	checked, err := s.checkVariants(ctx, variants.Variants)
+	if err != nil {
+		return nil, err
+	}
+	if checked == nil {
+		checked = []models.Variant{}
+	}
+
+	err = s.repo.SetVariants(ctx, url, checked)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetVariants(ctx, url)
+}
+
+// checkTargeting validates the device rules and variants sent along with a link.
+func (s Service) checkTargeting(ctx context.Context, url models.Url) (models.Url, error) {
+	var err error
+	url.DeviceRules, err = s.checkDeviceRules(ctx, url.DeviceRules)
+	if err != nil {
+		return url, err
+	}
+
+	url.Variants, err = s.checkVariants(ctx, url.Variants)
+	return url, err
+}
+
+// checkDeviceRules normalizes the criteria and rejects values the user agent parser never reports.
+func (s Service) checkDeviceRules(ctx context.Context, rules []models.DeviceRule) ([]models.DeviceRule, error) {
+	if rules == nil {
+		return nil, nil
+	}
+
+	checked := make([]models.DeviceRule, 0, len(rules))
+	for i, rule := range rules {
+		rule.OS = strings.ToLower(strings.TrimSpace(rule.OS))
+		rule.Device = strings.ToLower(strings.TrimSpace(rule.Device))
+		rule.Browser = strings.ToLower(strings.TrimSpace(rule.Browser))
+		rule.TargetUrl = strings.TrimSpace(rule.TargetUrl)
+		rule.Position = i
+
+		if rule.OS == "" && rule.Device == "" && rule.Browser == "" {
+			return nil, models.BadRequestError(fmt.Sprintf("device rule %d has no os, device or browser", i))
+		}
+		if !oneOf(rule.OS, useragent.OSes) || !oneOf(rule.Device, useragent.Devices) || !oneOf(rule.Browser, useragent.Browsers) {
+			return nil, models.BadRequestError(fmt.Sprintf("device rule %d has an unknown os, device or browser", i))
+		}
+		if !s.repo.ValidateUrl(ctx, rule.TargetUrl) {
+			return nil, models.BadRequestError(fmt.Sprintf("device rule %d has an invalid target url", i))
+		}
+
+		checked = append(checked, rule)
+	}
+	return checked, nil
+}
+
+func (s Service) checkVariants(ctx context.Context, variants []models.Variant) ([]models.Variant, error) {
+	if len(variants) == 0 {
+		return variants, nil
+	}
+
+	total := 0
+	checked := make([]models.Variant, 0, len(variants))
+	for i, variant := range variants {
+		variant.TargetUrl = strings.TrimSpace(variant.TargetUrl)
+
+		if variant.Weight < 0 {
+			return nil, models.BadRequestError(fmt.Sprintf("variant %d has a negative weight", i))
+		}
+		if !s.repo.ValidateUrl(ctx, variant.TargetUrl) {
+			return nil, models.BadRequestError(fmt.Sprintf("variant %d has an invalid target url", i))
+		}
+
+		total += variant.Weight
+		checked = append(checked, variant)
+	}
+
+	if total == 0 {
+		return nil, models.BadRequestError("at least one variant must have a positive weight")
+	}
+	return checked, nil
+}
+
+func oneOf(value string, allowed []string) bool {
+	if value == "" {
+		return true
+	}
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
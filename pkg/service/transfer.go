@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	neturl "net/url"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+)
+
+// ExportUrls passes every link to fn. Password hashes are left out unless ExportPasswordHashes is set,
+// protected links are then imported without their password.
+func (s Service) ExportUrls(ctx context.Context, fn func(url models.Url) error) error {
+	return s.repo.Export(ctx, func(url models.Url) error {
+		if !s.cfg.ExportPasswordHashes {
+			url.PasswordHash = ""
+		}
+		return fn(url)
+	})
+}
+
+// ImportUrls stores urls taken from an export file. Origin urls are only checked for being
+// well-formed: fetching every destination of a large catalogue would take too long.
+func (s Service) ImportUrls(ctx context.Context, urls []models.Url, opts models.ImportOptions) (models.ImportReport, error) {
+	switch opts.Conflict {
+	case "":
+		opts.Conflict = models.ConflictSkip
+	case models.ConflictSkip, models.ConflictOverwrite, models.ConflictRename:
+	default:
+		return models.ImportReport{}, models.BadRequestError("unknown conflict policy " + opts.Conflict)
+	}
+
+	report := models.ImportReport{DryRun: opts.DryRun, Total: len(urls), Errors: []models.ImportError{}}
+	imported := map[string]uint16{}
+
+	fail := func(i int, url models.Url, err error) {
+		report.Failed++
+		report.Errors = append(report.Errors, models.ImportError{Index: i, SmallUrl: url.SmallUrl, Error: err.Error()})
+	}
+
+	var err error
+	for i, url := range urls {
+		url = trimUrl(url)
+		url.Id = 0
+
+		url, err = s.canonicalize(url)
+		if err != nil {
+			fail(i, url, err)
+			continue
+		}
+		if !isAbsoluteUrl(url.OriginUrl) {
+			fail(i, url, models.BadRequestError("invalid origin url"))
+			continue
+		}
+		if err = s.checkDomain(ctx, url.Domain); err != nil {
+			fail(i, url, err)
+			continue
+		}
+		if err = s.checkSmallUrl(url.SmallUrl); err != nil {
+			fail(i, url, err)
+			continue
+		}
+		url, err = s.withDefaults(url)
+		if err != nil {
+			fail(i, url, err)
+			continue
+		}
+		url, err = s.protect(ctx, url)
+		if err != nil {
+			fail(i, url, err)
+			continue
+		}
+		if url.SmallUrl == "" {
+			url.SmallUrl = s.repo.GenerateUrl(ctx)
+		}
+
+		id, exists := imported[s.codeKey(url)]
+		if !exists {
+			existing, err := s.repo.GetBySmallUrl(ctx, models.Url{Domain: url.Domain, SmallUrl: url.SmallUrl})
+			switch {
+			case err == nil:
+				id, exists = existing.Id, true
+			case !errors.As(err, &models.NotFound{}):
+				fail(i, url, err)
+				continue
+			}
+		}
+
+		if exists {
+			switch opts.Conflict {
+			case models.ConflictSkip:
+				report.Skipped++
+				continue
+			case models.ConflictOverwrite:
+				url.Id = id
+				if !opts.DryRun {
+					if err := s.repo.Update(ctx, url); err != nil {
+						fail(i, url, err)
+						continue
+					}
+					if err := s.importTags(ctx, url); err != nil {
+						fail(i, url, err)
+						continue
+					}
+				}
+				report.Updated++
+				continue
+			case models.ConflictRename:
+				url.SmallUrl = s.repo.GenerateUrl(ctx)
+				report.Renamed++
+			}
+		}
+
+		if !opts.DryRun {
+			url.Id, err = s.repo.Insert(ctx, url)
+			if err != nil {
+				fail(i, url, err)
+				continue
+			}
+			if err = s.importTags(ctx, url); err != nil {
+				fail(i, url, err)
+				continue
+			}
+		}
+		imported[s.codeKey(url)] = url.Id
+		report.Created++
+	}
+
+	return report, nil
+}
+
+// importTags stores the tags of an imported link. Rules and variants are not imported, they refer to
+// ids of the instance the file was exported from.
+func (s Service) importTags(ctx context.Context, url models.Url) error {
+	if url.Tags == nil {
+		return nil
+	}
+	return s.repo.SetTags(ctx, url, url.Tags)
+}
+
+func isAbsoluteUrl(value string) bool {
+	parsed, err := neturl.ParseRequestURI(value)
+	if err != nil {
+		return false
+	}
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+)
+
+func (s Service) GetTrash(ctx context.Context) ([]models.Url, error) {
+	return s.repo.Get(ctx, models.UrlFilter{Deleted: true})
+}
+
+// RestoreUrl takes a deleted link out of the trash. Its small url was kept reserved, so it resolves again right away.
+func (s Service) RestoreUrl(ctx context.Context, url models.Url) (models.Url, error) {
+	return s.repo.Restore(ctx, url)
+}
+
+// Purge removes links that stayed in the trash longer than the retention period.
+func (s Service) Purge(ctx context.Context) (int64, error) {
+	return s.repo.Purge(ctx, time.Now().UTC().Add(-s.cfg.TrashRetention))
+}
+
+// RunPurge purges the trash and prunes relayed events and finished webhook deliveries every interval until ctx is done.
+func (s Service) RunPurge(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.Purge(ctx)
+		if err != nil {
+			log.Println(err)
+		} else if n > 0 {
+			log.Printf("purged %d links from the trash\n", n)
+		}
+
+		n, err = s.PruneEvents(ctx)
+		if err != nil {
+			log.Println(err)
+		} else if n > 0 {
+			log.Printf("pruned %d relayed events\n", n)
+		}
+
+		n, err = s.PruneDeliveries(ctx)
+		if err != nil {
+			log.Println(err)
+		} else if n > 0 {
+			log.Printf("pruned %d webhook deliveries\n", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/config"
+	"github.com/kristina71/bitlytest/pkg/models"
+)
+
+// UnlockUrl checks the password of a protected link. Failed attempts are counted per client and link.
+func (s Service) UnlockUrl(ctx context.Context, url models.Url, password, client string) (models.Url, error) {
+	url, err := s.bySmallUrl(ctx, url)
+	if err != nil {
+		return url, err
+	}
+	if url.PasswordHash == "" {
+		return url, nil
+	}
+
+	key := client + "/" + url.SmallUrl
+	if ok, retryAfter := s.unlocks.Allow(key); !ok {
+		return url, models.TooManyRequestsError(retryAfter)
+	}
+
+	if !s.repo.ComparePassword(ctx, url.PasswordHash, password) {
+		s.unlocks.Fail(key)
+		return url, models.UnauthorizedError("wrong password")
+	}
+
+	s.unlocks.Reset(key)
+	return url, nil
+}
+
+// UnlockToken signs the link together with its password hash, so changing the password revokes old tokens.
+func (s Service) UnlockToken(url models.Url) (string, time.Time) {
+	expires := time.Now().Add(s.cfg.UnlockCookieTTL)
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	return expiry + "." + s.sign(url, expiry), expires
+}
+
+func (s Service) IsUnlocked(url models.Url, token string) bool {
+	if url.PasswordHash == "" {
+		return true
+	}
+
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	expiry, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return false
+	}
+
+	return hmac.Equal([]byte(parts[1]), []byte(s.sign(url, parts[0])))
+}
+
+func (s Service) sign(url models.Url, expiry string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%d|%s|%s|%s", url.Id, url.SmallUrl, url.PasswordHash, expiry)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func cookieSecret(cfg config.Cfg) []byte {
+	if cfg.CookieSecret != "" {
+		return []byte(cfg.CookieSecret)
+	}
+
+	log.Println("COOKIE_SECRET is not set, unlocked links will be locked again after restart")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Println(err)
+	}
+	return secret
+}
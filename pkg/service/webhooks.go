@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+)
+
+// lastErrorLength caps the error kept with a failed delivery.
+const lastErrorLength = 500
+
+// GetWebhooks lists the webhooks without their secrets.
+func (s Service) GetWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	webhooks, err := s.repo.GetWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+// AddWebhook subscribes a url to link events. A secret is generated unless one is given, it is
+// only returned here, receivers need it to check the signature of every payload.
+func (s Service) AddWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error) {
+	webhook, err := checkWebhook(webhook)
+	if err != nil {
+		return webhook, err
+	}
+
+	webhook.Secret = strings.TrimSpace(webhook.Secret)
+	if webhook.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return webhook, err
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+	webhook.Active = true
+
+	return s.repo.AddWebhook(ctx, webhook)
+}
+
+// UpdateWebhook changes the url, the events and whether the webhook is active. Deliveries of an
+// inactive webhook are kept and sent once it is active again.
+func (s Service) UpdateWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error) {
+	webhook, err := checkWebhook(webhook)
+	if err != nil {
+		return webhook, err
+	}
+
+	updated, err := s.repo.UpdateWebhook(ctx, webhook)
+	updated.Secret = ""
+	return updated, err
+}
+
+func (s Service) RemoveWebhook(ctx context.Context, webhook models.Webhook) error {
+	return s.repo.RemoveWebhook(ctx, webhook)
+}
+
+// GetDeliveries lists the attempts to send events, newest first.
+func (s Service) GetDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]models.Delivery, error) {
+	switch filter.Status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		return nil, models.BadRequestError("unknown delivery status " + filter.Status)
+	}
+	return s.repo.GetDeliveries(ctx, filter)
+}
+
+// RetryDelivery sends a dead delivery again, with as many attempts as a new one.
+func (s Service) RetryDelivery(ctx context.Context, delivery models.Delivery) (models.Delivery, error) {
+	return s.repo.RetryDelivery(ctx, delivery)
+}
+
+// PruneDeliveries removes delivered and dead deliveries older than the retention period.
+func (s Service) PruneDeliveries(ctx context.Context) (int64, error) {
+	return s.repo.PruneDeliveries(ctx, time.Now().UTC().Add(-s.cfg.WebhookRetention))
+}
+
+// DeliverWebhooks sends the deliveries that are due and records how each went. A failed delivery is
+// retried with exponential backoff until it runs out of attempts and is marked dead.
+func (s Service) DeliverWebhooks(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	// Deliveries are sent in parallel, so the whole batch is done within about one timeout.
+	deliveries, err := s.repo.ClaimDeliveries(ctx, now, s.cfg.WebhookBatch, now.Add(2*s.cfg.WebhookTimeout))
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery models.Delivery) {
+			defer wg.Done()
+			if err := s.deliver(ctx, delivery); err != nil {
+				log.Println(err)
+			}
+		}(delivery)
+	}
+	wg.Wait()
+
+	return len(deliveries), nil
+}
+
+func (s Service) deliver(ctx context.Context, delivery models.Delivery) error {
+	status, err := s.repo.SendWebhook(ctx, delivery)
+	now := time.Now().UTC()
+
+	delivery.Attempts++
+	delivery.LastStatus = status
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+	case delivery.Attempts >= s.cfg.WebhookMaxAttempts:
+		delivery.Status = models.DeliveryDead
+		delivery.LastError = lastError(err)
+	default:
+		delivery.NextAttemptAt = now.Add(s.webhookBackoff(delivery.Attempts))
+		delivery.LastError = lastError(err)
+	}
+
+	return s.repo.SaveDelivery(ctx, delivery)
+}
+
+// webhookBackoff is the wait after the given number of failed attempts.
+func (s Service) webhookBackoff(attempts int) time.Duration {
+	backoff := s.cfg.WebhookBackoff
+	for i := 1; i < attempts && backoff < s.cfg.WebhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > s.cfg.WebhookMaxBackoff {
+		backoff = s.cfg.WebhookMaxBackoff
+	}
+	return backoff
+}
+
+// RunWebhooks delivers webhooks every interval until ctx is done.
+func (s Service) RunWebhooks(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.WebhookInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep going without waiting while there is a backlog.
+		for {
+			n, err := s.DeliverWebhooks(ctx)
+			if err != nil {
+				log.Println(err)
+			}
+			if err != nil || n < s.cfg.WebhookBatch {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func checkWebhook(webhook models.Webhook) (models.Webhook, error) {
+	webhook.Url = strings.TrimSpace(webhook.Url)
+	parsed, err := neturl.Parse(webhook.Url)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return webhook, models.BadRequestError("webhook url must be an absolute http or https url")
+	}
+
+	if len(webhook.Events) == 0 {
+		return webhook, models.BadRequestError("webhook needs at least one event")
+	}
+
+	events := make([]string, 0, len(webhook.Events))
+	seen := map[string]bool{}
+	for _, event := range webhook.Events {
+		event = strings.TrimSpace(event)
+		if !isWebhookEvent(event) {
+			return webhook, models.BadRequestError("unknown event " + event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	webhook.Events = events
+
+	return webhook, nil
+}
+
+func isWebhookEvent(event string) bool {
+	for _, known := range models.WebhookEvents {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+func lastError(err error) string {
+	message := err.Error()
+	if len(message) > lastErrorLength {
+		message = message[:lastErrorLength]
+	}
+	return message
+}
@@ -0,0 +1,21 @@
+package targeting
+
+import (
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/kristina71/bitlytest/pkg/useragent"
+)
+
+// MatchDevice returns the first rule whose every set criterion matches the agent.
+// Empty criteria match anything, so a rule with only OS set covers all devices of that OS.
+func MatchDevice(rules []models.DeviceRule, agent useragent.Agent) (models.DeviceRule, bool) {
+	for _, rule := range rules {
+		if matches(rule.OS, agent.OS) && matches(rule.Device, agent.Device) && matches(rule.Browser, agent.Browser) {
+			return rule, true
+		}
+	}
+	return models.DeviceRule{}, false
+}
+
+func matches(criterion, value string) bool {
+	return criterion == "" || criterion == value
+}
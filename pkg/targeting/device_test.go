@@ -0,0 +1,74 @@
+package targeting_test
+
+import (
+	"testing"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/kristina71/bitlytest/pkg/targeting"
+	"github.com/kristina71/bitlytest/pkg/useragent"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchDevice(t *testing.T) {
+	appStore := models.DeviceRule{OS: useragent.OSiOS, TargetUrl: "https://apps.apple.com/app/id1"}
+	playStore := models.DeviceRule{OS: useragent.OSAndroid, TargetUrl: "https://play.google.com/store/apps/details?id=app"}
+	iosChrome := models.DeviceRule{OS: useragent.OSiOS, Browser: useragent.BrowserChrome, TargetUrl: "https://example.com/chrome"}
+	tablets := models.DeviceRule{Device: useragent.DeviceTablet, TargetUrl: "https://example.com/tablet"}
+
+	testCases := []struct {
+		name     string
+		rules    []models.DeviceRule
+		agent    useragent.Agent
+		expected models.DeviceRule
+		matched  bool
+	}{
+		{
+			name:     "No rules",
+			rules:    []models.DeviceRule{},
+			agent:    useragent.Agent{OS: useragent.OSiOS, Device: useragent.DeviceMobile, Browser: useragent.BrowserSafari},
+			expected: models.DeviceRule{},
+		},
+		{
+			name:     "Match by os",
+			rules:    []models.DeviceRule{appStore, playStore},
+			agent:    useragent.Agent{OS: useragent.OSAndroid, Device: useragent.DeviceMobile, Browser: useragent.BrowserChrome},
+			expected: playStore,
+			matched:  true,
+		},
+		{
+			name:     "Desktop falls through",
+			rules:    []models.DeviceRule{appStore, playStore},
+			agent:    useragent.Agent{OS: useragent.OSWindows, Device: useragent.DeviceDesktop, Browser: useragent.BrowserEdge},
+			expected: models.DeviceRule{},
+		},
+		{
+			name:     "All criteria must match",
+			rules:    []models.DeviceRule{iosChrome},
+			agent:    useragent.Agent{OS: useragent.OSiOS, Device: useragent.DeviceMobile, Browser: useragent.BrowserSafari},
+			expected: models.DeviceRule{},
+		},
+		{
+			name:     "First matching rule wins",
+			rules:    []models.DeviceRule{iosChrome, appStore},
+			agent:    useragent.Agent{OS: useragent.OSiOS, Device: useragent.DeviceMobile, Browser: useragent.BrowserChrome},
+			expected: iosChrome,
+			matched:  true,
+		},
+		{
+			name:     "Order decides between overlapping rules",
+			rules:    []models.DeviceRule{tablets, appStore},
+			agent:    useragent.Agent{OS: useragent.OSiOS, Device: useragent.DeviceTablet, Browser: useragent.BrowserSafari},
+			expected: tablets,
+			matched:  true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rule, matched := targeting.MatchDevice(testCase.rules, testCase.agent)
+			require.Equal(t, testCase.matched, matched)
+			require.Equal(t, testCase.expected, rule)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package targeting
+
+import (
+	"hash/fnv"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+)
+
+// PickVariant chooses a variant with a probability proportional to its weight.
+// The choice depends only on key, so the same visitor keeps landing on the same variant.
+func PickVariant(variants []models.Variant, key string) (models.Variant, bool) {
+	total := 0
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+	if total <= 0 {
+		return models.Variant{}, false
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	point := int(h.Sum32() % uint32(total))
+
+	for _, variant := range variants {
+		if point < variant.Weight {
+			return variant, true
+		}
+		point -= variant.Weight
+	}
+	return models.Variant{}, false
+}
+
+// FindVariant returns the variant with the given id if it still takes traffic.
+func FindVariant(variants []models.Variant, id int64) (models.Variant, bool) {
+	for _, variant := range variants {
+		if variant.Id == id && variant.Weight > 0 {
+			return variant, true
+		}
+	}
+	return models.Variant{}, false
+}
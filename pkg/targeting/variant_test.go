@@ -0,0 +1,94 @@
+package targeting_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/kristina71/bitlytest/pkg/targeting"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickVariant(t *testing.T) {
+	a := models.Variant{Id: 1, TargetUrl: "https://example.com/a", Weight: 1}
+	b := models.Variant{Id: 2, TargetUrl: "https://example.com/b", Weight: 1}
+	off := models.Variant{Id: 3, TargetUrl: "https://example.com/off", Weight: 0}
+
+	testCases := []struct {
+		name     string
+		variants []models.Variant
+		expected []models.Variant
+		picked   bool
+	}{
+		{
+			name:     "No variants",
+			variants: []models.Variant{},
+		},
+		{
+			name:     "All weights zero",
+			variants: []models.Variant{off},
+		},
+		{
+			name:     "Single variant takes everything",
+			variants: []models.Variant{off, a},
+			expected: []models.Variant{a},
+			picked:   true,
+		},
+		{
+			name:     "Split between variants",
+			variants: []models.Variant{a, off, b},
+			expected: []models.Variant{a, b},
+			picked:   true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			for i := 0; i < 50; i++ {
+				variant, picked := targeting.PickVariant(testCase.variants, fmt.Sprintf("visitor-%d", i))
+				require.Equal(t, testCase.picked, picked)
+				if picked {
+					require.Contains(t, testCase.expected, variant)
+				}
+			}
+		})
+	}
+}
+
+func TestPickVariantIsSticky(t *testing.T) {
+	variants := []models.Variant{{Id: 1, Weight: 30}, {Id: 2, Weight: 70}}
+
+	first, _ := targeting.PickVariant(variants, "127.0.0.1|curl/7.68.0")
+	for i := 0; i < 10; i++ {
+		variant, _ := targeting.PickVariant(variants, "127.0.0.1|curl/7.68.0")
+		require.Equal(t, first, variant)
+	}
+}
+
+func TestPickVariantFollowsWeights(t *testing.T) {
+	variants := []models.Variant{{Id: 1, Weight: 1}, {Id: 2, Weight: 3}}
+
+	counts := map[int64]int{}
+	for i := 0; i < 4000; i++ {
+		variant, _ := targeting.PickVariant(variants, fmt.Sprintf("visitor-%d", i))
+		counts[variant.Id]++
+	}
+
+	require.InDelta(t, 1000, counts[1], 150)
+	require.InDelta(t, 3000, counts[2], 150)
+}
+
+func TestFindVariant(t *testing.T) {
+	variants := []models.Variant{{Id: 1, Weight: 1}, {Id: 2, Weight: 0}}
+
+	variant, ok := targeting.FindVariant(variants, 1)
+	require.True(t, ok)
+	require.Equal(t, variants[0], variant)
+
+	_, ok = targeting.FindVariant(variants, 2)
+	require.False(t, ok)
+
+	_, ok = targeting.FindVariant(variants, 3)
+	require.False(t, ok)
+}
@@ -0,0 +1,16 @@
+package throttle
+
+import "time"
+
+// SetNow replaces the clock of l, so tests move time by hand.
+func SetNow(l *Limiter, now func() time.Time) {
+	l.now = now
+}
+
+// Keys counts the keys l still keeps failures for.
+func Keys(l *Limiter) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.failures)
+}
@@ -0,0 +1,71 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter counts failed attempts per key and blocks the key once maxAttempts fail within window.
+type Limiter struct {
+	maxAttempts int
+	window      time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	failures map[string][]time.Time
+}
+
+func New(maxAttempts int, window time.Duration) *Limiter {
+	return &Limiter{
+		maxAttempts: maxAttempts,
+		window:      window,
+		now:         time.Now,
+		failures:    map[string][]time.Time{},
+	}
+}
+
+// Allow reports whether another attempt may be made for key and, if not, how long to wait.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	failures := l.recent(key)
+	if len(failures) < l.maxAttempts {
+		return true, 0
+	}
+	return false, failures[0].Add(l.window).Sub(l.now())
+}
+
+func (l *Limiter) Fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.failures[key] = append(l.recent(key), l.now())
+	l.cleanup()
+}
+
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.failures, key)
+}
+
+func (l *Limiter) recent(key string) []time.Time {
+	since := l.now().Add(-l.window)
+	failures := l.failures[key]
+	for len(failures) > 0 && !failures[0].After(since) {
+		failures = failures[1:]
+	}
+	if len(failures) == 0 {
+		delete(l.failures, key)
+	}
+	return failures
+}
+
+// cleanup drops keys whose failures all fell out of the window so the map does not grow forever.
+func (l *Limiter) cleanup() {
+	for key := range l.failures {
+		l.recent(key)
+	}
+}
@@ -0,0 +1,113 @@
+package throttle_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/throttle"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	testCases := []struct {
+		name    string
+		run     func(l *throttle.Limiter, tick func(time.Duration))
+		allowed bool
+		wait    time.Duration
+		keys    int
+	}{
+		{
+			name: "Fewer failures than allowed",
+			run: func(l *throttle.Limiter, tick func(time.Duration)) {
+				l.Fail("a")
+				l.Fail("a")
+			},
+			allowed: true,
+			keys:    1,
+		},
+		{
+			name: "Blocked until the oldest failure leaves the window",
+			run: func(l *throttle.Limiter, tick func(time.Duration)) {
+				l.Fail("a")
+				tick(20 * time.Second)
+				l.Fail("a")
+				tick(20 * time.Second)
+				l.Fail("a")
+			},
+			wait: 20 * time.Second,
+			keys: 1,
+		},
+		{
+			name: "Allowed once the window passed",
+			run: func(l *throttle.Limiter, tick func(time.Duration)) {
+				l.Fail("a")
+				l.Fail("a")
+				l.Fail("a")
+				tick(time.Minute)
+			},
+			allowed: true,
+			keys:    0,
+		},
+		{
+			name: "Only failures within the window count",
+			run: func(l *throttle.Limiter, tick func(time.Duration)) {
+				l.Fail("a")
+				l.Fail("a")
+				tick(time.Minute)
+				l.Fail("a")
+				l.Fail("a")
+			},
+			allowed: true,
+			keys:    1,
+		},
+		{
+			name: "Reset forgets the failures",
+			run: func(l *throttle.Limiter, tick func(time.Duration)) {
+				l.Fail("a")
+				l.Fail("a")
+				l.Fail("a")
+				l.Reset("a")
+			},
+			allowed: true,
+			keys:    0,
+		},
+		{
+			name: "Keys are counted apart",
+			run: func(l *throttle.Limiter, tick func(time.Duration)) {
+				l.Fail("a")
+				l.Fail("b")
+				l.Fail("b")
+				l.Fail("b")
+			},
+			allowed: true,
+			keys:    2,
+		},
+		{
+			name: "Stale keys are dropped on the next failure",
+			run: func(l *throttle.Limiter, tick func(time.Duration)) {
+				l.Fail("a")
+				l.Fail("b")
+				tick(2 * time.Minute)
+				l.Fail("c")
+			},
+			allowed: true,
+			keys:    1,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+			limiter := throttle.New(3, time.Minute)
+			throttle.SetNow(limiter, func() time.Time { return now })
+
+			testCase.run(limiter, func(d time.Duration) { now = now.Add(d) })
+
+			allowed, wait := limiter.Allow("a")
+			require.Equal(t, testCase.allowed, allowed)
+			require.Equal(t, testCase.wait, wait)
+			require.Equal(t, testCase.keys, throttle.Keys(limiter))
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+)
+
+type Format string
+
+const (
+	CSV    Format = "csv"
+	JSON   Format = "json"
+	NDJSON Format = "ndjson"
+	Bitly  Format = "bitly"
+	Yourls Format = "yourls"
+)
+
+// csvHeader lists every stored setting of a link, so an export can be imported without losing any.
+// Tags are joined with commas, which a tag cannot contain.
+var csvHeader = []string{
+	"id", "domain", "small_url", "origin_url", "owner", "created_at", "updated_at", "always_preview", "redirect_type",
+	"password_hash", "active_from", "active_until", "query_policy", "utm_source", "utm_medium", "utm_campaign",
+	"title", "notes", "tags", "description", "image_url", "favicon_url",
+}
+
+// record is a link as exported to json. Unlike the api it carries the password hash when the export
+// includes them, a protected link then stays protected after a round trip.
+type record struct {
+	models.Url
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+type Encoder interface {
+	Encode(url models.Url) error
+	Close() error
+}
+
+func ContentType(format Format) string {
+	switch format {
+	case CSV:
+		return "text/csv"
+	case NDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/json"
+	}
+}
+
+func NewEncoder(w io.Writer, format Format) (Encoder, error) {
+	switch format {
+	case CSV:
+		e := &csvEncoder{w: csv.NewWriter(w)}
+		return e, e.w.Write(csvHeader)
+	case JSON:
+		return &jsonEncoder{w: w}, nil
+	case NDJSON:
+		return &ndjsonEncoder{e: json.NewEncoder(w)}, nil
+	default:
+		return nil, models.BadRequestError("unsupported export format " + string(format))
+	}
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) Encode(url models.Url) error {
+	return e.w.Write([]string{
+		strconv.Itoa(int(url.Id)),
+		url.Domain,
+		url.SmallUrl,
+		url.OriginUrl,
+		url.Owner,
+		url.CreatedAt.Format(time.RFC3339),
+		url.UpdateAt.Format(time.RFC3339),
+		strconv.FormatBool(url.AlwaysPreview),
+		url.RedirectType,
+		url.PasswordHash,
+		formatTime(url.ActiveFrom),
+		formatTime(url.ActiveUntil),
+		url.QueryPolicy,
+		url.UtmSource,
+		url.UtmMedium,
+		url.UtmCampaign,
+		url.Title,
+		url.Notes,
+		strings.Join(url.Tags, ","),
+		url.Description,
+		url.ImageUrl,
+		url.FaviconUrl,
+	})
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func (e *csvEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type jsonEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonEncoder) Encode(url models.Url) error {
+	b, err := json.Marshal(record{Url: url, PasswordHash: url.PasswordHash})
+	if err != nil {
+		return err
+	}
+
+	prefix := ","
+	if e.count == 0 {
+		prefix = "["
+	}
+	e.count++
+
+	_, err = e.w.Write(append([]byte(prefix), b...))
+	return err
+}
+
+func (e *jsonEncoder) Close() error {
+	closing := "]"
+	if e.count == 0 {
+		closing = "[]"
+	}
+	_, err := io.WriteString(e.w, closing)
+	return err
+}
+
+type ndjsonEncoder struct {
+	e *json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(url models.Url) error {
+	return e.e.Encode(record{Url: url, PasswordHash: url.PasswordHash})
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return nil
+}
@@ -0,0 +1,264 @@
+package transfer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+)
+
+// Header names used by our own export and by the Bitly and YOURLS export layouts.
+var (
+	smallUrlColumns  = []string{"small_url", "keyword", "bitlink", "link", "short_url", "shorturl"}
+	originUrlColumns = []string{"origin_url", "long_url", "url"}
+	createdColumns   = []string{"created_at", "created", "timestamp", "date"}
+	updatedColumns   = []string{"updated_at"}
+)
+
+var settingColumns = map[string]func(url *models.Url, value string){
+	"domain":         func(url *models.Url, value string) { url.Domain = value },
+	"owner":          func(url *models.Url, value string) { url.Owner = value },
+	"always_preview": func(url *models.Url, value string) { url.AlwaysPreview, _ = strconv.ParseBool(value) },
+	"redirect_type":  func(url *models.Url, value string) { url.RedirectType = value },
+	"password_hash":  func(url *models.Url, value string) { url.PasswordHash = value },
+	"active_from":    func(url *models.Url, value string) { url.ActiveFrom = parseOptionalTime(value) },
+	"active_until":   func(url *models.Url, value string) { url.ActiveUntil = parseOptionalTime(value) },
+	"query_policy":   func(url *models.Url, value string) { url.QueryPolicy = value },
+	"utm_source":     func(url *models.Url, value string) { url.UtmSource = value },
+	"utm_medium":     func(url *models.Url, value string) { url.UtmMedium = value },
+	"utm_campaign":   func(url *models.Url, value string) { url.UtmCampaign = value },
+	"title":          func(url *models.Url, value string) { url.Title = value },
+	"notes":          func(url *models.Url, value string) { url.Notes = value },
+	"tags":           func(url *models.Url, value string) { url.Tags = strings.Split(value, ",") },
+	"description":    func(url *models.Url, value string) { url.Description = value },
+	"image_url":      func(url *models.Url, value string) { url.ImageUrl = value },
+	"favicon_url":    func(url *models.Url, value string) { url.FaviconUrl = value },
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func Decode(r io.Reader, format Format) ([]models.Url, error) {
+	switch format {
+	case CSV, Yourls:
+		return decodeCsv(r)
+	case JSON:
+		records := []record{}
+		if err := json.NewDecoder(r).Decode(&records); err != nil {
+			return nil, models.BadRequestError(err.Error())
+		}
+		urls := make([]models.Url, 0, len(records))
+		for _, link := range records {
+			urls = append(urls, link.url())
+		}
+		return urls, nil
+	case NDJSON:
+		return decodeNdjson(r)
+	case Bitly:
+		return decodeBitly(r)
+	default:
+		return nil, models.BadRequestError("unsupported import format " + string(format))
+	}
+}
+
+func decodeCsv(r io.Reader) ([]models.Url, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return []models.Url{}, nil
+	}
+	if err != nil {
+		return nil, models.BadRequestError(err.Error())
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		name = strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+		columns[name] = i
+	}
+
+	smallUrl, okSmall := findColumn(columns, smallUrlColumns)
+	originUrl, okOrigin := findColumn(columns, originUrlColumns)
+	if !okOrigin {
+		return nil, models.BadRequestError("csv header has no origin url column")
+	}
+	created, okCreated := findColumn(columns, createdColumns)
+	updated, okUpdated := findColumn(columns, updatedColumns)
+
+	// Settings only our own export has.
+	settings := map[int]func(url *models.Url, value string){}
+	for name, set := range settingColumns {
+		if i, ok := columns[name]; ok {
+			settings[i] = set
+		}
+	}
+
+	urls := []models.Url{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return urls, nil
+		}
+		if err != nil {
+			return nil, models.BadRequestError(err.Error())
+		}
+
+		url := models.Url{OriginUrl: field(record, originUrl)}
+		if okSmall {
+			url.SmallUrl = shortCode(field(record, smallUrl))
+		}
+		if okCreated {
+			url.CreatedAt = parseTime(field(record, created))
+		}
+		if okUpdated {
+			url.UpdateAt = parseTime(field(record, updated))
+		}
+		for i, set := range settings {
+			if value := field(record, i); value != "" {
+				set(&url, value)
+			}
+		}
+		urls = append(urls, url)
+	}
+}
+
+func decodeNdjson(r io.Reader) ([]models.Url, error) {
+	urls := []models.Url{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		link := record{}
+		if err := json.Unmarshal([]byte(line), &link); err != nil {
+			return nil, models.BadRequestError(err.Error())
+		}
+		urls = append(urls, link.url())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, models.BadRequestError(err.Error())
+	}
+	return urls, nil
+}
+
+type bitlyLink struct {
+	Id        string `json:"id"`
+	Link      string `json:"link"`
+	LongUrl   string `json:"long_url"`
+	CreatedAt string `json:"created_at"`
+}
+
+// decodeBitly accepts both the csv export of the Bitly dashboard and the json body of the bitlinks api.
+func decodeBitly(r io.Reader) ([]models.Url, error) {
+	reader := bufio.NewReader(r)
+	first, err := reader.Peek(1)
+	if err == io.EOF {
+		return []models.Url{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if first[0] != '{' {
+		return decodeCsv(reader)
+	}
+
+	body := struct {
+		Links []bitlyLink `json:"links"`
+	}{}
+	if err := json.NewDecoder(reader).Decode(&body); err != nil {
+		return nil, models.BadRequestError(err.Error())
+	}
+
+	urls := make([]models.Url, 0, len(body.Links))
+	for _, link := range body.Links {
+		smallUrl := link.Link
+		if smallUrl == "" {
+			smallUrl = link.Id
+		}
+		urls = append(urls, models.Url{
+			SmallUrl:  shortCode(smallUrl),
+			OriginUrl: link.LongUrl,
+			CreatedAt: parseTime(link.CreatedAt),
+		})
+	}
+	return urls, nil
+}
+
+func findColumn(columns map[string]int, names []string) (int, bool) {
+	for _, name := range names {
+		if i, ok := columns[name]; ok {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func field(record []string, i int) string {
+	if i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// shortCode strips the host of full short links such as "https://bit.ly/abc" or "bit.ly/abc".
+func shortCode(value string) string {
+	if !strings.Contains(value, "/") {
+		return value
+	}
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+
+	parsed, err := neturl.Parse(value)
+	if err != nil {
+		return value
+	}
+	return strings.Trim(parsed.Path, "/")
+}
+
+func parseTime(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC()
+		}
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC()
+	}
+	return time.Time{}
+}
+
+func parseOptionalTime(value string) *time.Time {
+	t := parseTime(value)
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (r record) url() models.Url {
+	url := r.Url
+	url.PasswordHash = r.PasswordHash
+	return url
+}
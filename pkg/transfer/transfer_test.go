@@ -0,0 +1,156 @@
+package transfer_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/models"
+	"github.com/kristina71/bitlytest/pkg/transfer"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	createdAt := time.Date(2021, 5, 26, 21, 42, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		format   transfer.Format
+		body     string
+		expected []models.Url
+		wantErr  bool
+	}{
+		{
+			name:   "Own csv export",
+			format: transfer.CSV,
+			body: "id,small_url,origin_url,created_at,updated_at\n" +
+				"1,xyz,http://google.com,2021-05-26T21:42:00Z,2021-05-26T21:42:00Z\n",
+			expected: []models.Url{{SmallUrl: "xyz", OriginUrl: "http://google.com", CreatedAt: createdAt, UpdateAt: createdAt}},
+		},
+		{
+			name:     "Json array",
+			format:   transfer.JSON,
+			body:     `[{"small_url":"xyz","origin_url":"http://google.com"}]`,
+			expected: []models.Url{{SmallUrl: "xyz", OriginUrl: "http://google.com"}},
+		},
+		{
+			name:   "Ndjson stream",
+			format: transfer.NDJSON,
+			body:   "{\"small_url\":\"a\",\"origin_url\":\"http://google.com\"}\n\n{\"small_url\":\"b\",\"origin_url\":\"http://yandex.ru\"}\n",
+			expected: []models.Url{
+				{SmallUrl: "a", OriginUrl: "http://google.com"},
+				{SmallUrl: "b", OriginUrl: "http://yandex.ru"},
+			},
+		},
+		{
+			name:   "Bitly csv layout",
+			format: transfer.Bitly,
+			body: "Created At,Title,Long URL,Bitlink\n" +
+				"2021-05-26T21:42:00+0000,Google,http://google.com,https://bit.ly/3abcDEF\n",
+			expected: []models.Url{{SmallUrl: "3abcDEF", OriginUrl: "http://google.com", CreatedAt: createdAt, Title: "Google"}},
+		},
+		{
+			name:     "Bitly api layout",
+			format:   transfer.Bitly,
+			body:     `{"links":[{"id":"bit.ly/3abcDEF","link":"https://bit.ly/3abcDEF","long_url":"http://google.com","created_at":"2021-05-26T21:42:00+0000"}]}`,
+			expected: []models.Url{{SmallUrl: "3abcDEF", OriginUrl: "http://google.com", CreatedAt: createdAt}},
+		},
+		{
+			name:   "Yourls csv layout",
+			format: transfer.Yourls,
+			body: "keyword,url,title,timestamp,ip,clicks\n" +
+				"ozh,http://ozh.org,Ozh,2021-05-26 21:42:00,127.0.0.1,10\n",
+			expected: []models.Url{{SmallUrl: "ozh", OriginUrl: "http://ozh.org", CreatedAt: createdAt, Title: "Ozh"}},
+		},
+		{
+			name:    "Csv without origin url column",
+			format:  transfer.CSV,
+			body:    "small_url\nxyz\n",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown format",
+			format:  transfer.Format("xml"),
+			body:    "<links/>",
+			wantErr: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			urls, err := transfer.Decode(strings.NewReader(testCase.body), testCase.format)
+			if testCase.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, urls)
+		})
+	}
+}
+
+func TestEncodeJson(t *testing.T) {
+	buf := &bytes.Buffer{}
+	encoder, err := transfer.NewEncoder(buf, transfer.JSON)
+	require.NoError(t, err)
+	require.NoError(t, encoder.Close())
+	require.Equal(t, "[]", buf.String())
+
+	buf.Reset()
+	encoder, err = transfer.NewEncoder(buf, transfer.JSON)
+	require.NoError(t, err)
+	require.NoError(t, encoder.Encode(models.Url{Id: 1, SmallUrl: "a", OriginUrl: "http://google.com"}))
+	require.NoError(t, encoder.Encode(models.Url{Id: 2, SmallUrl: "b", OriginUrl: "http://yandex.ru"}))
+	require.NoError(t, encoder.Close())
+
+	urls, err := transfer.Decode(buf, transfer.JSON)
+	require.NoError(t, err)
+	require.Len(t, urls, 2)
+}
+
+func TestRoundTrip(t *testing.T) {
+	createdAt := time.Date(2021, 5, 26, 21, 42, 0, 0, time.UTC)
+	activeFrom := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+	activeUntil := time.Date(2021, 7, 1, 8, 0, 0, 0, time.UTC)
+
+	url := models.Url{
+		Domain:        "go.example.com",
+		SmallUrl:      "sale",
+		OriginUrl:     "http://google.com/sale",
+		Owner:         "crm",
+		CreatedAt:     createdAt,
+		UpdateAt:      createdAt,
+		AlwaysPreview: true,
+		RedirectType:  models.RedirectPermanent,
+		PasswordHash:  "hash",
+		ActiveFrom:    &activeFrom,
+		ActiveUntil:   &activeUntil,
+		QueryPolicy:   models.QueryMerge,
+		UtmSource:     "mail",
+		UtmMedium:     "email",
+		UtmCampaign:   "summer",
+		Title:         "Summer sale",
+		Notes:         "for the newsletter, \"june\"",
+		Tags:          []string{"promo", "summer"},
+		Description:   "Everything half price",
+		ImageUrl:      "http://google.com/sale.png",
+		FaviconUrl:    "http://google.com/favicon.ico",
+	}
+
+	for _, format := range []transfer.Format{transfer.CSV, transfer.JSON, transfer.NDJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			encoder, err := transfer.NewEncoder(buf, format)
+			require.NoError(t, err)
+			require.NoError(t, encoder.Encode(url))
+			require.NoError(t, encoder.Close())
+
+			urls, err := transfer.Decode(buf, format)
+			require.NoError(t, err)
+			require.Equal(t, []models.Url{url}, urls)
+		})
+	}
+}
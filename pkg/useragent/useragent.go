@@ -0,0 +1,129 @@
+package useragent
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	OSiOS      = "ios"
+	OSAndroid  = "android"
+	OSWindows  = "windows"
+	OSMacOS    = "macos"
+	OSLinux    = "linux"
+	OSChromeOS = "chromeos"
+
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+	DeviceBot     = "bot"
+
+	BrowserChrome  = "chrome"
+	BrowserSafari  = "safari"
+	BrowserFirefox = "firefox"
+	BrowserEdge    = "edge"
+	BrowserOpera   = "opera"
+	BrowserSamsung = "samsung"
+	BrowserIE      = "ie"
+
+	Other = "other"
+)
+
+var (
+	OSes     = []string{OSiOS, OSAndroid, OSWindows, OSMacOS, OSLinux, OSChromeOS, Other}
+	Devices  = []string{DeviceMobile, DeviceTablet, DeviceDesktop, DeviceBot}
+	Browsers = []string{BrowserChrome, BrowserSafari, BrowserFirefox, BrowserEdge, BrowserOpera, BrowserSamsung, BrowserIE, Other}
+)
+
+type Agent struct {
+	OS      string `json:"os"`
+	Device  string `json:"device"`
+	Browser string `json:"browser"`
+}
+
+var bots = []string{"bot", "crawler", "spider", "slurp", "facebookexternalhit", "curl/", "wget/", "python-requests", "go-http-client"}
+
+// Parse classifies a User-Agent header. It only knows the families needed for redirect rules.
+func Parse(header string) Agent {
+	ua := strings.ToLower(header)
+	return Agent{
+		OS:      parseOS(ua),
+		Device:  parseDevice(ua),
+		Browser: parseBrowser(ua),
+	}
+}
+
+func parseOS(ua string) string {
+	switch {
+	case containsAny(ua, "iphone", "ipad", "ipod"):
+		return OSiOS
+	case strings.Contains(ua, "android"):
+		return OSAndroid
+	case hasToken(ua, "cros"):
+		return OSChromeOS
+	case strings.Contains(ua, "windows"):
+		return OSWindows
+	case containsAny(ua, "macintosh", "mac os x"):
+		return OSMacOS
+	case containsAny(ua, "linux", "x11"):
+		return OSLinux
+	default:
+		return Other
+	}
+}
+
+func parseDevice(ua string) string {
+	switch {
+	case ua == "" || containsAny(ua, bots...):
+		return DeviceBot
+	case containsAny(ua, "ipad", "tablet", "kindle", "silk/"),
+		strings.Contains(ua, "android") && !strings.Contains(ua, "mobile"):
+		return DeviceTablet
+	case containsAny(ua, "mobi", "iphone", "ipod", "windows phone"):
+		return DeviceMobile
+	default:
+		return DeviceDesktop
+	}
+}
+
+// parseBrowser checks the browsers built on Chrome or Safari before Chrome and Safari themselves,
+// because their User-Agent strings mention both.
+func parseBrowser(ua string) string {
+	switch {
+	case containsAny(ua, "edg/", "edge/", "edga/", "edgios/"):
+		return BrowserEdge
+	case containsAny(ua, "opr/", "opera"):
+		return BrowserOpera
+	case strings.Contains(ua, "samsungbrowser"):
+		return BrowserSamsung
+	case containsAny(ua, "firefox/", "fxios/"):
+		return BrowserFirefox
+	case containsAny(ua, "chrome/", "crios/", "chromium/"):
+		return BrowserChrome
+	case strings.Contains(ua, "safari/"):
+		return BrowserSafari
+	case containsAny(ua, "msie", "trident/"):
+		return BrowserIE
+	default:
+		return Other
+	}
+}
+
+func containsAny(s string, substrings ...string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasToken reports whether token appears as a word of its own, "cros" must not match "microsoft".
+func hasToken(s, token string) bool {
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		if field == token {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package useragent_test
+
+import (
+	"testing"
+
+	"github.com/kristina71/bitlytest/pkg/useragent"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name     string
+		ua       string
+		expected useragent.Agent
+	}{
+		{
+			name:     "Safari on iPhone",
+			ua:       "Mozilla/5.0 (iPhone; CPU iPhone OS 14_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.1.1 Mobile/15E148 Safari/604.1",
+			expected: useragent.Agent{OS: useragent.OSiOS, Device: useragent.DeviceMobile, Browser: useragent.BrowserSafari},
+		},
+		{
+			name:     "Chrome on iPad",
+			ua:       "Mozilla/5.0 (iPad; CPU OS 14_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/91.0.4472.80 Mobile/15E148 Safari/604.1",
+			expected: useragent.Agent{OS: useragent.OSiOS, Device: useragent.DeviceTablet, Browser: useragent.BrowserChrome},
+		},
+		{
+			name:     "Chrome on Android phone",
+			ua:       "Mozilla/5.0 (Linux; Android 11; Pixel 5) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.120 Mobile Safari/537.36",
+			expected: useragent.Agent{OS: useragent.OSAndroid, Device: useragent.DeviceMobile, Browser: useragent.BrowserChrome},
+		},
+		{
+			name:     "Samsung browser on Android tablet",
+			ua:       "Mozilla/5.0 (Linux; Android 10; SM-T510) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/14.2 Chrome/87.0.4280.141 Safari/537.36",
+			expected: useragent.Agent{OS: useragent.OSAndroid, Device: useragent.DeviceTablet, Browser: useragent.BrowserSamsung},
+		},
+		{
+			name:     "Edge on Windows",
+			ua:       "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36 Edg/91.0.864.59",
+			expected: useragent.Agent{OS: useragent.OSWindows, Device: useragent.DeviceDesktop, Browser: useragent.BrowserEdge},
+		},
+		{
+			name:     "Firefox on Linux",
+			ua:       "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:89.0) Gecko/20100101 Firefox/89.0",
+			expected: useragent.Agent{OS: useragent.OSLinux, Device: useragent.DeviceDesktop, Browser: useragent.BrowserFirefox},
+		},
+		{
+			name:     "Opera on macOS",
+			ua:       "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.114 Safari/537.36 OPR/77.0.4054.172",
+			expected: useragent.Agent{OS: useragent.OSMacOS, Device: useragent.DeviceDesktop, Browser: useragent.BrowserOpera},
+		},
+		{
+			name:     "Chrome on Chromebook",
+			ua:       "Mozilla/5.0 (X11; CrOS x86_64 13904.55.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.114 Safari/537.36",
+			expected: useragent.Agent{OS: useragent.OSChromeOS, Device: useragent.DeviceDesktop, Browser: useragent.BrowserChrome},
+		},
+		{
+			name:     "Outlook on Windows",
+			ua:       "Microsoft Office/16.0 (Windows NT 10.0; Microsoft Outlook 16.0.13901; Pro)",
+			expected: useragent.Agent{OS: useragent.OSWindows, Device: useragent.DeviceDesktop, Browser: useragent.Other},
+		},
+		{
+			name:     "Internet Explorer",
+			ua:       "Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; rv:11.0) like Gecko",
+			expected: useragent.Agent{OS: useragent.OSWindows, Device: useragent.DeviceDesktop, Browser: useragent.BrowserIE},
+		},
+		{
+			name:     "Search engine crawler",
+			ua:       "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			expected: useragent.Agent{OS: useragent.Other, Device: useragent.DeviceBot, Browser: useragent.Other},
+		},
+		{
+			name:     "Empty header",
+			ua:       "",
+			expected: useragent.Agent{OS: useragent.Other, Device: useragent.DeviceBot, Browser: useragent.Other},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.expected, useragent.Parse(testCase.ua))
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Bitlytest-Signature"
+	EventHeader     = "X-Bitlytest-Event"
+	DeliveryHeader  = "X-Bitlytest-Delivery"
+	TimestampHeader = "X-Bitlytest-Timestamp"
+
+	signaturePrefix = "sha256="
+	// errorBodyBytes caps how much of a failed response ends up in the error.
+	errorBodyBytes = 256
+)
+
+// Sign returns the signature of a payload sent at timestamp: the hex HMAC-SHA256 of "<timestamp>.<body>"
+// keyed with the webhook secret. Covering the timestamp lets receivers reject replayed requests.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature header of a request the way receivers are expected to.
+func Verify(secret string, header http.Header, body []byte) bool {
+	timestamp, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(header.Get(SignatureHeader)))
+}
+
+// Message is one signed POST to a webhook.
+type Message struct {
+	Url      string
+	Secret   string
+	Event    string
+	Delivery int64
+	Body     []byte
+}
+
+// Sender posts messages to webhooks.
+type Sender struct {
+	Client *http.Client
+	Now    func() time.Time
+}
+
+func New(client *http.Client) *Sender {
+	return &Sender{Client: client, Now: time.Now}
+}
+
+// Send posts the message and returns the status code of the answer. Anything but a 2xx is an error,
+// the status is still returned then so it can be recorded.
+func (s *Sender) Send(ctx context.Context, message Message) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, message.Url, bytes.NewReader(message.Body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := s.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "bitlytest-webhooks")
+	req.Header.Set(EventHeader, message.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(message.Delivery, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(message.Secret, timestamp, message.Body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		answer, _ := ioutil.ReadAll(io.LimitReader(resp.Body, errorBodyBytes))
+		return resp.StatusCode, fmt.Errorf("webhook %s: status %d: %s", message.Url, resp.StatusCode, strings.TrimSpace(string(answer)))
+	}
+
+	// Drain the body so the connection can be reused.
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
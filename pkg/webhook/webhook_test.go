@@ -0,0 +1,77 @@
+package webhook_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kristina71/bitlytest/pkg/webhook"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"link.created"}`)
+	signature := webhook.Sign("secret", 1760000000, body)
+
+	require.Regexp(t, "^sha256=[0-9a-f]{64}$", signature)
+	require.Equal(t, signature, webhook.Sign("secret", 1760000000, body))
+	require.NotEqual(t, signature, webhook.Sign("other", 1760000000, body))
+	require.NotEqual(t, signature, webhook.Sign("secret", 1760000001, body))
+}
+
+func TestSend(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	sender := webhook.New(ts.Client())
+	sender.Now = func() time.Time { return time.Unix(1760000000, 0) }
+
+	status, err := sender.Send(context.Background(), webhook.Message{
+		Url:      ts.URL,
+		Secret:   "secret",
+		Event:    "link.created",
+		Delivery: 70007,
+		Body:     []byte(`{"event":"link.created"}`),
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, status)
+
+	r := <-received
+	body := <-bodies
+	require.Equal(t, http.MethodPost, r.Method)
+	require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+	require.Equal(t, "link.created", r.Header.Get(webhook.EventHeader))
+	require.Equal(t, "70007", r.Header.Get(webhook.DeliveryHeader))
+	require.Equal(t, "1760000000", r.Header.Get(webhook.TimestampHeader))
+	require.Equal(t, `{"event":"link.created"}`, string(body))
+	require.True(t, webhook.Verify("secret", r.Header, body))
+	require.False(t, webhook.Verify("other", r.Header, body))
+	require.False(t, webhook.Verify("secret", r.Header, []byte(`{"event":"link.deleted"}`)))
+}
+
+func TestSendFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "try later", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	status, err := webhook.New(ts.Client()).Send(context.Background(), webhook.Message{Url: ts.URL, Secret: "secret", Body: []byte(`{}`)})
+	require.EqualError(t, err, "webhook "+ts.URL+": status 503: try later")
+	require.Equal(t, http.StatusServiceUnavailable, status)
+
+	ts.Close()
+	status, err = webhook.New(http.DefaultClient).Send(context.Background(), webhook.Message{Url: ts.URL, Secret: "secret", Body: []byte(`{}`)})
+	require.Error(t, err)
+	require.Equal(t, 0, status)
+}
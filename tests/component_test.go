@@ -22,8 +22,8 @@ func TestCreate(t *testing.T) {
 	cfg := config.New()
 	db := adapters.DBConnect(cfg)
 	adapters := adapters.New(db)
-	repo := repositories.New(adapters)
-	service := service.New(repo)
+	repo := repositories.New(adapters, cfg)
+	service := service.New(repo, cfg)
 
 	ts := httptest.NewServer(endpoints.New(service))
 	defer ts.Close()
@@ -112,8 +112,8 @@ func TestGetBySmallUrl(t *testing.T) {
 	cfg := config.New()
 	db := adapters.DBConnect(cfg)
 	adapters := adapters.New(db)
-	repo := repositories.New(adapters)
-	service := service.New(repo)
+	repo := repositories.New(adapters, cfg)
+	service := service.New(repo, cfg)
 
 	ts := httptest.NewServer(endpoints.New(service))
 	defer ts.Close()
@@ -172,8 +172,8 @@ func TestUpdate(t *testing.T) {
 	cfg := config.New()
 	db := adapters.DBConnect(cfg)
 	adapters := adapters.New(db)
-	repo := repositories.New(adapters)
-	service := service.New(repo)
+	repo := repositories.New(adapters, cfg)
+	service := service.New(repo, cfg)
 
 	ts := httptest.NewServer(endpoints.New(service))
 	defer ts.Close()
@@ -249,8 +249,8 @@ func TestDelete(t *testing.T) {
 	cfg := config.New()
 	db := adapters.DBConnect(cfg)
 	adapters := adapters.New(db)
-	repo := repositories.New(adapters)
-	service := service.New(repo)
+	repo := repositories.New(adapters, cfg)
+	service := service.New(repo, cfg)
 
 	ts := httptest.NewServer(endpoints.New(service))
 	defer ts.Close()
@@ -297,7 +297,8 @@ func TestDelete(t *testing.T) {
 				err := DeleteItem(ts, testCase.body)
 				require.NoError(t, err)
 
-				_, err = adapters.GetBySmallUrl(context.Background(), testCase.body)
+				// Deleted links stay in the trash, they no longer resolve.
+				_, err = service.GetUrl(context.Background(), testCase.body)
 				require.Error(t, err)
 			})
 	}
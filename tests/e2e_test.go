@@ -38,8 +38,8 @@ func TestCreateAndGetUrlBySmall(t *testing.T) {
 	cfg := config.New()
 	db := adapters.DBConnect(cfg)
 	adapters := adapters.New(db)
-	repo := repositories.New(adapters)
-	service := service.New(repo)
+	repo := repositories.New(adapters, cfg)
+	service := service.New(repo, cfg)
 
 	ts := httptest.NewServer(endpoints.New(service))
 	defer ts.Close()
@@ -120,8 +120,8 @@ func TestCreateAndGetUrls(t *testing.T) {
 	cfg := config.New()
 	db := adapters.DBConnect(cfg)
 	adapters := adapters.New(db)
-	repo := repositories.New(adapters)
-	service := service.New(repo)
+	repo := repositories.New(adapters, cfg)
+	service := service.New(repo, cfg)
 
 	ts := httptest.NewServer(endpoints.New(service))
 	defer ts.Close()
@@ -165,7 +165,7 @@ func TestCreateAndGetUrls(t *testing.T) {
 				defer resp.Body.Close()
 
 				//не через адаптер а через сервис
-				url1, err := service.GetAllUrl(context.TODO())
+				url1, err := service.GetAllUrl(context.TODO(), models.UrlFilter{})
 				testCase.db_error_checker(t, err)
 
 				if err == nil {
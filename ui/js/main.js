@@ -2,7 +2,15 @@ document.addEventListener('DOMContentLoaded', function () {
   document.getElementById("preloader").classList.remove("active");
   var xhr = new XMLHttpRequest();
 
-  xhr.open('POST', '/all', false);
+  var params = new URLSearchParams(document.location.search);
+  var tag = params.get("tag");
+  var q = params.get("q");
+  document.getElementById("search").value = q || "";
+  if (q) {
+    xhr.open('POST', '/search?q=' + encodeURIComponent(q), false);
+  } else {
+    xhr.open('POST', tag ? '/all?tag=' + encodeURIComponent(tag) : '/all', false);
+  }
   xhr.send();
   if (xhr.status != 200) {
     alert(xhr.status + xhr.responseText);
@@ -13,20 +21,74 @@ document.addEventListener('DOMContentLoaded', function () {
       document.getElementById("app").innerHTML += "<div class=\"row\">" +
         "<form method=\"POST\" action=\"/edit\" id=\"form\">"+
         "<input type=\"hidden\" name=\"id\" value=\""+obj[i].id+"\">"+
-        "<div class=\"input-field col s2\"><label>http://"+ document.location.host+"/</label></div>"+
+        "<div class=\"input-field col s2\"><label>" + escapeHtml(shortBase(obj[i])) + "</label></div>"+
         "<div class=\"input-field col s3\">"+
         "<input type=\"text\" name=\"small_url\" value=\"" + obj[i].small_url + "\">" +
         "</div><div class=\"input-field col s0.5\">=&gt;</div><div class=\"input-field col s3\"><input type=\"text\" name=\"origin_url\" value=\"" + obj[i].origin_url + "\"></div>" +
+        "<div class=\"input-field col s3\"><input type=\"text\" name=\"title\" placeholder=\"Title\" value=\"" + escapeHtml(obj[i].title || "") + "\"></div>" +
+        "<div class=\"input-field col s3\"><input type=\"text\" name=\"tags\" placeholder=\"Tags, comma separated\" value=\"" + escapeHtml((obj[i].tags || []).join(", ")) + "\"></div>" +
+        "<div class=\"input-field col s6\"><textarea class=\"materialize-textarea\" name=\"notes\" placeholder=\"Notes\">" + escapeHtml(obj[i].notes || "") + "</textarea></div>" +
         "<div class=\"input-field col s1\"> <input type=\"submit\" name=\"save\" value=\"Save\" class=\"waves-effect waves-light btn\">" +
         "</div></form>"+
         "<form method=\"POST\" action=\"/delete\" id=\"form\">"+
         "<div class=\"input-field col s1\">"+
         "<input type=\"hidden\" name=\"id\" value=\""+obj[i].id+"\">"+
         "<input type=\"submit\" class=\"waves-effect waves-light btn\" value=\"X\"></div></form>" +
-        "<a href=\"http://"+ document.location.host+"/"+obj[i].small_url+"\">Open</a></div>";
+        "<a href=\"" + shortBase(obj[i]) + obj[i].small_url + "\">Open</a> " +
+        "<a href=\"" + shortBase(obj[i]) + "qr/" + obj[i].small_url+"?format=png&size=512\" download=\""+obj[i].small_url+".png\">QR</a> " +
+        (obj[i].tags || []).map(function (t) {
+          return "<a class=\"chip\" href=\"?tag=" + encodeURIComponent(t) + "\">" + escapeHtml(t) + "</a>";
+        }).join("") + "</div>";
     }
   }
+
+  document.querySelectorAll("form[action='/create'], form[action='/edit'], form[action='/delete']").forEach(function (form) {
+    form.addEventListener("submit", submitJson);
+  });
 });
+
+// submitJson sends a link form as the JSON body the API expects.
+function submitJson(event) {
+  event.preventDefault();
+  var form = event.target;
+  if (form.getAttribute("action") === "/delete" && !confirm("Move this link to the trash? It can be restored until it is purged.")) {
+    return;
+  }
+  var body = {};
+  new FormData(form).forEach(function (value, key) {
+    if (key === "save") {
+      return;
+    }
+    if (key === "id") {
+      body.id = parseInt(value, 10);
+    } else if (key === "tags") {
+      body.tags = value.split(",").map(function (t) { return t.trim(); }).filter(Boolean);
+    } else {
+      body[key] = value;
+    }
+  });
+
+  var xhr = new XMLHttpRequest();
+  xhr.open("POST", form.getAttribute("action"), false);
+  xhr.setRequestHeader("Content-Type", "application/json");
+  xhr.send(JSON.stringify(body));
+  if (xhr.status != 200) {
+    alert(xhr.status + xhr.responseText);
+    return;
+  }
+  document.location.reload();
+}
+
+// shortBase is where the link is served: its custom domain or the host of this page.
+function shortBase(link) {
+  return "http://" + (link.domain || document.location.host) + "/";
+}
+
+function escapeHtml(value) {
+  return String(value).replace(/[&<>"']/g, function (c) {
+    return {"&": "&amp;", "<": "&lt;", ">": "&gt;", "\"": "&quot;", "'": "&#39;"}[c];
+  });
+}
 document.getElementById("app").onerror = function () {
   alert("Something went wrong");
 };
\ No newline at end of file